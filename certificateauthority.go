@@ -0,0 +1,67 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+)
+
+// CertificateAuthority pairs a certificate authority's certificate with the key used to sign the certificates it issues.
+// Any revocation or issuer URLs are added to each certificate it issues unless the builder supplies its own
+type CertificateAuthority struct {
+	Certificate *x509.Certificate
+	Key         crypto.Signer
+
+	// CRLDistributionPoints are the URLs of the certificate revocation list published by this certificate authority
+	CRLDistributionPoints []string
+	// OCSPServers are the URLs of the OCSP responders for certificates issued by this certificate authority
+	OCSPServers []string
+	// IssuingCertificateURLs are the URLs from which the certificate of this certificate authority can be retrieved
+	IssuingCertificateURLs []string
+	// SerialNumbers provides the serial numbers of issued certificates unless the builder supplies its own, wrap it with
+	// NewUniqueSerialNumberSource to guarantee that no serial number is issued twice
+	SerialNumbers SerialNumberSource
+}
+
+// Issue builds a certificate from the configuration of builder signed by the certificate authority. The revocation
+// URLs and serial number source of the certificate authority are applied to a copy, builder itself is not modified
+func (a *CertificateAuthority) Issue(builder *CertificateBuilder) (*x509.Certificate, crypto.Signer, error) {
+	if a == nil {
+		return nil, nil, fmt.Errorf("invalid argument, certificate authority cannot be nil")
+	}
+	if builder == nil {
+		return nil, nil, fmt.Errorf("invalid argument, builder cannot be nil")
+	}
+	issued := builder.cloneForIssue()
+	issued.inheritRevocationEndpoints(a)
+	if a.SerialNumbers != nil && issued.serialNumber == nil && issued.serialNumberSource == nil {
+		issued.WithSerialNumberSource(a.SerialNumbers)
+	}
+	return issued.BuildSignedCertificate(a.Certificate, a.Key)
+}
+
+// cloneForIssue copies the builder with its own errors and revocation URLs so that the options applied by Issue are not
+// recorded in the original
+func (c *CertificateBuilder) cloneForIssue() *CertificateBuilder {
+	clone := *c
+	if builderErr, ok := c.err.(*BuilderError); ok {
+		clone.err = &BuilderError{Errors: append([]error(nil), builderErr.Errors...)}
+	}
+	clone.crlDistributionPoints = append([]string(nil), c.crlDistributionPoints...)
+	clone.ocspServers = append([]string(nil), c.ocspServers...)
+	clone.issuingCertificateURLs = append([]string(nil), c.issuingCertificateURLs...)
+	return &clone
+}
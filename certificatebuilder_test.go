@@ -131,7 +131,7 @@ func TestCertificateBuilder_WithOrganizationShouldNotUpdateOrganizationWhenBuild
 	c.err = fmt.Errorf("sample error")
 	c.WithOrganization("Acme.")
 
-	if c.organization == "Acme." {
+	if len(c.organization) != 0 {
 		t.Fatal("Organization was updated when builder had error")
 	}
 
@@ -141,7 +141,7 @@ func TestCertificateBuilder_WithOrganizationShouldNotUpdateOrganizationWhenValue
 	c := NewCertificateBuilder()
 	c.WithOrganization("Acme.")
 	c.WithOrganization("")
-	if c.organization == "" {
+	if len(c.organization) != 1 || c.organization[0] != "Acme." {
 		t.Fatal("Organization did not reject empty name")
 	}
 
@@ -158,7 +158,7 @@ func TestCertificateBuilder_WithOrganizationShouldSetErrorWhenValueIsEmpty(t *te
 func TestCertificateBuilder_WithOrganizationShouldUpdateOrganizationWhenBuilderDoesNotHaveErrorAndValueIsNotEmpty(t *testing.T) {
 	c := NewCertificateBuilder()
 	c.WithOrganization("Acme.")
-	if c.organization != "Acme." {
+	if len(c.organization) != 1 || c.organization[0] != "Acme." {
 		t.Fatal("Organization was not updated when name was valid and no error present")
 	}
 	if c.err != nil {
@@ -171,7 +171,7 @@ func TestCertificateBuilder_WithOrganizationUnitShouldNotUpdateOrganizationUnitW
 	c.err = fmt.Errorf("sample error")
 	c.WithOrganizationUnit("Dynamite Lab")
 
-	if c.organization == "Acme." {
+	if len(c.organizationUnit) != 0 {
 		t.Fatal("Organization Unit was updated when builder had error")
 	}
 
@@ -181,7 +181,7 @@ func TestCertificateBuilder_WithOrganizationUnitShouldNotUpdateOrganizationUnitW
 	c := NewCertificateBuilder()
 	c.WithOrganizationUnit("Dynamite Lab")
 	c.WithOrganizationUnit("")
-	if c.organizationUnit == "" {
+	if len(c.organizationUnit) != 1 || c.organizationUnit[0] != "Dynamite Lab" {
 		t.Fatal("Organization Unit did not reject empty name")
 	}
 
@@ -198,7 +198,7 @@ func TestCertificateBuilder_WithOrganizationUnitShouldSetErrorWhenValueIsEmpty(t
 func TestCertificateBuilder_WithOrganizationUnitShouldUpdateOrganizationUnitWhenBuilderDoesNotHaveErrorAndValueIsNotEmpty(t *testing.T) {
 	c := NewCertificateBuilder()
 	c.WithOrganizationUnit("Dynamite Lab")
-	if c.organizationUnit != "Dynamite Lab" {
+	if len(c.organizationUnit) != 1 || c.organizationUnit[0] != "Dynamite Lab" {
 		t.Fatal("Organization Unit was not updated when name was valid and no error present")
 	}
 	if c.err != nil {
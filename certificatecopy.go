@@ -0,0 +1,244 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+)
+
+var (
+	oidExtensionNameConstraints       = asn1.ObjectIdentifier{2, 5, 29, 30}
+	oidExtensionCRLDistributionPoints = asn1.ObjectIdentifier{2, 5, 29, 31}
+	oidExtensionAuthorityInfoAccess   = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 1}
+	// oidExtensionSCTList holds the signed certificate timestamps of RFC 6962, which are bound to the original
+	// certificate and never verify for a copy
+	oidExtensionSCTList = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 2}
+	// oidExtensionCTPoison marks an RFC 6962 precertificate, which must not be used as a certificate
+	oidExtensionCTPoison = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11129, 2, 4, 3}
+)
+
+// CopyOption configures which values NewCertificateBuilderFromCertificate copies in addition to its defaults
+type CopyOption func(*copyOptions)
+
+type copyOptions struct {
+	serialNumber bool
+	validity     bool
+	lifetime     bool
+}
+
+// CopyWithSerialNumber copies the serial number of the certificate, by default a new serial number is used
+func CopyWithSerialNumber() CopyOption {
+	return func(o *copyOptions) {
+		o.serialNumber = true
+	}
+}
+
+// CopyWithValidity copies the not before and not after times of the certificate, by default the builder's default
+// validity is used
+func CopyWithValidity() CopyOption {
+	return func(o *copyOptions) {
+		o.validity = true
+	}
+}
+
+// CopyWithLifetime keeps the lifetime of the certificate, starting from the time the new certificate is built
+func CopyWithLifetime() CopyOption {
+	return func(o *copyOptions) {
+		o.lifetime = true
+	}
+}
+
+// NewCertificateBuilderFromCertificate creates a certificate builder seeded with the subject, subject alternative names,
+// key usages, basic and name constraints, revocation URLs, policies and other extensions of cert. A new key of the same
+// algorithm is generated unless one is supplied, and the serial number and validity are reset unless options say
+// otherwise. Key identifiers are recomputed when the builder is built. The subject keeps the attribute order and string
+// types of cert unless one of the subject options is used, in which case it is rebuilt from the copied attributes
+func NewCertificateBuilderFromCertificate(cert *x509.Certificate, options ...CopyOption) (*CertificateBuilder, error) {
+	if cert == nil {
+		return nil, fmt.Errorf("invalid argument, certificate cannot be nil")
+	}
+	settings := &copyOptions{}
+	for _, option := range options {
+		option(settings)
+	}
+
+	builder := NewCertificateBuilder()
+	if algorithm, bitSize, ok := keyAlgorithmOf(cert.PublicKey); ok {
+		builder.WithKeyAlgorithm(algorithm)
+		if bitSize != 0 {
+			builder.WithBitSize(bitSize)
+		}
+	}
+	subject, err := unmarshalSubject(cert.RawSubject)
+	if err != nil {
+		return nil, fmt.Errorf("certificate subject is not valid: %w", err)
+	}
+	if err := applySubjectName(builder, subject); err != nil {
+		return nil, fmt.Errorf("certificate subject cannot be copied: %w", err)
+	}
+	builder.rawSubject = append([]byte(nil), cert.RawSubject...)
+	applySubjectAlternativeNames(builder, cert)
+
+	if cert.KeyUsage != 0 {
+		builder.WithKeyUsage(cert.KeyUsage)
+	}
+	if len(cert.ExtKeyUsage) > 0 && len(cert.UnknownExtKeyUsage) == 0 {
+		builder.WithEnhancedKeyUsage(cert.ExtKeyUsage...)
+	}
+	if cert.BasicConstraintsValid {
+		builder.WithBasicConstraint().
+			WithIsCertificateAuthority(cert.IsCA)
+		if cert.IsCA && (cert.MaxPathLen > 0 || (cert.MaxPathLen == 0 && cert.MaxPathLenZero)) {
+			builder.WithMaxPathLength(cert.MaxPathLen)
+		}
+	}
+	applyNameConstraints(builder, cert)
+	if len(cert.CRLDistributionPoints) > 0 {
+		builder.WithCRLDistributionPoints(cert.CRLDistributionPoints...)
+	}
+	if len(cert.OCSPServer) > 0 {
+		builder.WithOCSPServers(cert.OCSPServer...)
+	}
+	if len(cert.IssuingCertificateURL) > 0 {
+		builder.WithIssuingCertificateURLs(cert.IssuingCertificateURL...)
+	}
+	if len(cert.SubjectKeyId) > 0 {
+		builder.WithIncludeSubjectKeyIdentifier()
+	}
+	if len(cert.AuthorityKeyId) > 0 {
+		builder.WithIncludeAuthorityKeyIdentifier()
+	}
+	if err := applyCertificateExtensions(builder, cert); err != nil {
+		return nil, err
+	}
+
+	if settings.serialNumber {
+		builder.WithSerialNumber(cert.SerialNumber)
+	}
+	if settings.validity {
+		builder.WithNotBefore(cert.NotBefore).
+			WithNotAfter(cert.NotAfter)
+	} else if settings.lifetime {
+		builder.WithValidity(cert.NotAfter.Sub(cert.NotBefore))
+	}
+
+	if err := builder.GetError(); err != nil {
+		return nil, err
+	}
+	return builder, nil
+}
+
+func applySubjectAlternativeNames(builder *CertificateBuilder, cert *x509.Certificate) {
+	if len(cert.DNSNames) > 0 {
+		builder.WithDnsNames(cert.DNSNames...)
+	}
+	if len(cert.IPAddresses) > 0 {
+		builder.WithIPAddresses(cert.IPAddresses...)
+	}
+	if len(cert.EmailAddresses) > 0 {
+		builder.WithEmailAddresses(cert.EmailAddresses...)
+	}
+	if len(cert.URIs) > 0 {
+		builder.WithURIs(cert.URIs...)
+	}
+}
+
+func applyNameConstraints(builder *CertificateBuilder, cert *x509.Certificate) {
+	if len(cert.PermittedDNSDomains) > 0 {
+		builder.WithPermittedDnsDomains(cert.PermittedDNSDomains...)
+	}
+	if len(cert.ExcludedDNSDomains) > 0 {
+		builder.WithExcludedDnsDomains(cert.ExcludedDNSDomains...)
+	}
+	if len(cert.PermittedIPRanges) > 0 {
+		builder.WithPermittedIPRanges(cert.PermittedIPRanges...)
+	}
+	if len(cert.ExcludedIPRanges) > 0 {
+		builder.WithExcludedIPRanges(cert.ExcludedIPRanges...)
+	}
+	if len(cert.PermittedEmailAddresses) > 0 {
+		builder.WithPermittedEmailAddresses(cert.PermittedEmailAddresses...)
+	}
+	if len(cert.ExcludedEmailAddresses) > 0 {
+		builder.WithExcludedEmailAddresses(cert.ExcludedEmailAddresses...)
+	}
+	if len(cert.PermittedURIDomains) > 0 {
+		builder.WithPermittedURIDomains(cert.PermittedURIDomains...)
+	}
+	if len(cert.ExcludedURIDomains) > 0 {
+		builder.WithExcludedURIDomains(cert.ExcludedURIDomains...)
+	}
+	builder.WithNameConstraintsCritical(cert.PermittedDNSDomainsCritical)
+}
+
+// applyCertificateExtensions copies the policy extensions of cert and every extension the builder does not otherwise
+// model. Policies and extended key usages which cannot be represented by the builder are copied unchanged while
+// certificate transparency timestamps and precertificate poison are dropped as they only apply to the original
+func applyCertificateExtensions(builder *CertificateBuilder, cert *x509.Certificate) error {
+	for _, extension := range cert.Extensions {
+		switch {
+		case extension.Id.Equal(oidExtensionSubjectKeyId):
+			builder.WithSubjectKeyIdentifierCritical(extension.Critical)
+		case extension.Id.Equal(oidExtensionAuthorityKeyIdentifier),
+			extension.Id.Equal(oidExtensionSubjectAltName),
+			extension.Id.Equal(oidExtensionKeyUsage),
+			extension.Id.Equal(oidExtensionBasicConstraints),
+			extension.Id.Equal(oidExtensionNameConstraints),
+			extension.Id.Equal(oidExtensionCRLDistributionPoints),
+			extension.Id.Equal(oidExtensionAuthorityInfoAccess),
+			extension.Id.Equal(oidExtensionSCTList),
+			extension.Id.Equal(oidExtensionCTPoison):
+			continue
+		case extension.Id.Equal(oidExtensionExtendedKeyUsage):
+			if len(cert.UnknownExtKeyUsage) > 0 {
+				builder.WithExtensions(extension)
+			}
+		case extension.Id.Equal(oidExtensionCertificatePolicies):
+			policies, err := parseCertificatePolicies(extension.Value)
+			if err != nil {
+				builder.WithExtensions(extension)
+				continue
+			}
+			builder.WithCertificatePolicies(policies...)
+		case extension.Id.Equal(oidExtensionPolicyMappings):
+			mappings, err := parsePolicyMappingsExtension(extension.Value)
+			if err != nil {
+				return fmt.Errorf("invalid policy mappings: %v", err)
+			}
+			builder.WithPolicyMappings(mappings...)
+		case extension.Id.Equal(oidExtensionPolicyConstraints):
+			requireExplicitPolicy, inhibitPolicyMapping, err := parsePolicyConstraintsExtension(extension.Value)
+			if err != nil {
+				return fmt.Errorf("invalid policy constraints: %v", err)
+			}
+			if requireExplicitPolicy >= 0 {
+				builder.WithRequireExplicitPolicy(requireExplicitPolicy)
+			}
+			if inhibitPolicyMapping >= 0 {
+				builder.WithInhibitPolicyMapping(inhibitPolicyMapping)
+			}
+		case extension.Id.Equal(oidExtensionInhibitAnyPolicy):
+			var skipCerts int
+			if err := unmarshalExtension(extension.Value, &skipCerts); err != nil {
+				return fmt.Errorf("invalid inhibit any policy: %v", err)
+			}
+			builder.WithInhibitAnyPolicy(skipCerts)
+		default:
+			builder.WithExtensions(extension)
+		}
+	}
+	return nil
+}
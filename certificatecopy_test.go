@@ -0,0 +1,293 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var testCustomExtension = pkix.Extension{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 55555, 9, 1}, Value: []byte{0x05, 0x00}}
+
+func newTestSourceCertificate(t *testing.T) *x509.Certificate {
+	t.Helper()
+	_, root, _ := newTestCertificateAuthorities(t)
+	cert, _, err := NewCertificateBuilder().
+		WithCommonName("Team CA").
+		WithOrganization("Acme.").
+		WithCountry("CA").
+		WithKeyAlgorithm(KeyAlgorithmECDSAP384).
+		WithIsCertificateAuthority(true).
+		WithMaxPathLength(0).
+		WithKeyUsage(x509.KeyUsageCertSign|x509.KeyUsageCRLSign).
+		WithEnhancedKeyUsage(x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth).
+		WithDnsNames("ca.example.com").
+		WithIPAddresses(net.ParseIP("10.0.0.1")).
+		WithPermittedDnsDomains("example.com").
+		WithCRLDistributionPoints("http://pki.example.com/team.crl").
+		WithCertificatePolicies(CertificatePolicy{
+			Policy:     testPolicyTeam,
+			CPSURIs:    []string{"https://pki.example.com/cps"},
+			UserNotice: &UserNotice{ExplicitText: "Test use only"},
+		}).
+		WithInhibitAnyPolicy(1).
+		WithExtensions(testCustomExtension).
+		WithIncludeSubjectKeyIdentifier().
+		WithIncludeAuthorityKeyIdentifier().
+		WithNotBefore(fixedClock()).
+		WithNotAfter(fixedClock().Add(30*24*time.Hour)).
+		BuildSignedCertificate(root.Certificate, root.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestNewCertificateBuilderFromCertificate_ShouldReturnError_WhenCertificateIsNil(t *testing.T) {
+	if _, err := NewCertificateBuilderFromCertificate(nil); err == nil {
+		t.Fatal("expected an error for a nil certificate")
+	}
+}
+
+func TestNewCertificateBuilderFromCertificate_ShouldCopyCertificateContents(t *testing.T) {
+	source := newTestSourceCertificate(t)
+
+	builder, err := NewCertificateBuilderFromCertificate(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _, err := builder.BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cert.Subject.String() != source.Subject.String() {
+		t.Fatalf("subject %v does not match %v", cert.Subject, source.Subject)
+	}
+	if !reflect.DeepEqual(cert.DNSNames, source.DNSNames) || !cert.IPAddresses[0].Equal(source.IPAddresses[0]) {
+		t.Fatal("subject alternative names were not copied")
+	}
+	if cert.KeyUsage != source.KeyUsage || !reflect.DeepEqual(cert.ExtKeyUsage, source.ExtKeyUsage) {
+		t.Fatal("key usages were not copied")
+	}
+	if !cert.IsCA || cert.MaxPathLen != 0 || !cert.MaxPathLenZero {
+		t.Fatal("basic constraints were not copied")
+	}
+	if !reflect.DeepEqual(cert.PermittedDNSDomains, source.PermittedDNSDomains) {
+		t.Fatal("name constraints were not copied")
+	}
+	if !reflect.DeepEqual(cert.CRLDistributionPoints, source.CRLDistributionPoints) {
+		t.Fatal("crl distribution points were not copied")
+	}
+	if !hasExtension(cert.Extensions, testCustomExtension.Id) {
+		t.Fatal("custom extension was not copied")
+	}
+	policies, err := parseCertificatePolicies(findExtension(t, cert, oidExtensionCertificatePolicies).Value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(policies) != 1 || policies[0].UserNotice == nil || policies[0].UserNotice.ExplicitText != "Test use only" || policies[0].CPSURIs[0] != "https://pki.example.com/cps" {
+		t.Fatalf("certificate policies were not copied %+v", policies)
+	}
+	if !hasExtension(cert.Extensions, oidExtensionInhibitAnyPolicy) {
+		t.Fatal("inhibit any policy was not copied")
+	}
+}
+
+func newTestNonCanonicalSubjectCertificate(t *testing.T) *x509.Certificate {
+	t.Helper()
+	source, _, err := NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithSubjectStringEncoding(SubjectStringEncodingPrintable).
+		WithCommonName("Acme Root CA").
+		WithExtraNames(pkix.AttributeTypeAndValue{Type: oidAttributeOrganization, Value: "Acme"}).
+		WithIsCertificateAuthority(true).
+		WithBasicConstraint().
+		WithKeyUsage(x509.KeyUsageCertSign | x509.KeyUsageCRLSign).
+		BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return source
+}
+
+func TestNewCertificateBuilderFromCertificate_ShouldKeepRawSubject(t *testing.T) {
+	source := newTestNonCanonicalSubjectCertificate(t)
+
+	builder, err := NewCertificateBuilderFromCertificate(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _, err := builder.BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(cert.RawSubject, source.RawSubject) {
+		t.Fatalf("subject %X does not match %X", cert.RawSubject, source.RawSubject)
+	}
+}
+
+func TestNewCertificateBuilderFromCertificate_ShouldRebuildSubject_WhenSubjectOptionIsUsed(t *testing.T) {
+	source := newTestNonCanonicalSubjectCertificate(t)
+
+	builder, err := NewCertificateBuilderFromCertificate(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _, err := builder.
+		WithCommonName("Acme Root CA 2").
+		BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cert.Subject.CommonName != "Acme Root CA 2" || len(cert.Subject.Organization) != 1 || cert.Subject.Organization[0] != "Acme" {
+		t.Fatalf("subject %v was not rebuilt from the copied attributes", cert.Subject)
+	}
+}
+
+func TestNewCertificateBuilderFromCertificate_ShouldDropCertificateTransparencyExtensions(t *testing.T) {
+	sctList, err := asn1.Marshal([]byte{0x00, 0x00})
+	if err != nil {
+		t.Fatal(err)
+	}
+	source, _, err := NewCertificateBuilder().
+		WithCommonName("www.example.com").
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithExtensions(
+			testCustomExtension,
+			pkix.Extension{Id: oidExtensionSCTList, Value: sctList},
+			pkix.Extension{Id: oidExtensionCTPoison, Critical: true, Value: []byte{0x05, 0x00}}).
+		BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder, err := NewCertificateBuilderFromCertificate(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _, err := builder.BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if hasExtension(cert.Extensions, oidExtensionSCTList) {
+		t.Fatal("signed certificate timestamps were copied")
+	}
+	if hasExtension(cert.Extensions, oidExtensionCTPoison) {
+		t.Fatal("precertificate poison was copied")
+	}
+	if !hasExtension(cert.Extensions, testCustomExtension.Id) {
+		t.Fatal("custom extension was not copied")
+	}
+}
+
+func TestNewCertificateBuilderFromCertificate_ShouldReturnError_WhenSubjectCannotBeReproduced(t *testing.T) {
+	source, _, err := NewCertificateBuilder().
+		WithCommonName("www.example.com").
+		WithCity("Saskatoon").
+		WithExtraNames(pkix.AttributeTypeAndValue{Type: oidAttributeLocality, Value: "Regina"}).
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewCertificateBuilderFromCertificate(source); !errors.Is(err, ErrDuplicateValue) {
+		t.Fatalf("error %v is not ErrDuplicateValue", err)
+	}
+}
+
+func TestNewCertificateBuilderFromCertificate_ShouldResetSerialAndValidity_ByDefault(t *testing.T) {
+	source := newTestSourceCertificate(t)
+
+	builder, err := NewCertificateBuilderFromCertificate(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, key, err := builder.BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cert.SerialNumber.Cmp(source.SerialNumber) == 0 {
+		t.Fatal("serial number was copied")
+	}
+	if cert.NotBefore.Equal(source.NotBefore) || cert.NotAfter.Equal(source.NotAfter) {
+		t.Fatal("validity was copied")
+	}
+	if publicKeysEqual(key.Public(), source.PublicKey) {
+		t.Fatal("a new key was not generated")
+	}
+	if algorithm, _, _ := keyAlgorithmOf(key.Public()); algorithm != KeyAlgorithmECDSAP384 {
+		t.Fatalf("key algorithm %v does not match the source certificate", algorithm)
+	}
+}
+
+func TestNewCertificateBuilderFromCertificate_ShouldCopySerialAndValidity_WhenRequested(t *testing.T) {
+	source := newTestSourceCertificate(t)
+
+	builder, err := NewCertificateBuilderFromCertificate(source, CopyWithSerialNumber(), CopyWithValidity())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _, err := builder.BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cert.SerialNumber.Cmp(source.SerialNumber) != 0 {
+		t.Fatal("serial number was not copied")
+	}
+	if !cert.NotBefore.Equal(source.NotBefore) || !cert.NotAfter.Equal(source.NotAfter) {
+		t.Fatal("validity was not copied")
+	}
+}
+
+func TestNewCertificateBuilderFromCertificate_ShouldKeepLifetime_WhenRequested(t *testing.T) {
+	source := newTestSourceCertificate(t)
+
+	builder, err := NewCertificateBuilderFromCertificate(source, CopyWithLifetime())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _, err := builder.BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cert.NotAfter.Sub(cert.NotBefore) != source.NotAfter.Sub(source.NotBefore) {
+		t.Fatalf("lifetime %v does not match %v", cert.NotAfter.Sub(cert.NotBefore), source.NotAfter.Sub(source.NotBefore))
+	}
+}
+
+func findExtension(t *testing.T, cert *x509.Certificate, oid asn1.ObjectIdentifier) pkix.Extension {
+	t.Helper()
+	for _, extension := range cert.Extensions {
+		if extension.Id.Equal(oid) {
+			return extension
+		}
+	}
+	t.Fatalf("extension %v not found", oid)
+	return pkix.Extension{}
+}
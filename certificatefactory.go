@@ -0,0 +1,225 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	rootCAValidity         = 10 * 365 * 24 * time.Hour
+	intermediateCAValidity = 5 * 365 * 24 * time.Hour
+	leafValidity           = 365 * 24 * time.Hour
+)
+
+// CertificateFactory builds certificates for common scenarios using CertificateBuilder with defaults suited to each
+type CertificateFactory struct {
+	keyAlgorithm KeyAlgorithm
+	organization string
+	clock        func() time.Time
+	random       io.Reader
+	keySource    KeySource
+}
+
+// NewCertificateFactory creates a new certificate factory which generates ECDSA P-256 keys
+func NewCertificateFactory() *CertificateFactory {
+	return &CertificateFactory{
+		keyAlgorithm: KeyAlgorithmECDSAP256,
+		organization: "",
+	}
+}
+
+// WithKeyAlgorithm sets the algorithm used to generate keys for every certificate built by the factory
+func (f *CertificateFactory) WithKeyAlgorithm(value KeyAlgorithm) *CertificateFactory {
+	f.keyAlgorithm = value
+	return f
+}
+
+// WithOrganization sets the organization included in the subject of every certificate built by the factory
+func (f *CertificateFactory) WithOrganization(value string) *CertificateFactory {
+	f.organization = value
+	return f
+}
+
+// WithClock sets the source of the current time from which validity periods are calculated, by default time.Now
+func (f *CertificateFactory) WithClock(value func() time.Time) *CertificateFactory {
+	f.clock = value
+	return f
+}
+
+// WithRandom sets the source of randomness for every certificate built by the factory, see CertificateBuilder.WithRandom
+func (f *CertificateFactory) WithRandom(value io.Reader) *CertificateFactory {
+	f.random = value
+	return f
+}
+
+// WithKeySource sets the source of the keys of every certificate built by the factory, see
+// CertificateBuilder.WithKeySource
+func (f *CertificateFactory) WithKeySource(value KeySource) *CertificateFactory {
+	f.keySource = value
+	return f
+}
+
+// NewRootCA builds a self-signed root certificate authority valid for 10 years
+func (f *CertificateFactory) NewRootCA(commonName string) (*CertificateAuthority, error) {
+	if commonName == "" {
+		return nil, fmt.Errorf("invalid argument, common name cannot be empty")
+	}
+	cert, key, err := f.newCertificateAuthorityBuilder(commonName, rootCAValidity).
+		BuildSelfSignedCertificate()
+	if err != nil {
+		return nil, err
+	}
+	return f.newCertificateAuthority(cert, key), nil
+}
+
+// NewIntermediateCA builds an intermediate certificate authority valid for 5 years, signed by parent, which may only
+// issue end entity certificates
+func (f *CertificateFactory) NewIntermediateCA(parent *CertificateAuthority, commonName string) (*CertificateAuthority, error) {
+	if commonName == "" {
+		return nil, fmt.Errorf("invalid argument, common name cannot be empty")
+	}
+	cert, key, err := parent.Issue(f.newCertificateAuthorityBuilder(commonName, intermediateCAValidity).
+		WithMaxPathLength(0).
+		WithIncludeAuthorityKeyIdentifier())
+	if err != nil {
+		return nil, err
+	}
+	return f.newCertificateAuthority(cert, key), nil
+}
+
+// NewServerCertificate builds a TLS server certificate signed by parent for hosts, each of which is either a DNS name
+// or an IP address. The first host is also used as the common name unless it is longer than a common name permits, the
+// hosts are always included as subject alternative names
+func (f *CertificateFactory) NewServerCertificate(parent *CertificateAuthority, hosts ...string) (*x509.Certificate, crypto.Signer, error) {
+	if len(hosts) == 0 {
+		return nil, nil, fmt.Errorf("invalid argument, at least one host is required")
+	}
+	return parent.Issue(f.newServerBuilder(hosts).
+		WithIncludeAuthorityKeyIdentifier())
+}
+
+// NewClientCertificate builds a TLS client certificate signed by parent for identity, identities that are absolute
+// URIs (such as SPIFFE IDs) or email addresses are also included as subject alternative names. Such identities are
+// left out of the common name when they are longer than a common name permits
+func (f *CertificateFactory) NewClientCertificate(parent *CertificateAuthority, identity string) (*x509.Certificate, crypto.Signer, error) {
+	if identity == "" {
+		return nil, nil, fmt.Errorf("invalid argument, identity cannot be empty")
+	}
+	uri, err := url.Parse(identity)
+	isURI := err == nil && uri.IsAbs()
+	isEmailAddress := !isURI && strings.Contains(identity, "@")
+
+	commonName := identity
+	if isURI || isEmailAddress {
+		commonName = endEntityCommonName(identity)
+	}
+	builder := f.newEndEntityBuilder(commonName).
+		WithEnhancedKeyUsage(x509.ExtKeyUsageClientAuth).
+		WithIncludeAuthorityKeyIdentifier()
+	if isURI {
+		builder.WithURIs(uri)
+	} else if isEmailAddress {
+		builder.WithEmailAddresses(identity)
+	}
+	return parent.Issue(builder)
+}
+
+// NewLocalhostCertificate builds a self-signed TLS server certificate for localhost and the loopback addresses,
+// suitable for local development of web APIs
+func (f *CertificateFactory) NewLocalhostCertificate() (*x509.Certificate, crypto.Signer, error) {
+	return f.newServerBuilder([]string{"localhost", "127.0.0.1", "::1"}).
+		BuildSelfSignedCertificate()
+}
+
+// newCertificateAuthority pairs cert and key with a source guaranteeing the serial numbers of the certificates it
+// issues are unique
+func (f *CertificateFactory) newCertificateAuthority(cert *x509.Certificate, key crypto.Signer) *CertificateAuthority {
+	return &CertificateAuthority{
+		Certificate:   cert,
+		Key:           key,
+		SerialNumbers: NewUniqueSerialNumberSource(NewRandomSerialNumberSource(f.random)),
+	}
+}
+
+func (f *CertificateFactory) newCertificateAuthorityBuilder(commonName string, validity time.Duration) *CertificateBuilder {
+	return f.newBuilder(commonName, validity).
+		WithIsCertificateAuthority(true).
+		WithKeyUsage(x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature)
+}
+
+func (f *CertificateFactory) newServerBuilder(hosts []string) *CertificateBuilder {
+	builder := f.newEndEntityBuilder(endEntityCommonName(hosts[0])).
+		WithEnhancedKeyUsage(x509.ExtKeyUsageServerAuth)
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			builder.WithIPAddresses(ip)
+		} else {
+			builder.WithDnsNames(host)
+		}
+	}
+	return builder
+}
+
+func (f *CertificateFactory) newEndEntityBuilder(commonName string) *CertificateBuilder {
+	keyUsage := x509.KeyUsageDigitalSignature
+	if f.keyAlgorithm.publicKeyAlgorithm() == x509.RSA {
+		keyUsage |= x509.KeyUsageKeyEncipherment
+	}
+	return f.newBuilder(commonName, leafValidity).
+		WithKeyUsage(keyUsage)
+}
+
+func (f *CertificateFactory) newBuilder(commonName string, validity time.Duration) *CertificateBuilder {
+	notBefore := time.Now()
+	if f.clock != nil {
+		notBefore = f.clock()
+	}
+	builder := NewCertificateBuilder().
+		WithKeyAlgorithm(f.keyAlgorithm).
+		WithBasicConstraint().
+		WithIncludeSubjectKeyIdentifier().
+		WithNotBefore(notBefore).
+		WithNotAfter(notBefore.Add(validity))
+	if commonName != "" {
+		builder.WithCommonName(commonName)
+	}
+	if f.organization != "" {
+		builder.WithOrganization(f.organization)
+	}
+	if f.random != nil {
+		builder.WithRandom(f.random)
+	}
+	if f.keySource != nil {
+		builder.WithKeySource(f.keySource)
+	}
+	return builder
+}
+
+// endEntityCommonName returns identity when it fits within the length limit of a common name, otherwise an empty
+// string leaving the identity to the subject alternative names
+func endEntityCommonName(identity string) string {
+	if utf8.RuneCountInString(identity) > maxCommonNameLength {
+		return ""
+	}
+	return identity
+}
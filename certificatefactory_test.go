@@ -0,0 +1,176 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"crypto/x509"
+	"strings"
+	"testing"
+)
+
+func newTestCertificateAuthorities(t *testing.T) (*CertificateFactory, *CertificateAuthority, *CertificateAuthority) {
+	t.Helper()
+	factory := NewCertificateFactory().WithOrganization("Acme.")
+	root, err := factory.NewRootCA("Acme Root CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	intermediate, err := factory.NewIntermediateCA(root, "Acme Issuing CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return factory, root, intermediate
+}
+
+func verifyChain(t *testing.T, root *CertificateAuthority, intermediate *CertificateAuthority, cert *x509.Certificate, options x509.VerifyOptions) {
+	t.Helper()
+	options.Roots = x509.NewCertPool()
+	options.Roots.AddCert(root.Certificate)
+	options.Intermediates = x509.NewCertPool()
+	options.Intermediates.AddCert(intermediate.Certificate)
+	if _, err := cert.Verify(options); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCertificateFactory_NewRootCA_ShouldCreateSelfSignedCertificateAuthority(t *testing.T) {
+	root, err := NewCertificateFactory().NewRootCA("Acme Root CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !root.Certificate.IsCA || !root.Certificate.BasicConstraintsValid {
+		t.Fatal("root certificate is not a certificate authority")
+	}
+	if root.Certificate.KeyUsage&x509.KeyUsageCertSign == 0 {
+		t.Fatal("root certificate cannot sign certificates")
+	}
+	if err := root.Certificate.CheckSignatureFrom(root.Certificate); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCertificateFactory_NewIntermediateCA_ShouldLimitPathLengthToZero(t *testing.T) {
+	_, _, intermediate := newTestCertificateAuthorities(t)
+
+	if intermediate.Certificate.MaxPathLen != 0 || !intermediate.Certificate.MaxPathLenZero {
+		t.Fatalf("max path length %v is not zero", intermediate.Certificate.MaxPathLen)
+	}
+}
+
+func TestCertificateFactory_NewServerCertificate_ShouldVerifyForEachHost(t *testing.T) {
+	factory, root, intermediate := newTestCertificateAuthorities(t)
+	cert, key, err := factory.NewServerCertificate(intermediate, "api.acme.example", "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if key == nil {
+		t.Fatal("server key was not returned")
+	}
+	for _, host := range []string{"api.acme.example", "10.0.0.1"} {
+		verifyChain(t, root, intermediate, cert, x509.VerifyOptions{DNSName: host})
+	}
+}
+
+func TestCertificateFactory_NewServerCertificate_ShouldReturnError_WhenNoHostsAreGiven(t *testing.T) {
+	factory, _, intermediate := newTestCertificateAuthorities(t)
+	if _, _, err := factory.NewServerCertificate(intermediate); err == nil {
+		t.Fatal("error was not returned when no hosts were given")
+	}
+}
+
+func TestCertificateFactory_NewClientCertificate_ShouldVerifyForClientAuth(t *testing.T) {
+	factory, root, intermediate := newTestCertificateAuthorities(t)
+	cert, _, err := factory.NewClientCertificate(intermediate, "spiffe://acme.example/anvils")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifyChain(t, root, intermediate, cert, x509.VerifyOptions{KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+	if len(cert.URIs) != 1 || cert.URIs[0].String() != "spiffe://acme.example/anvils" {
+		t.Fatalf("uris %v do not contain the client identity", cert.URIs)
+	}
+}
+
+func TestCertificateFactory_NewServerCertificate_ShouldOmitCommonName_WhenHostIsLongerThanCommonNameLimit(t *testing.T) {
+	factory, root, intermediate := newTestCertificateAuthorities(t)
+	host := strings.Repeat("a", 63) + "." + strings.Repeat("b", 20) + ".example.com"
+	cert, _, err := factory.NewServerCertificate(intermediate, host)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifyChain(t, root, intermediate, cert, x509.VerifyOptions{DNSName: host})
+	if cert.Subject.CommonName != "" {
+		t.Fatalf("common name %q was set from a host longer than the limit", cert.Subject.CommonName)
+	}
+}
+
+func TestCertificateFactory_NewClientCertificate_ShouldOmitCommonName_WhenIdentityIsLongerThanCommonNameLimit(t *testing.T) {
+	factory, root, intermediate := newTestCertificateAuthorities(t)
+	identity := "spiffe://acme.example/ns/production/sa/" + strings.Repeat("anvil-", 10)
+	cert, _, err := factory.NewClientCertificate(intermediate, identity)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifyChain(t, root, intermediate, cert, x509.VerifyOptions{KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}})
+	if cert.Subject.CommonName != "" {
+		t.Fatalf("common name %q was set from an identity longer than the limit", cert.Subject.CommonName)
+	}
+	if len(cert.URIs) != 1 || cert.URIs[0].String() != identity {
+		t.Fatalf("uris %v do not contain the client identity", cert.URIs)
+	}
+}
+
+func TestCertificateFactory_NewClientCertificate_ShouldReturnError_WhenPlainIdentityIsLongerThanCommonNameLimit(t *testing.T) {
+	factory, _, intermediate := newTestCertificateAuthorities(t)
+	if _, _, err := factory.NewClientCertificate(intermediate, strings.Repeat("a", maxCommonNameLength+1)); err == nil {
+		t.Fatal("error was not returned for an identity which cannot be represented")
+	}
+}
+
+func TestCertificateFactory_NewClientCertificate_ShouldReturnError_WhenIdentityIsEmpty(t *testing.T) {
+	factory, _, intermediate := newTestCertificateAuthorities(t)
+	if _, _, err := factory.NewClientCertificate(intermediate, ""); err == nil {
+		t.Fatal("error was not returned for an empty identity")
+	}
+}
+
+func TestCertificateFactory_NewRootCA_ShouldReturnError_WhenCommonNameIsEmpty(t *testing.T) {
+	if _, err := NewCertificateFactory().NewRootCA(""); err == nil {
+		t.Fatal("error was not returned for an empty common name")
+	}
+}
+
+func TestCertificateFactory_NewIntermediateCA_ShouldReturnError_WhenCommonNameIsEmpty(t *testing.T) {
+	factory, root, _ := newTestCertificateAuthorities(t)
+	if _, err := factory.NewIntermediateCA(root, ""); err == nil {
+		t.Fatal("error was not returned for an empty common name")
+	}
+}
+
+func TestCertificateFactory_NewLocalhostCertificate_ShouldIncludeLoopbackNames(t *testing.T) {
+	cert, _, err := NewCertificateFactory().NewLocalhostCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, host := range []string{"localhost", "127.0.0.1", "::1"} {
+		if err := cert.VerifyHostname(host); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
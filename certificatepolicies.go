@@ -0,0 +1,405 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+)
+
+var (
+	oidExtensionCertificatePolicies = asn1.ObjectIdentifier{2, 5, 29, 32}
+	oidExtensionPolicyMappings      = asn1.ObjectIdentifier{2, 5, 29, 33}
+	oidExtensionPolicyConstraints   = asn1.ObjectIdentifier{2, 5, 29, 36}
+	oidExtensionInhibitAnyPolicy    = asn1.ObjectIdentifier{2, 5, 29, 54}
+	oidPolicyQualifierCPS           = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 2, 1}
+	oidPolicyQualifierUserNotice    = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 2, 2}
+
+	// OIDAnyPolicy is the special policy identifier which matches any certificate policy
+	OIDAnyPolicy = asn1.ObjectIdentifier{2, 5, 29, 32, 0}
+)
+
+// CertificatePolicy is a policy included in the certificate policies extension along with its optional qualifiers
+type CertificatePolicy struct {
+	// Policy is the policy identifier, OIDAnyPolicy may be used by certificate authorities
+	Policy asn1.ObjectIdentifier
+	// CPSURIs are the URLs of the certification practice statement published for the policy
+	CPSURIs []string
+	// UserNotice is an optional notice to be displayed to relying parties
+	UserNotice *UserNotice
+}
+
+// UserNotice is a certificate policy qualifier with text intended to be displayed to relying parties, either by
+// reference to numbered notices published by Organization or as ExplicitText
+type UserNotice struct {
+	Organization  string
+	NoticeNumbers []int
+	ExplicitText  string
+}
+
+// PolicyMapping declares that the policy IssuerDomainPolicy of the issuing certificate authority is considered
+// equivalent to SubjectDomainPolicy of the subject certificate authority
+type PolicyMapping struct {
+	IssuerDomainPolicy  asn1.ObjectIdentifier
+	SubjectDomainPolicy asn1.ObjectIdentifier
+}
+
+type policyInformation struct {
+	Policy     asn1.ObjectIdentifier
+	Qualifiers []asn1.RawValue `asn1:"optional"`
+}
+
+type policyQualifierInfo struct {
+	Id        asn1.ObjectIdentifier
+	Qualifier asn1.RawValue
+}
+
+// WithCertificatePolicies adds policies to the certificate policies extension, each policy may only be included once
+func (c *CertificateBuilder) WithCertificatePolicies(policies ...CertificatePolicy) *CertificateBuilder {
+	for i, policy := range policies {
+		if err := validateCertificatePolicy(policy); err != nil {
+			c.addError("WithCertificatePolicies", policy.Policy, err)
+			continue
+		}
+		if containsCertificatePolicy(c.certificatePolicies, policy.Policy) || containsCertificatePolicy(policies[:i], policy.Policy) {
+			c.addError("WithCertificatePolicies", policy.Policy, ErrDuplicateValue)
+		}
+	}
+	if c.err != nil {
+		return c
+	}
+	c.certificatePolicies = append(c.certificatePolicies, policies...)
+	return c
+}
+
+// WithPolicyMappings adds mappings from the policies of the issuing certificate authority to the equivalent policies of
+// this certificate authority, included in a critical policy mappings extension
+func (c *CertificateBuilder) WithPolicyMappings(mappings ...PolicyMapping) *CertificateBuilder {
+	for _, mapping := range mappings {
+		if len(mapping.IssuerDomainPolicy) == 0 || len(mapping.SubjectDomainPolicy) == 0 {
+			c.addError("WithPolicyMappings", mapping, fmt.Errorf("%w, both an issuer and a subject domain policy are required", ErrEmptyValue))
+		} else if mapping.IssuerDomainPolicy.Equal(OIDAnyPolicy) || mapping.SubjectDomainPolicy.Equal(OIDAnyPolicy) {
+			c.addError("WithPolicyMappings", mapping, fmt.Errorf("%w, anyPolicy cannot be mapped", ErrInvalidValue))
+		}
+	}
+	if c.err != nil {
+		return c
+	}
+	c.policyMappings = append(c.policyMappings, mappings...)
+	return c
+}
+
+// WithRequireExplicitPolicy sets the number of further certificates in a chain after which every certificate must
+// carry an acceptable policy, included in the critical policy constraints extension
+func (c *CertificateBuilder) WithRequireExplicitPolicy(skipCerts int) *CertificateBuilder {
+	if skipCerts < 0 {
+		c.addError("WithRequireExplicitPolicy", skipCerts, ErrNegativeValue)
+	}
+	if c.err != nil {
+		return c
+	}
+	c.requireExplicitPolicy = skipCerts
+	return c
+}
+
+// WithInhibitPolicyMapping sets the number of further certificates in a chain after which policy mapping is no longer
+// permitted, included in the critical policy constraints extension
+func (c *CertificateBuilder) WithInhibitPolicyMapping(skipCerts int) *CertificateBuilder {
+	if skipCerts < 0 {
+		c.addError("WithInhibitPolicyMapping", skipCerts, ErrNegativeValue)
+	}
+	if c.err != nil {
+		return c
+	}
+	c.inhibitPolicyMapping = skipCerts
+	return c
+}
+
+// WithInhibitAnyPolicy sets the number of further certificates in a chain after which anyPolicy no longer matches
+// other policies, included in the critical inhibit anyPolicy extension
+func (c *CertificateBuilder) WithInhibitAnyPolicy(skipCerts int) *CertificateBuilder {
+	if skipCerts < 0 {
+		c.addError("WithInhibitAnyPolicy", skipCerts, ErrNegativeValue)
+	}
+	if c.err != nil {
+		return c
+	}
+	c.inhibitAnyPolicy = skipCerts
+	return c
+}
+
+// hasPolicyConstraints returns true if any of the extensions restricted to certificate authorities has been configured
+func (c *CertificateBuilder) hasPolicyConstraints() bool {
+	return len(c.policyMappings) > 0 || c.requireExplicitPolicy >= 0 || c.inhibitPolicyMapping >= 0 || c.inhibitAnyPolicy >= 0
+}
+
+// buildPolicyExtensions encodes the configured certificate policies, policy mappings and policy constraints
+func (c *CertificateBuilder) buildPolicyExtensions() ([]pkix.Extension, error) {
+	extensions := make([]pkix.Extension, 0, 4)
+	if len(c.certificatePolicies) > 0 {
+		extension, err := marshalCertificatePoliciesExtension(c.certificatePolicies)
+		if err != nil {
+			return nil, err
+		}
+		extensions = append(extensions, extension)
+	}
+	if len(c.policyMappings) > 0 {
+		extension, err := marshalPolicyMappingsExtension(c.policyMappings)
+		if err != nil {
+			return nil, err
+		}
+		extensions = append(extensions, extension)
+	}
+	if c.requireExplicitPolicy >= 0 || c.inhibitPolicyMapping >= 0 {
+		extension, err := marshalPolicyConstraintsExtension(c.requireExplicitPolicy, c.inhibitPolicyMapping)
+		if err != nil {
+			return nil, err
+		}
+		extensions = append(extensions, extension)
+	}
+	if c.inhibitAnyPolicy >= 0 {
+		value, err := asn1.Marshal(c.inhibitAnyPolicy)
+		if err != nil {
+			return nil, err
+		}
+		extensions = append(extensions, pkix.Extension{Id: oidExtensionInhibitAnyPolicy, Critical: true, Value: value})
+	}
+	return extensions, nil
+}
+
+func validateCertificatePolicy(policy CertificatePolicy) error {
+	if len(policy.Policy) == 0 {
+		return fmt.Errorf("%w, certificate policy identifier is required", ErrEmptyValue)
+	}
+	for _, cps := range policy.CPSURIs {
+		if err := validateURL(cps); err != nil {
+			return err
+		}
+		if !isIA5String(cps) {
+			return fmt.Errorf("%w, certification practice statement must be ascii", ErrInvalidURI)
+		}
+	}
+	if notice := policy.UserNotice; notice != nil {
+		if notice.Organization == "" && notice.ExplicitText == "" {
+			return fmt.Errorf("%w, user notice requires a notice reference or explicit text", ErrEmptyValue)
+		}
+		if (notice.Organization == "") != (len(notice.NoticeNumbers) == 0) {
+			return fmt.Errorf("%w, user notice reference requires both an organization and notice numbers", ErrInvalidValue)
+		}
+		if len([]rune(notice.ExplicitText)) > 200 || len([]rune(notice.Organization)) > 200 {
+			return fmt.Errorf("%w, user notice text cannot exceed 200 characters", ErrInvalidValue)
+		}
+	}
+	return nil
+}
+
+func containsCertificatePolicy(policies []CertificatePolicy, policy asn1.ObjectIdentifier) bool {
+	for _, existing := range policies {
+		if existing.Policy.Equal(policy) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCertificatePolicies decodes a certificate policies extension including its qualifiers, an error is returned for
+// qualifiers other than CPS URIs and user notices
+func parseCertificatePolicies(value []byte) ([]CertificatePolicy, error) {
+	var information []policyInformation
+	if err := unmarshalExtension(value, &information); err != nil {
+		return nil, err
+	}
+	policies := make([]CertificatePolicy, 0, len(information))
+	for _, info := range information {
+		policy := CertificatePolicy{Policy: info.Policy}
+		for _, rawQualifier := range info.Qualifiers {
+			var qualifier policyQualifierInfo
+			if err := unmarshalExtension(rawQualifier.FullBytes, &qualifier); err != nil {
+				return nil, err
+			}
+			switch {
+			case qualifier.Id.Equal(oidPolicyQualifierCPS):
+				var cps string
+				if err := unmarshalExtension(qualifier.Qualifier.FullBytes, &cps); err != nil {
+					return nil, err
+				}
+				policy.CPSURIs = append(policy.CPSURIs, cps)
+			case qualifier.Id.Equal(oidPolicyQualifierUserNotice) && policy.UserNotice == nil:
+				notice, err := parseUserNotice(qualifier.Qualifier.FullBytes)
+				if err != nil {
+					return nil, err
+				}
+				policy.UserNotice = notice
+			default:
+				return nil, fmt.Errorf("unsupported policy qualifier %v", qualifier.Id)
+			}
+		}
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+func parseUserNotice(value []byte) (*UserNotice, error) {
+	var elements []asn1.RawValue
+	if err := unmarshalExtension(value, &elements); err != nil {
+		return nil, err
+	}
+	notice := &UserNotice{}
+	for _, element := range elements {
+		if element.Class == asn1.ClassUniversal && element.Tag == asn1.TagSequence {
+			var reference struct {
+				Organization  string
+				NoticeNumbers []int
+			}
+			if err := unmarshalExtension(element.FullBytes, &reference); err != nil {
+				return nil, err
+			}
+			notice.Organization = reference.Organization
+			notice.NoticeNumbers = reference.NoticeNumbers
+			continue
+		}
+		if err := unmarshalExtension(element.FullBytes, &notice.ExplicitText); err != nil {
+			return nil, err
+		}
+	}
+	return notice, nil
+}
+
+func marshalCertificatePoliciesExtension(policies []CertificatePolicy) (pkix.Extension, error) {
+	information := make([]policyInformation, 0, len(policies))
+	for _, policy := range policies {
+		// qualifiers stays nil when there are none, an empty policyQualifiers sequence is not permitted by RFC 5280
+		var qualifiers []asn1.RawValue
+		for _, cps := range policy.CPSURIs {
+			qualifier, err := marshalPolicyQualifier(oidPolicyQualifierCPS, cps, "ia5")
+			if err != nil {
+				return pkix.Extension{}, err
+			}
+			qualifiers = append(qualifiers, qualifier)
+		}
+		if policy.UserNotice != nil {
+			notice, err := marshalUserNotice(policy.UserNotice)
+			if err != nil {
+				return pkix.Extension{}, err
+			}
+			qualifier, err := marshalPolicyQualifier(oidPolicyQualifierUserNotice, notice, "")
+			if err != nil {
+				return pkix.Extension{}, err
+			}
+			qualifiers = append(qualifiers, qualifier)
+		}
+		information = append(information, policyInformation{Policy: policy.Policy, Qualifiers: qualifiers})
+	}
+	value, err := asn1.Marshal(information)
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+	return pkix.Extension{Id: oidExtensionCertificatePolicies, Value: value}, nil
+}
+
+func marshalPolicyQualifier(id asn1.ObjectIdentifier, qualifier interface{}, params string) (asn1.RawValue, error) {
+	value, err := asn1.MarshalWithParams(qualifier, params)
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	info, err := asn1.Marshal(policyQualifierInfo{Id: id, Qualifier: asn1.RawValue{FullBytes: value}})
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	return asn1.RawValue{FullBytes: info}, nil
+}
+
+// marshalUserNotice encodes notice as a UserNotice, the optional notice reference and explicit text are encoded as
+// UTF8String display text
+func marshalUserNotice(notice *UserNotice) (asn1.RawValue, error) {
+	elements := make([]asn1.RawValue, 0, 2)
+	if notice.Organization != "" {
+		organization, err := asn1.MarshalWithParams(notice.Organization, "utf8")
+		if err != nil {
+			return asn1.RawValue{}, err
+		}
+		numbers, err := asn1.Marshal(notice.NoticeNumbers)
+		if err != nil {
+			return asn1.RawValue{}, err
+		}
+		reference, err := asn1.Marshal([]asn1.RawValue{{FullBytes: organization}, {FullBytes: numbers}})
+		if err != nil {
+			return asn1.RawValue{}, err
+		}
+		elements = append(elements, asn1.RawValue{FullBytes: reference})
+	}
+	if notice.ExplicitText != "" {
+		text, err := asn1.MarshalWithParams(notice.ExplicitText, "utf8")
+		if err != nil {
+			return asn1.RawValue{}, err
+		}
+		elements = append(elements, asn1.RawValue{FullBytes: text})
+	}
+	value, err := asn1.Marshal(elements)
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	return asn1.RawValue{FullBytes: value}, nil
+}
+
+func marshalPolicyMappingsExtension(mappings []PolicyMapping) (pkix.Extension, error) {
+	value, err := asn1.Marshal(mappings)
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+	return pkix.Extension{Id: oidExtensionPolicyMappings, Critical: true, Value: value}, nil
+}
+
+// marshalPolicyConstraintsExtension encodes the critical policy constraints extension, negative values are omitted.
+// The fields are encoded by hand since encoding/asn1 treats an optional zero as absent
+func marshalPolicyConstraintsExtension(requireExplicitPolicy int, inhibitPolicyMapping int) (pkix.Extension, error) {
+	elements := make([]asn1.RawValue, 0, 2)
+	for tag, skipCerts := range []int{requireExplicitPolicy, inhibitPolicyMapping} {
+		if skipCerts < 0 {
+			continue
+		}
+		element, err := marshalImplicitInteger(tag, skipCerts)
+		if err != nil {
+			return pkix.Extension{}, err
+		}
+		elements = append(elements, element)
+	}
+	value, err := asn1.Marshal(elements)
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+	return pkix.Extension{Id: oidExtensionPolicyConstraints, Critical: true, Value: value}, nil
+}
+
+func marshalImplicitInteger(tag int, value int) (asn1.RawValue, error) {
+	encoded, err := asn1.Marshal(value)
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	var integer asn1.RawValue
+	if _, err := asn1.Unmarshal(encoded, &integer); err != nil {
+		return asn1.RawValue{}, err
+	}
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: tag, Bytes: integer.Bytes}, nil
+}
+
+func isIA5String(value string) bool {
+	for i := 0; i < len(value); i++ {
+		if value[i] > 0x7f {
+			return false
+		}
+	}
+	return true
+}
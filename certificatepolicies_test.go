@@ -0,0 +1,184 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"testing"
+)
+
+var (
+	testPolicyBridge = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 55555, 1, 1}
+	testPolicyTeam   = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 55555, 2, 1}
+	testPolicyOther  = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 55555, 3, 1}
+)
+
+// newTestPolicyChain builds root -> bridge CA (asserting and mapping testPolicyBridge to testPolicyTeam) -> team CA
+// -> leaf, returned in the order produced by x509.Certificate.Verify
+func newTestPolicyChain(t *testing.T) []*x509.Certificate {
+	t.Helper()
+	_, root, _ := newTestCertificateAuthorities(t)
+
+	bridgeCert, bridgeKey, err := NewCertificateBuilder().
+		WithCommonName("Bridge CA").
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithIsCertificateAuthority(true).
+		WithBasicConstraint().
+		WithCertificatePolicies(CertificatePolicy{
+			Policy:     testPolicyBridge,
+			CPSURIs:    []string{"https://pki.example.com/cps"},
+			UserNotice: &UserNotice{Organization: "Acme", NoticeNumbers: []int{1, 2}, ExplicitText: "Test use only"},
+		}).
+		WithPolicyMappings(PolicyMapping{IssuerDomainPolicy: testPolicyBridge, SubjectDomainPolicy: testPolicyTeam}).
+		WithRequireExplicitPolicy(0).
+		WithInhibitAnyPolicy(0).
+		BuildSignedCertificate(root.Certificate, root.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	teamCert, teamKey, err := NewCertificateBuilder().
+		WithCommonName("Team CA").
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithIsCertificateAuthority(true).
+		WithBasicConstraint().
+		WithCertificatePolicies(CertificatePolicy{Policy: testPolicyTeam}).
+		BuildSignedCertificate(bridgeCert, bridgeKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafCert, _, err := NewCertificateBuilder().
+		WithCommonName("leaf").
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithCertificatePolicies(CertificatePolicy{Policy: testPolicyTeam}).
+		BuildSignedCertificate(teamCert, teamKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return []*x509.Certificate{leafCert, teamCert, bridgeCert, root.Certificate}
+}
+
+func TestCertificateBuilder_WithCertificatePolicies_ShouldSetError_WhenPolicyIsDuplicated(t *testing.T) {
+	c := NewCertificateBuilder().
+		WithCertificatePolicies(CertificatePolicy{Policy: testPolicyTeam}, CertificatePolicy{Policy: testPolicyTeam})
+
+	if c.err == nil {
+		t.Fatal("error not set for duplicate policy")
+	}
+}
+
+func TestCertificateBuilder_WithPolicyMappings_ShouldSetError_WhenAnyPolicyIsMapped(t *testing.T) {
+	c := NewCertificateBuilder().
+		WithPolicyMappings(PolicyMapping{IssuerDomainPolicy: OIDAnyPolicy, SubjectDomainPolicy: testPolicyTeam})
+
+	if c.err == nil {
+		t.Fatal("error not set for mapping anyPolicy")
+	}
+}
+
+func TestCertificateBuilder_BuildSelfSignedCertificate_ShouldReturnError_WhenPolicyConstraintsAppliedToEndEntity(t *testing.T) {
+	_, _, err := NewCertificateBuilder().
+		WithCommonName("leaf").
+		WithInhibitAnyPolicy(0).
+		BuildSelfSignedCertificate()
+
+	if err == nil {
+		t.Fatal("expected an error for policy constraints on an end entity certificate")
+	}
+}
+
+func TestCertificateBuilder_BuildSignedCertificate_ShouldEncodePolicyExtensions_WhenConfigured(t *testing.T) {
+	chain := newTestPolicyChain(t)
+	bridge := chain[2]
+
+	if len(bridge.PolicyIdentifiers) != 1 || !bridge.PolicyIdentifiers[0].Equal(testPolicyBridge) {
+		t.Fatalf("unexpected policy identifiers %v", bridge.PolicyIdentifiers)
+	}
+	extensions, err := parseCertificatePolicyExtensions(bridge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(extensions.mappings) != 1 || !extensions.mappings[0].SubjectDomainPolicy.Equal(testPolicyTeam) {
+		t.Fatalf("unexpected policy mappings %v", extensions.mappings)
+	}
+	if extensions.requireExplicitPolicy != 0 || extensions.inhibitPolicyMapping != -1 || extensions.inhibitAnyPolicy != 0 {
+		t.Fatalf("unexpected policy constraints %+v", extensions)
+	}
+	for _, extension := range bridge.Extensions {
+		if extension.Id.Equal(oidExtensionPolicyConstraints) && !extension.Critical {
+			t.Fatal("policy constraints not critical")
+		}
+	}
+}
+
+func TestMarshalCertificatePoliciesExtension_ShouldOmitQualifiers_WhenPolicyHasNone(t *testing.T) {
+	extension, err := marshalCertificatePoliciesExtension([]CertificatePolicy{{Policy: asn1.ObjectIdentifier{1, 2, 3}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []byte{0x30, 0x06, 0x30, 0x04, 0x06, 0x02, 0x2a, 0x03}
+	if !bytes.Equal(extension.Value, expected) {
+		t.Fatalf("certificate policies %X do not match expected %X", extension.Value, expected)
+	}
+}
+
+func TestVerifyCertificatePolicies_ShouldReturnMappedPolicy_WhenInitialPolicyIsMapped(t *testing.T) {
+	chain := newTestPolicyChain(t)
+
+	result, err := VerifyCertificatePolicies(chain, CertificatePolicyOptions{InitialPolicies: []asn1.ObjectIdentifier{testPolicyBridge}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.AnyPolicy || len(result.Policies) != 1 || !result.Policies[0].Equal(testPolicyTeam) {
+		t.Fatalf("unexpected result %+v", result)
+	}
+}
+
+func TestVerifyCertificatePolicies_ShouldReturnError_WhenInitialPolicyIsNotAsserted(t *testing.T) {
+	chain := newTestPolicyChain(t)
+
+	if _, err := VerifyCertificatePolicies(chain, CertificatePolicyOptions{InitialPolicies: []asn1.ObjectIdentifier{testPolicyOther}}); err == nil {
+		t.Fatal("expected an error as the chain requires an explicit policy")
+	}
+}
+
+func TestVerifyCertificatePolicies_ShouldReturnError_WhenPolicyMappingIsInhibited(t *testing.T) {
+	chain := newTestPolicyChain(t)
+
+	if _, err := VerifyCertificatePolicies(chain, CertificatePolicyOptions{InhibitPolicyMapping: true}); err == nil {
+		t.Fatal("expected an error as the team policy is only reachable through a mapping")
+	}
+}
+
+func TestVerifyCertificatePolicies_ShouldReturnNoPolicies_WhenIntermediateAssertsNone(t *testing.T) {
+	_, root, intermediate := newTestCertificateAuthorities(t)
+	leaf, _, err := intermediate.Issue(NewCertificateBuilder().
+		WithCommonName("leaf").
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithCertificatePolicies(CertificatePolicy{Policy: OIDAnyPolicy}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := VerifyCertificatePolicies([]*x509.Certificate{leaf, intermediate.Certificate, root.Certificate}, CertificatePolicyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Policies) != 0 || result.AnyPolicy {
+		t.Fatalf("unexpected result %+v", result)
+	}
+}
@@ -0,0 +1,230 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io"
+)
+
+var oidChallengePassword = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 7}
+
+type certificateRequestInfo struct {
+	Raw           asn1.RawContent
+	Version       int
+	Subject       asn1.RawValue
+	PublicKey     asn1.RawValue
+	RawAttributes []asn1.RawValue `asn1:"tag:0"`
+}
+
+type certificateRequest struct {
+	CertificateRequestInfo asn1.RawValue
+	SignatureAlgorithm     pkix.AlgorithmIdentifier
+	SignatureValue         asn1.BitString
+}
+
+type attribute struct {
+	Type   asn1.ObjectIdentifier
+	Values []asn1.RawValue `asn1:"set"`
+}
+
+// WithChallengePassword sets the challenge password attribute included in certificate signing requests
+func (c *CertificateBuilder) WithChallengePassword(value string) *CertificateBuilder {
+	if len(value) == 0 {
+		c.addError("WithChallengePassword", value, ErrEmptyValue)
+	}
+	if c.err != nil {
+		return c
+	}
+	c.challengePassword = value
+	return c
+}
+
+// BuildCertificateRequest builds a PKCS#10 certificate signing request from the subject, subject alternative names and
+// extensions of the current configuration, signed by the generated or supplied key. The request is written with
+// WriteCertificateRequestFile or EncodeCertificateRequest
+func (c *CertificateBuilder) BuildCertificateRequest() (*x509.CertificateRequest, crypto.Signer, error) {
+	if c.err != nil {
+		return nil, nil, c.err
+	}
+
+	publicKey, key, err := c.resolveKey(true)
+	if err != nil {
+		return nil, nil, err
+	}
+	extensions, err := c.buildRequestedExtensions(publicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	subject, rawSubject, err := c.buildSubjectName()
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.CertificateRequest{
+		Subject:         subject,
+		RawSubject:      rawSubject,
+		DNSNames:        c.dnsNames,
+		IPAddresses:     c.ipAddresses,
+		EmailAddresses:  c.emailAddresses,
+		URIs:            c.uris,
+		ExtraExtensions: extensions,
+	}
+	if template.SignatureAlgorithm, err = c.resolveSignatureAlgorithm(key); err != nil {
+		return nil, nil, err
+	}
+	requestBytes, err := x509.CreateCertificateRequest(c.randomReader(), template, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if c.challengePassword != "" {
+		if requestBytes, err = addChallengePassword(requestBytes, c.challengePassword, c.randomReader(), key); err != nil {
+			return nil, nil, err
+		}
+	} else if isRSAPSS(template.SignatureAlgorithm) {
+		if requestBytes, err = resignCertificateRequest(requestBytes, c.randomReader(), key); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	request, err := x509.ParseCertificateRequest(requestBytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	return request, key, nil
+}
+
+// buildRequestedExtensions returns the extensions a certificate request asks the issuer to include, crypto/x509 only
+// encodes subject alternative names for requests so everything else is encoded here
+func (c *CertificateBuilder) buildRequestedExtensions(publicKey crypto.PublicKey) ([]pkix.Extension, error) {
+	publicKeyAlgorithm, err := publicKeyAlgorithmOf(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	extensions := make([]pkix.Extension, 0, 4+len(c.extensions))
+
+	keyUsage := c.keyUsage
+	if keyUsage == 0 {
+		keyUsage = defaultKeyUsage(publicKeyAlgorithm, c.isCertificateAuthority)
+	}
+	extension, err := marshalKeyUsageExtension(keyUsage)
+	if err != nil {
+		return nil, err
+	}
+	extensions = append(extensions, extension)
+
+	if len(c.enhancedKeyUsages) > 0 {
+		if extension, err = marshalExtKeyUsageExtension(c.enhancedKeyUsages); err != nil {
+			return nil, err
+		}
+		extensions = append(extensions, extension)
+	}
+	if c.includeBasicConstraint {
+		if extension, err = marshalBasicConstraintsExtension(c.isCertificateAuthority, c.maxPathLength); err != nil {
+			return nil, err
+		}
+		extensions = append(extensions, extension)
+	}
+	if c.includeSubjectKeyIdentifier || c.subjectKeyIdentifierCritical {
+		subjectKeyId, err := computeSubjectKeyIdentifier(publicKey, c.subjectKeyIdentifierMethod)
+		if err != nil {
+			return nil, err
+		}
+		value, err := asn1.Marshal(subjectKeyId)
+		if err != nil {
+			return nil, err
+		}
+		extensions = append(extensions, pkix.Extension{Id: oidExtensionSubjectKeyId, Critical: c.subjectKeyIdentifierCritical, Value: value})
+	}
+	return append(extensions, c.extensions...), nil
+}
+
+// addChallengePassword adds the PKCS#9 challenge password attribute to the certificate request encoded in der and
+// signs it again using key, crypto/x509 has no way to encode attributes other than extension requests
+func addChallengePassword(der []byte, password string, random io.Reader, key crypto.Signer) ([]byte, error) {
+	var request certificateRequest
+	if _, err := asn1.Unmarshal(der, &request); err != nil {
+		return nil, err
+	}
+	var info certificateRequestInfo
+	if _, err := asn1.Unmarshal(request.CertificateRequestInfo.FullBytes, &info); err != nil {
+		return nil, err
+	}
+	parsed, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, err
+	}
+
+	stringType := "printable"
+	if !isPrintableString(password) {
+		stringType = "utf8"
+	}
+	value, err := asn1.MarshalWithParams(password, stringType)
+	if err != nil {
+		return nil, err
+	}
+	rawAttribute, err := asn1.Marshal(attribute{Type: oidChallengePassword, Values: []asn1.RawValue{{FullBytes: value}}})
+	if err != nil {
+		return nil, err
+	}
+	info.Raw = nil
+	info.RawAttributes = append(info.RawAttributes, asn1.RawValue{FullBytes: rawAttribute})
+	infoBytes, err := asn1.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	return signCertificateRequestInfo(request, infoBytes, parsed.SignatureAlgorithm, random, key)
+}
+
+// resignCertificateRequest signs the certificate request encoded in der again using key. Before Go 1.21
+// x509.CreateCertificateRequest signs RSA-PSS requests with PKCS #1 v1.5 options, which produces a signature that does
+// not verify, so RSA-PSS requests are always signed here
+func resignCertificateRequest(der []byte, random io.Reader, key crypto.Signer) ([]byte, error) {
+	var request certificateRequest
+	if _, err := asn1.Unmarshal(der, &request); err != nil {
+		return nil, err
+	}
+	parsed, err := x509.ParseCertificateRequest(der)
+	if err != nil {
+		return nil, err
+	}
+	return signCertificateRequestInfo(request, request.CertificateRequestInfo.FullBytes, parsed.SignatureAlgorithm, random, key)
+}
+
+// signCertificateRequestInfo replaces the information and signature of request with infoBytes signed by key
+func signCertificateRequestInfo(request certificateRequest, infoBytes []byte, algorithm x509.SignatureAlgorithm, random io.Reader, key crypto.Signer) ([]byte, error) {
+	signature, err := signMessage(random, key, algorithm, infoBytes)
+	if err != nil {
+		return nil, err
+	}
+	request.CertificateRequestInfo = asn1.RawValue{FullBytes: infoBytes}
+	request.SignatureValue = asn1.BitString{Bytes: signature, BitLength: len(signature) * 8}
+	return asn1.Marshal(request)
+}
+
+// isPrintableString reports whether value only contains characters permitted in an ASN.1 PrintableString
+func isPrintableString(value string) bool {
+	for _, r := range value {
+		switch {
+		case 'a' <= r && r <= 'z', 'A' <= r && r <= 'Z', '0' <= r && r <= '9':
+		case r == ' ', r == '\'', r == '(', r == ')', r == '+', r == ',', r == '-', r == '.', r == '/', r == ':', r == '=', r == '?':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,137 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCertificateBuilder_BuildCertificateRequest_ShouldIncludeSubjectAndRequestedExtensions(t *testing.T) {
+	request, key, err := NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithCommonName("api.acme.example").
+		WithOrganization("Acme.").
+		WithDnsNames("api.acme.example").
+		WithKeyUsage(x509.KeyUsageDigitalSignature).
+		WithEnhancedKeyUsage(x509.ExtKeyUsageServerAuth).
+		WithBasicConstraint().
+		BuildCertificateRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if key == nil {
+		t.Fatal("request key was not returned")
+	}
+	if err := request.CheckSignature(); err != nil {
+		t.Fatal(err)
+	}
+	if request.Subject.CommonName != "api.acme.example" {
+		t.Fatalf("common name %v does not match expected value api.acme.example", request.Subject.CommonName)
+	}
+	if len(request.DNSNames) != 1 || request.DNSNames[0] != "api.acme.example" {
+		t.Fatalf("dns names %v do not match expected value", request.DNSNames)
+	}
+	for _, oid := range []asn1.ObjectIdentifier{oidExtensionKeyUsage, oidExtensionExtendedKeyUsage, oidExtensionBasicConstraints} {
+		if !hasExtension(request.Extensions, oid) {
+			t.Fatalf("requested extension %v was not included", oid)
+		}
+	}
+}
+
+func TestCertificateBuilder_BuildCertificateRequest_ShouldIncludeChallengePassword_WhenSet(t *testing.T) {
+	request, _, err := NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithCommonName("api.acme.example").
+		WithDnsNames("api.acme.example").
+		WithChallengePassword("open sesame").
+		BuildCertificateRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := request.CheckSignature(); err != nil {
+		t.Fatal(err)
+	}
+	if len(request.DNSNames) != 1 {
+		t.Fatal("extension request was lost when adding the challenge password")
+	}
+	var info certificateRequestInfo
+	if _, err := asn1.Unmarshal(request.RawTBSCertificateRequest, &info); err != nil {
+		t.Fatal(err)
+	}
+	for _, raw := range info.RawAttributes {
+		var actual attribute
+		if _, err := asn1.Unmarshal(raw.FullBytes, &actual); err != nil {
+			t.Fatal(err)
+		}
+		if actual.Type.Equal(oidChallengePassword) {
+			var password string
+			if _, err := asn1.Unmarshal(actual.Values[0].FullBytes, &password); err != nil {
+				t.Fatal(err)
+			}
+			if password != "open sesame" {
+				t.Fatalf("challenge password %v does not match expected value", password)
+			}
+			return
+		}
+	}
+	t.Fatal("challenge password attribute was not included")
+}
+
+func TestCertificateBuilder_WithChallengePassword_ShouldSetError_WhenValueIsEmpty(t *testing.T) {
+	c := NewCertificateBuilder()
+	c.WithChallengePassword("")
+	if c.err == nil {
+		t.Fatal("error was not set when challenge password was set to empty string")
+	}
+}
+
+func TestWriteCertificateRequestFile_ShouldWritePemCertificateRequest(t *testing.T) {
+	request, _, err := NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithCommonName("api.acme.example").
+		BuildCertificateRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filename := filepath.Join(t.TempDir(), "request.csr")
+	if err := WriteCertificateRequestFile(filename, request); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE REQUEST" {
+		t.Fatal("file does not contain a PEM certificate request")
+	}
+}
+
+func hasExtension(extensions []pkix.Extension, oid asn1.ObjectIdentifier) bool {
+	for _, extension := range extensions {
+		if extension.Id.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,237 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"time"
+)
+
+var (
+	oidExtensionSubjectAltName         = asn1.ObjectIdentifier{2, 5, 29, 17}
+	oidExtensionAuthorityKeyIdentifier = asn1.ObjectIdentifier{2, 5, 29, 35}
+)
+
+// CertificateRequestPolicy controls which parts of a certificate signing request are honoured when it is signed, the
+// zero value honours the requested subject and names but grants no extended key usages, certificate authority or
+// additional extensions
+type CertificateRequestPolicy struct {
+	// KeyUsage replaces the requested key usage when non-zero. Certificate and CRL signing are removed from the key
+	// usage of certificates which are not certificate authorities
+	KeyUsage x509.KeyUsage
+	// ExtKeyUsages replaces the requested extended key usages when non-nil
+	ExtKeyUsages []x509.ExtKeyUsage
+	// AllowedExtKeyUsages lists the requested extended key usages which are granted when ExtKeyUsages is nil, all others
+	// including x509.ExtKeyUsageAny are dropped unless listed
+	AllowedExtKeyUsages []x509.ExtKeyUsage
+	// MaxValidity caps the lifetime of the issued certificate when non-zero
+	MaxValidity time.Duration
+	// AllowCertificateAuthority honours requests for a certificate authority, otherwise the request is issued an end
+	// entity certificate
+	AllowCertificateAuthority bool
+	// AllowedExtensions lists the requested extensions, other than key usage, extended key usage, basic constraints and
+	// subject alternative names, that are copied to the certificate, all others are dropped
+	AllowedExtensions []asn1.ObjectIdentifier
+	// Customize, when set, is called last and may make any further changes to builder
+	Customize func(request *x509.CertificateRequest, builder *CertificateBuilder) error
+}
+
+// ParseCertificateRequestPEM decodes the first PEM encoded certificate signing request in data and verifies its
+// proof-of-possession signature
+func ParseCertificateRequestPEM(data []byte) (*x509.CertificateRequest, error) {
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("no PEM certificate request found")
+		}
+		if block.Type != "CERTIFICATE REQUEST" && block.Type != "NEW CERTIFICATE REQUEST" {
+			continue
+		}
+
+		request, err := x509.ParseCertificateRequest(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if err := request.CheckSignature(); err != nil {
+			return nil, fmt.Errorf("certificate request signature is not valid: %w", err)
+		}
+		return request, nil
+	}
+}
+
+// NewCertificateBuilderFromCertificateRequest verifies request then creates a certificate builder for its public key
+// seeded with its subject, subject alternative names and requested extensions
+func NewCertificateBuilderFromCertificateRequest(request *x509.CertificateRequest) (*CertificateBuilder, error) {
+	if request == nil {
+		return nil, fmt.Errorf("invalid argument, certificate request cannot be nil")
+	}
+	if err := request.CheckSignature(); err != nil {
+		return nil, fmt.Errorf("certificate request signature is not valid: %w", err)
+	}
+
+	subject, err := unmarshalSubject(request.RawSubject)
+	if err != nil {
+		return nil, fmt.Errorf("certificate request subject is not valid: %w", err)
+	}
+	builder := NewCertificateBuilder().
+		WithPublicKey(request.PublicKey)
+	if err := applySubjectName(builder, subject); err != nil {
+		return nil, fmt.Errorf("certificate request subject cannot be copied: %w", err)
+	}
+	if len(request.DNSNames) > 0 {
+		builder.WithDnsNames(request.DNSNames...)
+	}
+	if len(request.IPAddresses) > 0 {
+		builder.WithIPAddresses(request.IPAddresses...)
+	}
+	if len(request.EmailAddresses) > 0 {
+		builder.WithEmailAddresses(request.EmailAddresses...)
+	}
+	if len(request.URIs) > 0 {
+		builder.WithURIs(request.URIs...)
+	}
+	if err := applyRequestedExtensions(builder, request.Extensions); err != nil {
+		return nil, err
+	}
+	if err := builder.GetError(); err != nil {
+		return nil, err
+	}
+	return builder, nil
+}
+
+// SignCertificateRequest verifies request and issues a certificate for it signed by issuer, with the requested
+// contents adjusted by policy. A nil policy uses the defaults of a zero CertificateRequestPolicy
+func SignCertificateRequest(request *x509.CertificateRequest, issuer *CertificateAuthority, policy *CertificateRequestPolicy) (*x509.Certificate, error) {
+	builder, err := NewCertificateBuilderFromCertificateRequest(request)
+	if err != nil {
+		return nil, err
+	}
+	if policy == nil {
+		policy = &CertificateRequestPolicy{}
+	}
+	if err := policy.apply(request, builder); err != nil {
+		return nil, err
+	}
+
+	cert, _, err := issuer.Issue(builder)
+	return cert, err
+}
+
+func (p *CertificateRequestPolicy) apply(request *x509.CertificateRequest, builder *CertificateBuilder) error {
+	if !p.AllowCertificateAuthority {
+		builder.isCertificateAuthority = false
+		builder.maxPathLength = -1
+	}
+	if p.KeyUsage != 0 {
+		builder.keyUsage = p.KeyUsage
+	}
+	if !builder.isCertificateAuthority {
+		builder.keyUsage &^= x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	}
+	if p.ExtKeyUsages != nil {
+		builder.enhancedKeyUsages = append(make([]x509.ExtKeyUsage, 0, len(p.ExtKeyUsages)), p.ExtKeyUsages...)
+	} else {
+		usages := make([]x509.ExtKeyUsage, 0, len(builder.enhancedKeyUsages))
+		for _, usage := range builder.enhancedKeyUsages {
+			if containsExtKeyUsage(p.AllowedExtKeyUsages, usage) {
+				usages = append(usages, usage)
+			}
+		}
+		builder.enhancedKeyUsages = usages
+	}
+
+	extensions := make([]pkix.Extension, 0, len(builder.extensions))
+	for _, extension := range builder.extensions {
+		if containsOID(p.AllowedExtensions, extension.Id) {
+			extensions = append(extensions, extension)
+		}
+	}
+	builder.extensions = extensions
+
+	if p.MaxValidity > 0 {
+		notBefore, notAfter := builder.getNotBeforeAfterPair()
+		if notAfter.Sub(notBefore) > p.MaxValidity {
+			builder.WithNotBefore(notBefore).WithNotAfter(notBefore.Add(p.MaxValidity))
+		}
+	}
+
+	if p.Customize != nil {
+		if err := p.Customize(request, builder); err != nil {
+			return err
+		}
+	}
+	return builder.GetError()
+}
+
+// applyRequestedExtensions configures builder from requested extensions, subject alternative names are skipped as
+// crypto/x509 has already parsed them, key identifiers are skipped as they are computed by the issuer and extended key
+// usages unknown to crypto/x509 are dropped
+func applyRequestedExtensions(builder *CertificateBuilder, extensions []pkix.Extension) error {
+	for _, extension := range extensions {
+		switch {
+		case extension.Id.Equal(oidExtensionSubjectAltName),
+			extension.Id.Equal(oidExtensionSubjectKeyId),
+			extension.Id.Equal(oidExtensionAuthorityKeyIdentifier):
+			continue
+		case extension.Id.Equal(oidExtensionKeyUsage):
+			usage, err := parseKeyUsageExtension(extension.Value)
+			if err != nil {
+				return fmt.Errorf("invalid requested key usage: %w", err)
+			}
+			builder.WithKeyUsage(usage)
+		case extension.Id.Equal(oidExtensionExtendedKeyUsage):
+			usages, _, err := parseExtKeyUsageExtension(extension.Value)
+			if err != nil {
+				return fmt.Errorf("invalid requested extended key usage: %w", err)
+			}
+			builder.WithEnhancedKeyUsage(usages...)
+		case extension.Id.Equal(oidExtensionBasicConstraints):
+			constraints, err := parseBasicConstraintsExtension(extension.Value)
+			if err != nil {
+				return fmt.Errorf("invalid requested basic constraints: %w", err)
+			}
+			builder.WithBasicConstraint().
+				WithIsCertificateAuthority(constraints.IsCA)
+			if constraints.IsCA && constraints.MaxPathLen >= 0 {
+				builder.WithMaxPathLength(constraints.MaxPathLen)
+			}
+		default:
+			builder.WithExtensions(extension)
+		}
+	}
+	return nil
+}
+
+func containsExtKeyUsage(usages []x509.ExtKeyUsage, usage x509.ExtKeyUsage) bool {
+	for _, candidate := range usages {
+		if candidate == usage {
+			return true
+		}
+	}
+	return false
+}
+
+func containsOID(oids []asn1.ObjectIdentifier, oid asn1.ObjectIdentifier) bool {
+	for _, candidate := range oids {
+		if candidate.Equal(oid) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,214 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestCertificateRequestPEM(t *testing.T, builder *CertificateBuilder) []byte {
+	t.Helper()
+	request, _, err := builder.BuildCertificateRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: request.Raw})
+}
+
+func TestParseCertificateRequestPEM_ShouldReturnError_WhenSignatureIsInvalid(t *testing.T) {
+	request, _, err := NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithCommonName("api.acme.example").
+		BuildCertificateRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := append([]byte{}, request.Raw...)
+	tampered[len(tampered)-1] ^= 0xff
+
+	if _, err := ParseCertificateRequestPEM(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: tampered})); err == nil {
+		t.Fatal("error was not returned for a request with an invalid signature")
+	}
+}
+
+func TestParseCertificateRequestPEM_ShouldWrapVerificationError_WhenSignatureIsInvalid(t *testing.T) {
+	request, _, err := NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmRSA2048).
+		WithCommonName("api.acme.example").
+		BuildCertificateRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := append([]byte{}, request.Raw...)
+	tampered[len(tampered)-1] ^= 0xff
+
+	_, err = ParseCertificateRequestPEM(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: tampered}))
+
+	if !errors.Is(err, rsa.ErrVerification) {
+		t.Fatalf("expected rsa.ErrVerification but found %v", err)
+	}
+}
+
+func TestSignCertificateRequest_ShouldIssueCertificateForRequestedSubjectAndNames(t *testing.T) {
+	_, root, intermediate := newTestCertificateAuthorities(t)
+	data := newTestCertificateRequestPEM(t, NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithCommonName("api.acme.example").
+		WithOrganization("Acme.").
+		WithDnsNames("api.acme.example").
+		WithEnhancedKeyUsage(x509.ExtKeyUsageServerAuth))
+
+	request, err := ParseCertificateRequestPEM(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := SignCertificateRequest(request, intermediate, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	verifyChain(t, root, intermediate, cert, x509.VerifyOptions{DNSName: "api.acme.example"})
+	if cert.Subject.CommonName != "api.acme.example" || len(cert.Subject.Organization) != 1 {
+		t.Fatalf("subject %v does not match the requested subject", cert.Subject)
+	}
+	if !publicKeysEqual(cert.PublicKey, request.PublicKey) {
+		t.Fatal("certificate public key does not match the requested key")
+	}
+}
+
+func TestSignCertificateRequest_ShouldApplyPolicy(t *testing.T) {
+	_, _, intermediate := newTestCertificateAuthorities(t)
+	customOID := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 55555, 1}
+	droppedOID := asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 55555, 2}
+	request, err := ParseCertificateRequestPEM(newTestCertificateRequestPEM(t, NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithCommonName("rogue.acme.example").
+		WithIsCertificateAuthority(true).
+		WithBasicConstraint().
+		WithEnhancedKeyUsage(x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageCodeSigning).
+		WithExtensions(
+			pkix.Extension{Id: customOID, Value: []byte{0x05, 0x00}},
+			pkix.Extension{Id: droppedOID, Value: []byte{0x05, 0x00}})))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := &CertificateRequestPolicy{
+		ExtKeyUsages:      []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		MaxValidity:       24 * time.Hour,
+		AllowedExtensions: []asn1.ObjectIdentifier{customOID},
+	}
+	cert, err := SignCertificateRequest(request, intermediate, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cert.IsCA {
+		t.Fatal("certificate authority request was honoured")
+	}
+	if len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageClientAuth {
+		t.Fatalf("extended key usages %v were not replaced by the policy", cert.ExtKeyUsage)
+	}
+	if cert.NotAfter.Sub(cert.NotBefore) > 24*time.Hour {
+		t.Fatalf("validity %v was not capped by the policy", cert.NotAfter.Sub(cert.NotBefore))
+	}
+	if !hasExtension(cert.Extensions, customOID) {
+		t.Fatal("allowed extension was not copied to the certificate")
+	}
+	if hasExtension(cert.Extensions, droppedOID) {
+		t.Fatal("extension not allowed by the policy was copied to the certificate")
+	}
+}
+
+func TestSignCertificateRequest_ShouldRestrictRequestedUsages_WhenPolicyIsNil(t *testing.T) {
+	_, _, intermediate := newTestCertificateAuthorities(t)
+	request, err := ParseCertificateRequestPEM(newTestCertificateRequestPEM(t, NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithCommonName("rogue.acme.example").
+		WithKeyUsage(x509.KeyUsageDigitalSignature|x509.KeyUsageCertSign|x509.KeyUsageCRLSign).
+		WithEnhancedKeyUsage(x509.ExtKeyUsageAny, x509.ExtKeyUsageCodeSigning)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := SignCertificateRequest(request, intermediate, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cert.KeyUsage&(x509.KeyUsageCertSign|x509.KeyUsageCRLSign) != 0 {
+		t.Fatalf("key usage %v of an end entity certificate includes certificate or CRL signing", cert.KeyUsage)
+	}
+	if cert.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+		t.Fatal("requested digital signature key usage was not honoured")
+	}
+	if len(cert.ExtKeyUsage) != 0 {
+		t.Fatalf("extended key usages %v were granted without being allowed", cert.ExtKeyUsage)
+	}
+}
+
+func TestSignCertificateRequest_ShouldGrantAllowedExtKeyUsages(t *testing.T) {
+	_, _, intermediate := newTestCertificateAuthorities(t)
+	request, err := ParseCertificateRequestPEM(newTestCertificateRequestPEM(t, NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithCommonName("api.acme.example").
+		WithEnhancedKeyUsage(x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageCodeSigning)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := &CertificateRequestPolicy{
+		AllowedExtKeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	cert, err := SignCertificateRequest(request, intermediate, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cert.ExtKeyUsage) != 1 || cert.ExtKeyUsage[0] != x509.ExtKeyUsageServerAuth {
+		t.Fatalf("extended key usages %v are not limited to the allowed requested usages", cert.ExtKeyUsage)
+	}
+}
+
+func TestSignCertificateRequest_ShouldCallCustomize(t *testing.T) {
+	_, _, intermediate := newTestCertificateAuthorities(t)
+	request, err := ParseCertificateRequestPEM(newTestCertificateRequestPEM(t, NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithCommonName("api.acme.example")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	policy := &CertificateRequestPolicy{
+		Customize: func(request *x509.CertificateRequest, builder *CertificateBuilder) error {
+			builder.WithOrganizationUnit("Anvils")
+			return nil
+		},
+	}
+	cert, err := SignCertificateRequest(request, intermediate, policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cert.Subject.OrganizationalUnit) != 1 || cert.Subject.OrganizationalUnit[0] != "Anvils" {
+		t.Fatalf("organization unit %v was not set by the policy", cert.Subject.OrganizationalUnit)
+	}
+}
@@ -15,56 +15,321 @@ package x509certificates
 
 import (
 	"bytes"
+	"crypto"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/pem"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
-	"software.sslmate.com/src/go-pkcs12"
+	"path/filepath"
 )
 
+// ExportFormat selects how WriteFile and Encode write a certificate and its key. Certificate requests have no export
+// format, they are written with WriteCertificateRequestFile or EncodeCertificateRequest
 type ExportFormat int32
 
 const (
 	ExportFormatPemPublicKey ExportFormat = iota
 	ExportFormatPemPrivateKey
 	ExportFormatPFX
+	// ExportFormatPemPKCS8PrivateKey writes the key as an unencrypted PKCS#8 "PRIVATE KEY", supporting every key type
+	ExportFormatPemPKCS8PrivateKey
+	// ExportFormatPemECPrivateKey writes an ECDSA key as a SEC 1 "EC PRIVATE KEY"
+	ExportFormatPemECPrivateKey
+	// ExportFormatPemEncryptedPKCS8PrivateKey writes the key as a PKCS#8 "ENCRYPTED PRIVATE KEY" encrypted with the
+	// password using PBES2 and AES-256-CBC
+	ExportFormatPemEncryptedPKCS8PrivateKey
+	// ExportFormatPFXTrustStore writes the certificate and any chain as a PFX without a private key, each certificate
+	// trusted for any purpose as Java expects of a trust store
+	ExportFormatPFXTrustStore
+	// ExportFormatDER writes the certificate as raw DER, as used by .cer and .der files
+	ExportFormatDER
+	// ExportFormatPemBundle writes the certificate followed by its chain as PEM certificates
+	ExportFormatPemBundle
+	// ExportFormatPemCombined writes the certificate, its chain and the key as an unencrypted PKCS#8 "PRIVATE KEY" in
+	// a single PEM file
+	ExportFormatPemCombined
 )
 
-func WriteFile(filename string, encoding ExportFormat, certificate *x509.Certificate, key *rsa.PrivateKey, password string) error {
+// containsPrivateKey reports whether the encoding includes private key material
+func (e ExportFormat) containsPrivateKey() bool {
+	switch e {
+	case ExportFormatPemPrivateKey, ExportFormatPFX, ExportFormatPemPKCS8PrivateKey, ExportFormatPemECPrivateKey,
+		ExportFormatPemEncryptedPKCS8PrivateKey, ExportFormatPemCombined:
+		return true
+	default:
+		return false
+	}
+}
+
+// WriteOption configures how WriteFile encodes and writes its output
+type WriteOption func(*writeOptions)
+
+type writeOptions struct {
+	random              io.Reader
+	keyFileMode         os.FileMode
+	certificateFileMode os.FileMode
+	noClobber           bool
+	keyDerivation       KeyDerivationFunction
+	pfxProfile          PfxProfile
+	chain               []*x509.Certificate
+	friendlyName        string
+	localKeyID          []byte
+}
+
+const (
+	defaultKeyFileMode         os.FileMode = 0600
+	defaultCertificateFileMode os.FileMode = 0644
+)
+
+// WriteWithRandom sets the source of randomness for the salts and initialization vectors of PFX files and encrypted
+// private keys, by default crypto/rand. A seeded source produces byte-identical files
+func WriteWithRandom(value io.Reader) WriteOption {
+	return func(o *writeOptions) {
+		o.random = value
+	}
+}
+
+// WriteWithKeyDerivationFunction selects how the key encrypting an ExportFormatPemEncryptedPKCS8PrivateKey is derived
+// from the password, by default KeyDerivationPBKDF2
+func WriteWithKeyDerivationFunction(value KeyDerivationFunction) WriteOption {
+	return func(o *writeOptions) {
+		o.keyDerivation = value
+	}
+}
+
+// WriteWithPfxProfile selects the algorithms protecting PFX files, by default PfxProfileLegacyRC2
+func WriteWithPfxProfile(value PfxProfile) WriteOption {
+	return func(o *writeOptions) {
+		o.pfxProfile = value
+	}
+}
+
+// WriteWithChain includes the issuing certificates in PFX files, PEM bundles and combined PEM files. The chain must be
+// ordered from the issuer of the certificate towards the root, each certificate signed by the next, and the self-signed
+// root may be omitted. Trust stores hold the certificates in the order given without validating them as a chain
+func WriteWithChain(values ...*x509.Certificate) WriteOption {
+	return func(o *writeOptions) {
+		o.chain = values
+	}
+}
+
+// WriteWithFriendlyName sets the friendly name, or alias, of the certificate and key in PFX files and of the certificate
+// in PFX trust stores, where it defaults to the subject. PFX files with a key only support it with PfxProfileLegacyDES
+// and PfxProfileModern
+func WriteWithFriendlyName(value string) WriteOption {
+	return func(o *writeOptions) {
+		o.friendlyName = value
+	}
+}
+
+// WriteWithLocalKeyID sets the local key ID pairing the certificate with its key in PFX files, by default the SHA-1
+// hash of the certificate. It is only supported with PfxProfileLegacyDES and PfxProfileModern
+func WriteWithLocalKeyID(value []byte) WriteOption {
+	return func(o *writeOptions) {
+		o.localKeyID = value
+	}
+}
+
+// WriteWithKeyFileMode sets the permissions of files containing a private key, by default 0600
+func WriteWithKeyFileMode(value os.FileMode) WriteOption {
+	return func(o *writeOptions) {
+		o.keyFileMode = value
+	}
+}
+
+// WriteWithCertificateFileMode sets the permissions of files containing only certificates or certificate requests, by
+// default 0644
+func WriteWithCertificateFileMode(value os.FileMode) WriteOption {
+	return func(o *writeOptions) {
+		o.certificateFileMode = value
+	}
+}
+
+// WriteWithNoClobber refuses to replace an existing file, the returned error satisfies errors.Is(err, fs.ErrExist)
+func WriteWithNoClobber() WriteOption {
+	return func(o *writeOptions) {
+		o.noClobber = true
+	}
+}
+
+func (o *writeOptions) pfxContents(certificate *x509.Certificate, key crypto.Signer) pfxContents {
+	return pfxContents{
+		key:          key,
+		certificate:  certificate,
+		chain:        o.chain,
+		friendlyName: o.friendlyName,
+		localKeyID:   o.localKeyID,
+	}
+}
+
+func newWriteOptions(options []WriteOption) *writeOptions {
+	result := &writeOptions{
+		random:              rand.Reader,
+		keyFileMode:         defaultKeyFileMode,
+		certificateFileMode: defaultCertificateFileMode,
+	}
+	for _, option := range options {
+		option(result)
+	}
+	if result.random == nil {
+		result.random = rand.Reader
+	}
+	return result
+}
+
+// WriteFile writes certificate or key to filename in the encoding format, see Encode. The file is replaced atomically
+// and is only readable by its owner when it contains a private key. Certificate requests are written with
+// WriteCertificateRequestFile
+func WriteFile(filename string, encoding ExportFormat, certificate *x509.Certificate, key crypto.Signer, password string, options ...WriteOption) error {
+	data, err := EncodeToBytes(encoding, certificate, key, password, options...)
+	if err != nil {
+		return err
+	}
+	settings := newWriteOptions(options)
+	mode := settings.certificateFileMode
+	if encoding.containsPrivateKey() {
+		mode = settings.keyFileMode
+	}
+	return writeFileAtomically(filename, data, mode, settings.noClobber)
+}
+
+// Encode writes certificate or key to w in the encoding format. ExportFormatPemPublicKey and ExportFormatDER write the
+// certificate, the private key formats the key, ExportFormatPFX and ExportFormatPemCombined both and
+// ExportFormatPFXTrustStore and ExportFormatPemBundle the certificate and its chain. password protects PFX files and
+// encrypted private keys and is ignored by the other formats. Certificate requests are written with
+// EncodeCertificateRequest
+func Encode(w io.Writer, encoding ExportFormat, certificate *x509.Certificate, key crypto.Signer, password string, options ...WriteOption) error {
+	settings := newWriteOptions(options)
 	switch encoding {
 	case ExportFormatPemPublicKey:
-		return writePublicPemFile(filename, certificate)
+		return encodePublicPem(w, certificate)
 	case ExportFormatPemPrivateKey:
-		return writePrivatePemFile(filename, key)
+		return encodePrivatePem(w, key)
 	case ExportFormatPFX:
-		return writePfxFile(filename, certificate, key, password)
+		if err := validateChain(certificate, settings.chain); err != nil {
+			return err
+		}
+		return encodePfx(w, settings.pfxContents(certificate, key), password, settings.pfxProfile, settings.random)
+	case ExportFormatPFXTrustStore:
+		return encodePfxTrustStore(w, settings.pfxContents(certificate, nil), password, settings.pfxProfile, settings.random)
+	case ExportFormatPemPKCS8PrivateKey:
+		return encodePKCS8PrivatePem(w, key)
+	case ExportFormatPemECPrivateKey:
+		return encodeECPrivatePem(w, key)
+	case ExportFormatPemEncryptedPKCS8PrivateKey:
+		return encodeEncryptedPKCS8PrivatePem(w, key, password, settings.keyDerivation, settings.random)
+	case ExportFormatDER:
+		return encodeDer(w, certificate)
+	case ExportFormatPemBundle:
+		return encodePemBundle(w, certificate, settings.chain)
+	case ExportFormatPemCombined:
+		return encodePemCombined(w, certificate, settings.chain, key)
 	default:
 		return fmt.Errorf("unsupported encoding")
 	}
 }
 
-func writePublicPemFile(filename string, cert *x509.Certificate) error {
-	return writePemFile(filename, "CERTIFICATE", cert.Raw)
-}
-func writePrivatePemFile(filename string, key *rsa.PrivateKey) error {
-	rawData := x509.MarshalPKCS1PrivateKey(key)
-	return writePemFile(filename, "RSA PRIVATE KEY", rawData)
+// EncodeToBytes returns certificate or key in the encoding format, see Encode
+func EncodeToBytes(encoding ExportFormat, certificate *x509.Certificate, key crypto.Signer, password string, options ...WriteOption) ([]byte, error) {
+	buffer := bytes.Buffer{}
+	if err := Encode(&buffer, encoding, certificate, key, password, options...); err != nil {
+		return nil, err
+	}
+	return buffer.Bytes(), nil
 }
 
-func writePemFile(filename string, label string, rawData []byte) error {
+// WriteCertificateRequestFile writes request to filename as a PEM "CERTIFICATE REQUEST", the counterpart of WriteFile
+// for requests built by BuildCertificateRequest
+func WriteCertificateRequestFile(filename string, request *x509.CertificateRequest, options ...WriteOption) error {
 	buffer := bytes.Buffer{}
-	if err := pem.Encode(&buffer, &pem.Block{Type: label, Bytes: rawData}); err != nil {
+	if err := EncodeCertificateRequest(&buffer, request); err != nil {
 		return err
 	}
-	return os.WriteFile(filename, buffer.Bytes(), 0644)
+	settings := newWriteOptions(options)
+	return writeFileAtomically(filename, buffer.Bytes(), settings.certificateFileMode, settings.noClobber)
+}
+
+// EncodeCertificateRequest writes request to w as a PEM "CERTIFICATE REQUEST"
+func EncodeCertificateRequest(w io.Writer, request *x509.CertificateRequest) error {
+	if request == nil {
+		return fmt.Errorf("invalid argument, certificate request cannot be nil")
+	}
+	return pem.Encode(w, &pem.Block{Type: "CERTIFICATE REQUEST", Bytes: request.Raw})
+}
+
+func encodePublicPem(w io.Writer, cert *x509.Certificate) error {
+	if cert == nil {
+		return fmt.Errorf("invalid argument, certificate cannot be nil")
+	}
+	return pem.Encode(w, &pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
 }
 
-func writePfxFile(filename string, cert *x509.Certificate, key *rsa.PrivateKey, password string) error {
-	pfxBytes, err := pkcs12.Encode(rand.Reader, key, cert, []*x509.Certificate{}, password)
+func encodeDer(w io.Writer, cert *x509.Certificate) error {
+	if cert == nil {
+		return fmt.Errorf("invalid argument, certificate cannot be nil")
+	}
+	_, err := w.Write(cert.Raw)
+	return err
+}
+
+func encodePrivatePem(w io.Writer, key crypto.Signer) error {
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return fmt.Errorf("unsupported key type %T, only RSA keys can be written as PEM private keys, use ExportFormatPemPKCS8PrivateKey for other keys", key)
+	}
+	return pem.Encode(w, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+}
+
+// writeFileAtomically writes data to a temporary file in the same directory as filename, syncs it and then renames it
+// over filename so readers never see a partially written file. When noClobber is set the temporary file is linked to
+// filename instead, which fails if filename already exists
+func writeFileAtomically(filename string, data []byte, mode os.FileMode, noClobber bool) error {
+	directory := filepath.Dir(filename)
+	file, err := os.CreateTemp(directory, "."+filepath.Base(filename)+".*.tmp")
 	if err != nil {
 		return err
 	}
-	return os.WriteFile(filename, pfxBytes, 0644)
+	defer os.Remove(file.Name())
+	if err := file.Chmod(mode); err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	if noClobber {
+		if err := os.Link(file.Name(), filename); err != nil {
+			if errors.Is(err, fs.ErrExist) {
+				return fmt.Errorf("refusing to overwrite %s: %w", filename, fs.ErrExist)
+			}
+			return err
+		}
+	} else if err := os.Rename(file.Name(), filename); err != nil {
+		return err
+	}
+	syncDirectory(directory)
+	return nil
+}
+
+// syncDirectory flushes the rename of a file in directory to disk, this is best effort as not every platform supports
+// syncing a directory
+func syncDirectory(directory string) {
+	if d, err := os.Open(directory); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
 }
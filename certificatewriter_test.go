@@ -0,0 +1,237 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"software.sslmate.com/src/go-pkcs12"
+	"testing"
+)
+
+func newTestWriterCertificate(t *testing.T) (*x509.Certificate, *rsa.PrivateKey) {
+	t.Helper()
+	cert, key, err := NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmRSA2048).
+		WithCommonName("localhost").
+		BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key.(*rsa.PrivateKey)
+}
+
+func TestEncodeToBytes_ShouldEncodeCertificateAndKeyAsPem(t *testing.T) {
+	cert, key := newTestWriterCertificate(t)
+
+	data, err := EncodeToBytes(ExportFormatPemPublicKey, cert, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" || !bytes.Equal(block.Bytes, cert.Raw) {
+		t.Fatal("encoded certificate does not match the certificate")
+	}
+
+	data, err = EncodeToBytes(ExportFormatPemPrivateKey, nil, key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ = pem.Decode(data)
+	if block == nil || block.Type != "RSA PRIVATE KEY" {
+		t.Fatal("encoded key is not an RSA private key")
+	}
+	decoded, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Equal(key) {
+		t.Fatal("encoded key does not match the key")
+	}
+}
+
+func TestEncode_ShouldWritePfxToWriter(t *testing.T) {
+	cert, key := newTestWriterCertificate(t)
+
+	buffer := bytes.Buffer{}
+	if err := Encode(&buffer, ExportFormatPFX, cert, key, "password"); err != nil {
+		t.Fatal(err)
+	}
+
+	decodedKey, decodedCert, err := pkcs12.Decode(buffer.Bytes(), "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(decodedCert.Raw, cert.Raw) || !key.Equal(decodedKey) {
+		t.Fatal("decoded PFX does not match the certificate and key")
+	}
+}
+
+func TestEncode_ShouldReturnError_WhenInputIsMissing(t *testing.T) {
+	_, key := newTestWriterCertificate(t)
+
+	if _, err := EncodeToBytes(ExportFormatPemPublicKey, nil, key, ""); err == nil {
+		t.Fatal("error was not returned for a nil certificate")
+	}
+	if _, err := EncodeToBytes(ExportFormatPemPrivateKey, nil, nil, ""); err == nil {
+		t.Fatal("error was not returned for a nil key")
+	}
+	if _, err := EncodeToBytes(ExportFormat(42), nil, key, ""); err == nil {
+		t.Fatal("error was not returned for an unsupported encoding")
+	}
+}
+
+func TestWriteFile_ShouldWriteEncodedBytes(t *testing.T) {
+	cert, _ := newTestWriterCertificate(t)
+	filename := filepath.Join(t.TempDir(), "localhost.pem")
+
+	if err := WriteFile(filename, ExportFormatPemPublicKey, cert, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := EncodeToBytes(ExportFormatPemPublicKey, cert, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(actual, expected) {
+		t.Fatal("file contents do not match the encoded certificate")
+	}
+}
+
+func assertFileMode(t *testing.T, filename string, expected os.FileMode) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		return
+	}
+	info, err := os.Stat(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != expected {
+		t.Fatalf("mode %v of %s does not match expected %v", info.Mode().Perm(), filename, expected)
+	}
+}
+
+func TestWriteFile_ShouldRestrictPermissions_WhenFileContainsPrivateKey(t *testing.T) {
+	cert, key := newTestWriterCertificate(t)
+	directory := t.TempDir()
+
+	keyFilename := filepath.Join(directory, "localhost.key")
+	if err := WriteFile(keyFilename, ExportFormatPemPrivateKey, cert, key, ""); err != nil {
+		t.Fatal(err)
+	}
+	pfxFilename := filepath.Join(directory, "localhost.pfx")
+	if err := WriteFile(pfxFilename, ExportFormatPFX, cert, key, "password"); err != nil {
+		t.Fatal(err)
+	}
+	certFilename := filepath.Join(directory, "localhost.crt")
+	if err := WriteFile(certFilename, ExportFormatPemPublicKey, cert, key, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	assertFileMode(t, keyFilename, 0600)
+	assertFileMode(t, pfxFilename, 0600)
+	assertFileMode(t, certFilename, 0644)
+}
+
+func TestWriteFile_ShouldApplyConfiguredFileModes(t *testing.T) {
+	cert, key := newTestWriterCertificate(t)
+	directory := t.TempDir()
+
+	keyFilename := filepath.Join(directory, "localhost.key")
+	if err := WriteFile(keyFilename, ExportFormatPemPrivateKey, cert, key, "", WriteWithKeyFileMode(0640)); err != nil {
+		t.Fatal(err)
+	}
+	certFilename := filepath.Join(directory, "localhost.crt")
+	if err := WriteFile(certFilename, ExportFormatPemPublicKey, cert, key, "", WriteWithCertificateFileMode(0600)); err != nil {
+		t.Fatal(err)
+	}
+
+	assertFileMode(t, keyFilename, 0640)
+	assertFileMode(t, certFilename, 0600)
+}
+
+func TestWriteFile_ShouldReplaceExistingFileWithoutLeavingTemporaryFiles(t *testing.T) {
+	cert, _ := newTestWriterCertificate(t)
+	directory := t.TempDir()
+	filename := filepath.Join(directory, "localhost.crt")
+	if err := os.WriteFile(filename, []byte("previous"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := WriteFile(filename, ExportFormatPemPublicKey, cert, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(content, []byte("previous")) {
+		t.Fatal("existing file was not replaced")
+	}
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("directory contains %d entries rather than only the written file", len(entries))
+	}
+}
+
+func TestWriteFile_ShouldReturnError_WhenNoClobberAndFileExists(t *testing.T) {
+	cert, key := newTestWriterCertificate(t)
+	directory := t.TempDir()
+	filename := filepath.Join(directory, "localhost.key")
+	if err := os.WriteFile(filename, []byte("previous"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	err := WriteFile(filename, ExportFormatPemPrivateKey, cert, key, "", WriteWithNoClobber())
+	if !errors.Is(err, fs.ErrExist) {
+		t.Fatalf("error %v is not fs.ErrExist", err)
+	}
+
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, []byte("previous")) {
+		t.Fatal("existing file was overwritten")
+	}
+	entries, err := os.ReadDir(directory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("directory contains %d entries rather than only the existing file", len(entries))
+	}
+
+	other := filepath.Join(directory, "other.key")
+	if err := WriteFile(other, ExportFormatPemPrivateKey, cert, key, "", WriteWithNoClobber()); err != nil {
+		t.Fatal(err)
+	}
+	assertFileMode(t, other, 0600)
+}
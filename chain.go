@@ -0,0 +1,92 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"fmt"
+	"io"
+)
+
+// validateChain checks chain is ordered from the issuer of certificate towards the root, each certificate signed by
+// the one following it. The root is optional but when present it must be self-signed and the last certificate.
+// Signatures are verified against the issuer's public key without applying an algorithm policy, so chains built with
+// SignatureAlgorithmPolicyLegacy can still be exported
+func validateChain(certificate *x509.Certificate, chain []*x509.Certificate) error {
+	if certificate == nil {
+		return fmt.Errorf("invalid argument, certificate cannot be nil")
+	}
+	subject := certificate
+	for i, issuer := range chain {
+		if issuer == nil {
+			return fmt.Errorf("%w, certificate %d of the chain is nil", ErrInvalidChain, i)
+		}
+		if isSelfSigned(subject) {
+			return fmt.Errorf("%w, self-signed certificate %q must be the last certificate of the chain", ErrInvalidChain, subject.Subject)
+		}
+		if err := checkIssuedBy(subject, issuer); err != nil {
+			return fmt.Errorf("%w, %q is not issued by %q: %v", ErrInvalidChain, subject.Subject, issuer.Subject, err)
+		}
+		subject = issuer
+	}
+	return nil
+}
+
+// checkIssuedBy verifies subject is signed by issuer and that issuer is permitted to sign certificates, as
+// x509.Certificate.CheckSignatureFrom does but without rejecting SHA-1 signatures
+func checkIssuedBy(subject *x509.Certificate, issuer *x509.Certificate) error {
+	if issuer.Version == 3 && (!issuer.BasicConstraintsValid || !issuer.IsCA) {
+		return fmt.Errorf("issuer is not a certificate authority")
+	}
+	if issuer.KeyUsage != 0 && issuer.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return fmt.Errorf("issuer key usage does not permit certificate signing")
+	}
+	return verifySignature(issuer.PublicKey, subject.SignatureAlgorithm, subject.RawTBSCertificate, subject.Signature)
+}
+
+// isSelfSigned reports whether certificate is signed by its own key
+func isSelfSigned(certificate *x509.Certificate) bool {
+	return bytes.Equal(certificate.RawIssuer, certificate.RawSubject) &&
+		verifySignature(certificate.PublicKey, certificate.SignatureAlgorithm, certificate.RawTBSCertificate, certificate.Signature) == nil
+}
+
+// encodePemBundle writes certificate followed by its chain as consecutive PEM certificates
+func encodePemBundle(w io.Writer, certificate *x509.Certificate, chain []*x509.Certificate) error {
+	if err := validateChain(certificate, chain); err != nil {
+		return err
+	}
+	for _, cert := range append([]*x509.Certificate{certificate}, chain...) {
+		if err := encodePublicPem(w, cert); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// encodePemCombined writes certificate, its chain and then key as a single PEM file in the layout expected by HAProxy
+// and similar servers
+func encodePemCombined(w io.Writer, certificate *x509.Certificate, chain []*x509.Certificate, key crypto.Signer) error {
+	if key == nil {
+		return fmt.Errorf("invalid argument, key cannot be nil")
+	}
+	if certificate != nil && !publicKeysEqual(key.Public(), certificate.PublicKey) {
+		return fmt.Errorf("%w, key does not match the certificate", ErrKeyMismatch)
+	}
+	if err := encodePemBundle(w, certificate, chain); err != nil {
+		return err
+	}
+	return encodePKCS8PrivatePem(w, key)
+}
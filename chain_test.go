@@ -0,0 +1,215 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func decodeTestPemBlocks(t *testing.T, data []byte) []*pem.Block {
+	t.Helper()
+	var blocks []*pem.Block
+	for {
+		block, rest := pem.Decode(data)
+		if block == nil {
+			break
+		}
+		blocks = append(blocks, block)
+		data = rest
+	}
+	if len(bytes.TrimSpace(data)) != 0 {
+		t.Fatal("data contains content which is not PEM")
+	}
+	return blocks
+}
+
+func assertTestCertificateBlocks(t *testing.T, blocks []*pem.Block, expected ...*x509.Certificate) {
+	t.Helper()
+	if len(blocks) < len(expected) {
+		t.Fatalf("expected %d certificates but found %d blocks", len(expected), len(blocks))
+	}
+	for i, cert := range expected {
+		if blocks[i].Type != "CERTIFICATE" || !bytes.Equal(blocks[i].Bytes, cert.Raw) {
+			t.Fatalf("block %d is not the certificate %q", i, cert.Subject)
+		}
+	}
+}
+
+func TestEncodeToBytes_ShouldEncodeCertificateAsDer(t *testing.T) {
+	cert, _ := newTestWriterCertificate(t)
+
+	data, err := EncodeToBytes(ExportFormatDER, cert, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := x509.ParseCertificate(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Equal(cert) {
+		t.Fatal("decoded certificate does not match the certificate")
+	}
+}
+
+func TestEncodeToBytes_ShouldEncodePemBundleInChainOrder(t *testing.T) {
+	factory, root, intermediate := newTestCertificateAuthorities(t)
+	cert, _, err := factory.NewServerCertificate(intermediate, "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := EncodeToBytes(ExportFormatPemBundle, cert, nil, "", WriteWithChain(intermediate.Certificate, root.Certificate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := decodeTestPemBlocks(t, data)
+	if len(blocks) != 3 {
+		t.Fatalf("expected 3 certificates but found %d", len(blocks))
+	}
+	assertTestCertificateBlocks(t, blocks, cert, intermediate.Certificate, root.Certificate)
+
+	data, err = EncodeToBytes(ExportFormatPemBundle, cert, nil, "", WriteWithChain(intermediate.Certificate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks = decodeTestPemBlocks(t, data)
+	if len(blocks) != 2 {
+		t.Fatalf("expected 2 certificates but found %d", len(blocks))
+	}
+	assertTestCertificateBlocks(t, blocks, cert, intermediate.Certificate)
+}
+
+func TestEncodeToBytes_ShouldEncodeCombinedPemWithChainAndKey(t *testing.T) {
+	factory, _, intermediate := newTestCertificateAuthorities(t)
+	cert, key, err := factory.NewServerCertificate(intermediate, "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := EncodeToBytes(ExportFormatPemCombined, cert, key, "", WriteWithChain(intermediate.Certificate))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocks := decodeTestPemBlocks(t, data)
+	if len(blocks) != 3 {
+		t.Fatalf("expected 2 certificates and a key but found %d blocks", len(blocks))
+	}
+	assertTestCertificateBlocks(t, blocks, cert, intermediate.Certificate)
+	if blocks[2].Type != "PRIVATE KEY" {
+		t.Fatalf("last block is %q rather than the private key", blocks[2].Type)
+	}
+	decodedKey, err := x509.ParsePKCS8PrivateKey(blocks[2].Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !publicKeysEqual(decodedKey.(interface{ Public() crypto.PublicKey }).Public(), cert.PublicKey) {
+		t.Fatal("decoded key does not match the certificate")
+	}
+}
+
+func TestEncodeToBytes_ShouldReturnError_WhenCombinedPemKeyDoesNotMatchCertificate(t *testing.T) {
+	cert, _ := newTestWriterCertificate(t)
+	_, otherKey := newTestWriterCertificate(t)
+
+	_, err := EncodeToBytes(ExportFormatPemCombined, cert, otherKey, "")
+
+	if !errors.Is(err, ErrKeyMismatch) {
+		t.Fatalf("expected ErrKeyMismatch but found %v", err)
+	}
+}
+
+func TestEncodeToBytes_ShouldReturnError_WhenChainIsInvalid(t *testing.T) {
+	factory, root, intermediate := newTestCertificateAuthorities(t)
+	cert, key, err := factory.NewServerCertificate(intermediate, "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherRoot, err := factory.NewRootCA("Other Root CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	chains := map[string][]*x509.Certificate{
+		"reversed":        {root.Certificate, intermediate.Certificate},
+		"missing issuer":  {root.Certificate},
+		"wrong root":      {intermediate.Certificate, otherRoot.Certificate},
+		"root not last":   {intermediate.Certificate, root.Certificate, root.Certificate},
+		"nil certificate": {intermediate.Certificate, nil},
+	}
+	for name, chain := range chains {
+		t.Run(name, func(t *testing.T) {
+			for _, encoding := range []ExportFormat{ExportFormatPemBundle, ExportFormatPemCombined, ExportFormatPFX} {
+				_, err := EncodeToBytes(encoding, cert, key, "password", WriteWithChain(chain...))
+				if !errors.Is(err, ErrInvalidChain) {
+					t.Fatalf("expected ErrInvalidChain for encoding %d but found %v", encoding, err)
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeToBytes_ShouldEncodePemBundle_WhenChainIsSignedWithSHA1(t *testing.T) {
+	root, rootKey, err := NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithCommonName("Legacy Root CA").
+		WithIsCertificateAuthority(true).
+		WithBasicConstraint().
+		WithKeyUsage(x509.KeyUsageCertSign | x509.KeyUsageCRLSign).
+		WithSignatureAlgorithm(x509.ECDSAWithSHA1).
+		WithSignatureAlgorithmPolicy(SignatureAlgorithmPolicyLegacy).
+		BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _, err := NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmRSA2048).
+		WithCommonName("localhost").
+		WithSignatureAlgorithm(x509.ECDSAWithSHA1).
+		WithSignatureAlgorithmPolicy(SignatureAlgorithmPolicyLegacy).
+		BuildSignedCertificate(root, rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := EncodeToBytes(ExportFormatPemBundle, cert, nil, "", WriteWithChain(root))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertTestCertificateBlocks(t, decodeTestPemBlocks(t, data), cert, root)
+}
+
+func TestWriteFile_ShouldRestrictPermissions_WhenCombinedPemContainsKey(t *testing.T) {
+	cert, key := newTestWriterCertificate(t)
+	directory := t.TempDir()
+	combined := filepath.Join(directory, "localhost.pem")
+	der := filepath.Join(directory, "localhost.cer")
+
+	if err := WriteFile(combined, ExportFormatPemCombined, cert, key, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFile(der, ExportFormatDER, cert, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	assertFileMode(t, combined, defaultKeyFileMode)
+	assertFileMode(t, der, defaultCertificateFileMode)
+}
@@ -14,36 +14,76 @@
 package x509certificates
 
 import (
+	"crypto"
 	"crypto/rand"
-	"crypto/rsa"
 	"crypto/x509"
 	"crypto/x509/pkix"
 	"fmt"
+	"io"
 	"math/big"
+	"net"
+	"net/url"
 	"time"
 )
 
 type CertificateBuilder struct {
 	err                           error
 	bitSize                       int
+	keyAlgorithm                  KeyAlgorithm
+	keyAlgorithmSet               bool
+	publicKey                     crypto.PublicKey
+	signer                        crypto.Signer
 	commonName                    string
-	organization                  string
-	organizationUnit              string
+	organization                  []string
+	organizationUnit              []string
 	city                          string
 	state                         string
 	country                       string
+	streetAddress                 []string
+	postalCode                    string
+	subjectSerialNumber           string
+	subjectEmailAddress           string
+	domainComponents              []string
+	extraNames                    []pkix.AttributeTypeAndValue
+	subjectStringEncoding         SubjectStringEncoding
+	rawSubject                    []byte
+	signatureAlgorithm            x509.SignatureAlgorithm
+	signatureAlgorithmPolicy      SignatureAlgorithmPolicy
 	dnsNames                      []string
+	ipAddresses                   []net.IP
+	emailAddresses                []string
+	uris                          []*url.URL
 	keyUsage                      x509.KeyUsage
 	enhancedKeyUsages             []x509.ExtKeyUsage
 	extensions                    []pkix.Extension
 	notBefore                     *time.Time
 	notAfter                      *time.Time
+	validity                      time.Duration
+	backdate                      time.Duration
+	clampToIssuerValidity         bool
+	browserCompatibleValidity     bool
 	serialNumber                  *big.Int
+	serialNumberSource            SerialNumberSource
+	keySource                     KeySource
+	clock                         func() time.Time
+	random                        io.Reader
 	includeBasicConstraint        bool
 	includeSubjectKeyIdentifier   bool
 	subjectKeyIdentifierCritical  bool
+	subjectKeyIdentifierMethod    SubjectKeyIdentifierMethod
 	includeAuthorityKeyIdentifier bool
 	isCertificateAuthority        bool
+	maxPathLength                 int
+	nameConstraints               nameConstraints
+	crlDistributionPoints         []string
+	ocspServers                   []string
+	issuingCertificateURLs        []string
+	certificatePolicies           []CertificatePolicy
+	policyMappings                []PolicyMapping
+	requireExplicitPolicy         int
+	inhibitPolicyMapping          int
+	inhibitAnyPolicy              int
+	challengePassword             string
 }
 
 // NewCertificateBuilder creates a new certificate builder which can be used to configure and then build x509
@@ -51,35 +91,46 @@ type CertificateBuilder struct {
 //	certificates
 func NewCertificateBuilder() *CertificateBuilder {
 	return &CertificateBuilder{
-		err:               nil,
-		bitSize:           4096,
-		commonName:        "",
-		organization:      "",
-		organizationUnit:  "",
-		city:              "",
-		state:             "",
-		country:           "",
-		dnsNames:          make([]string, 0, 0),
-		enhancedKeyUsages: make([]x509.ExtKeyUsage, 0, 0),
-		keyUsage: x509.KeyUsageKeyEncipherment | x509.KeyUsageDigitalSignature |
-			x509.KeyUsageDataEncipherment | x509.KeyUsageContentCommitment,
-		notBefore:    nil,
-		notAfter:     nil,
-		serialNumber: nil,
-	}
-}
-
-// GetError returns the current error if set, otherwise nil
+		err:                   nil,
+		bitSize:               4096,
+		keyAlgorithm:          KeyAlgorithmRSA4096,
+		commonName:            "",
+		organization:          make([]string, 0, 0),
+		organizationUnit:      make([]string, 0, 0),
+		city:                  "",
+		state:                 "",
+		country:               "",
+		dnsNames:              make([]string, 0, 0),
+		ipAddresses:           make([]net.IP, 0, 0),
+		emailAddresses:        make([]string, 0, 0),
+		uris:                  make([]*url.URL, 0, 0),
+		enhancedKeyUsages:     make([]x509.ExtKeyUsage, 0, 0),
+		keyUsage:              0,
+		notBefore:             nil,
+		notAfter:              nil,
+		serialNumber:          nil,
+		serialNumberSource:    nil,
+		clock:                 nil,
+		random:                nil,
+		maxPathLength:         -1,
+		requireExplicitPolicy: -1,
+		inhibitPolicyMapping:  -1,
+		inhibitAnyPolicy:      -1,
+	}
+}
+
+// GetError returns the current error if set, otherwise nil. Errors from builder options are collected into a
+// *BuilderError listing every rejected value
 func (c *CertificateBuilder) GetError() error {
 	return c.err
 }
 
+// WithBitSize sets the modulus size of generated RSA keys, it has no effect on other key algorithms
 func (c *CertificateBuilder) WithBitSize(value int) *CertificateBuilder {
-	if c.err != nil {
-		return c
-	}
 	if value < 2048 {
-		c.err = fmt.Errorf("bitsize cannot be less than 2048")
+		c.addError("WithBitSize", value, ErrInvalidBitSize)
+	}
+	if c.err != nil {
 		return c
 	}
 
@@ -87,96 +138,238 @@ func (c *CertificateBuilder) WithBitSize(value int) *CertificateBuilder {
 	return c
 }
 
-func (c *CertificateBuilder) WithIsCertificateAuthority(value bool) *CertificateBuilder {
+// WithKeyAlgorithm sets the algorithm used to generate the certificate key, RSA algorithms also set the bit size
+func (c *CertificateBuilder) WithKeyAlgorithm(value KeyAlgorithm) *CertificateBuilder {
+	if !value.isValid() {
+		c.addError("WithKeyAlgorithm", value, ErrUnsupportedKeyAlgorithm)
+	} else if key := c.suppliedPublicKey(); key != nil {
+		if algorithm, _ := publicKeyAlgorithmOf(key); algorithm != value.publicKeyAlgorithm() {
+			c.addError("WithKeyAlgorithm", value, fmt.Errorf("%w, the supplied key is %v", ErrKeyMismatch, algorithm))
+		}
+	}
 	if c.err != nil {
 		return c
 	}
-	c.isCertificateAuthority = value
+
+	c.keyAlgorithm = value
+	c.keyAlgorithmSet = true
+	if bitSize := value.rsaBitSize(); bitSize != 0 {
+		c.bitSize = bitSize
+	}
 	return c
 }
 
-func (c *CertificateBuilder) WithCommonName(value string) *CertificateBuilder {
+// WithPublicKey sets the subject public key to certify instead of generating a new key, a certificate built from a
+// public key alone must be signed by an issuer
+func (c *CertificateBuilder) WithPublicKey(value crypto.PublicKey) *CertificateBuilder {
+	if value == nil {
+		c.addError("WithPublicKey", value, ErrNilValue)
+	} else if err := c.validateSuppliedKey(value); err != nil {
+		c.addError("WithPublicKey", value, err)
+	} else if c.signer != nil && !publicKeysEqual(c.signer.Public(), value) {
+		c.addError("WithPublicKey", value, fmt.Errorf("%w, public key does not match the supplied signer", ErrKeyMismatch))
+	}
 	if c.err != nil {
 		return c
 	}
-	if len(value) == 0 {
-		c.err = fmt.Errorf("invalid argument, common name cannot be empty")
+
+	c.publicKey = value
+	return c
+}
+
+// WithSigner sets the subject key pair instead of generating a new key, self-signed certificates are signed with it
+func (c *CertificateBuilder) WithSigner(value crypto.Signer) *CertificateBuilder {
+	if value == nil {
+		c.addError("WithSigner", value, ErrNilValue)
+	} else if err := c.validateSuppliedKey(value.Public()); err != nil {
+		c.addError("WithSigner", value, err)
+	} else if c.publicKey != nil && !publicKeysEqual(c.publicKey, value.Public()) {
+		c.addError("WithSigner", value, fmt.Errorf("%w, signer does not match the supplied public key", ErrKeyMismatch))
+	}
+	if c.err != nil {
 		return c
 	}
 
-	c.commonName = value
+	c.signer = value
 	return c
 }
 
-func (c *CertificateBuilder) WithOrganization(value string) *CertificateBuilder {
+func (c *CertificateBuilder) validateSuppliedKey(key crypto.PublicKey) error {
+	algorithm, err := publicKeyAlgorithmOf(key)
+	if err != nil {
+		return fmt.Errorf("%w, %v", ErrUnsupportedKeyAlgorithm, err)
+	}
+	if c.keyAlgorithmSet && algorithm != c.keyAlgorithm.publicKeyAlgorithm() {
+		return fmt.Errorf("%w, %v key does not match the configured key algorithm %v", ErrKeyMismatch, algorithm, c.keyAlgorithm)
+	}
+	return nil
+}
+
+func (c *CertificateBuilder) suppliedPublicKey() crypto.PublicKey {
+	if c.signer != nil {
+		return c.signer.Public()
+	}
+	return c.publicKey
+}
+
+func (c *CertificateBuilder) WithIsCertificateAuthority(value bool) *CertificateBuilder {
 	if c.err != nil {
 		return c
 	}
-	if len(value) == 0 {
-		c.err = fmt.Errorf("invalid argument, organization cannot be empty")
+	c.isCertificateAuthority = value
+	return c
+}
+
+// WithMaxPathLength limits the number of intermediate certificate authorities that may follow this certificate
+// authority in a chain, it also includes the basic constraints extension
+func (c *CertificateBuilder) WithMaxPathLength(value int) *CertificateBuilder {
+	if value < 0 {
+		c.addError("WithMaxPathLength", value, ErrNegativeValue)
+	}
+	if c.err != nil {
 		return c
 	}
-	c.organization = value
+	c.maxPathLength = value
+	c.includeBasicConstraint = true
 	return c
 }
 
-func (c *CertificateBuilder) WithOrganizationUnit(value string) *CertificateBuilder {
+// WithCommonName sets the common name of the subject, at most 64 characters
+func (c *CertificateBuilder) WithCommonName(value string) *CertificateBuilder {
+	if err := validateDirectoryString(value, maxCommonNameLength); err != nil {
+		c.addError("WithCommonName", value, err)
+	}
 	if c.err != nil {
 		return c
 	}
-	if len(value) == 0 {
-		c.err = fmt.Errorf("invalid argument, organization unit cannot be empty")
+
+	c.commonName = value
+	c.rawSubject = nil
+	return c
+}
+
+// WithOrganization sets the organizations of the subject, replacing any set previously
+func (c *CertificateBuilder) WithOrganization(values ...string) *CertificateBuilder {
+	values = c.validateNameValues("WithOrganization", values, maxOrganizationNameLength)
+	if c.err != nil {
 		return c
 	}
-	c.organizationUnit = value
+	c.organization = values
+	c.rawSubject = nil
 	return c
 }
 
-func (c *CertificateBuilder) WithCity(value string) *CertificateBuilder {
+// WithOrganizationUnit sets the organizational units of the subject, replacing any set previously
+func (c *CertificateBuilder) WithOrganizationUnit(values ...string) *CertificateBuilder {
+	values = c.validateNameValues("WithOrganizationUnit", values, maxOrganizationalUnitNameLength)
 	if c.err != nil {
 		return c
 	}
-	if len(value) == 0 {
-		c.err = fmt.Errorf("invalid argument, city unit cannot be empty")
+	c.organizationUnit = values
+	c.rawSubject = nil
+	return c
+}
+
+// WithCity sets the locality of the subject, at most 128 characters
+func (c *CertificateBuilder) WithCity(value string) *CertificateBuilder {
+	if err := validateDirectoryString(value, maxLocalityNameLength); err != nil {
+		c.addError("WithCity", value, err)
+	}
+	if c.err != nil {
 		return c
 	}
 	c.city = value
+	c.rawSubject = nil
 	return c
 }
 
+// WithState sets the state or province of the subject, at most 128 characters
 func (c *CertificateBuilder) WithState(value string) *CertificateBuilder {
-	if c.err != nil {
-		return c
+	if err := validateDirectoryString(value, maxStateNameLength); err != nil {
+		c.addError("WithState", value, err)
 	}
-	if len(value) == 0 {
-		c.err = fmt.Errorf("invalid argument, state unit cannot be empty")
+	if c.err != nil {
 		return c
 	}
 	c.state = value
+	c.rawSubject = nil
 	return c
 }
 
+// WithCountry sets the country of the subject as an upper case ISO 3166-1 alpha-2 code such as CA
 func (c *CertificateBuilder) WithCountry(value string) *CertificateBuilder {
-	if c.err != nil {
-		return c
+	if err := validateCountryCode(value); err != nil {
+		c.addError("WithCountry", value, err)
 	}
-	if len(value) == 0 {
-		c.err = fmt.Errorf("invalid argument, state unit cannot be empty")
+	if c.err != nil {
 		return c
 	}
 	c.country = value
+	c.rawSubject = nil
 	return c
 }
 
+// WithDnsNames adds DNS subject alternative names, internationalized names are stored in their punycode form
 func (c *CertificateBuilder) WithDnsNames(values ...string) *CertificateBuilder {
+	names := make([]string, 0, len(values))
+	for _, value := range values {
+		name, err := normalizeDnsName(value)
+		if err != nil {
+			c.addError("WithDnsNames", value, err)
+			continue
+		}
+		names = append(names, name)
+	}
+	if c.err != nil {
+		return c
+	}
+	c.dnsNames = append(c.dnsNames, names...)
+	return c
+}
+
+// WithIPAddresses adds IP address subject alternative names
+func (c *CertificateBuilder) WithIPAddresses(values ...net.IP) *CertificateBuilder {
+	for _, value := range values {
+		if err := validateIPAddress(value); err != nil {
+			c.addError("WithIPAddresses", value, err)
+		}
+	}
+	if c.err != nil {
+		return c
+	}
+	c.ipAddresses = append(c.ipAddresses, values...)
+	return c
+}
+
+// WithEmailAddresses adds email (rfc822Name) subject alternative names
+func (c *CertificateBuilder) WithEmailAddresses(values ...string) *CertificateBuilder {
+	for _, value := range values {
+		if err := validateEmailAddress(value); err != nil {
+			c.addError("WithEmailAddresses", value, err)
+		}
+	}
 	if c.err != nil {
 		return c
 	}
+	c.emailAddresses = append(c.emailAddresses, values...)
+	return c
+}
 
-	c.dnsNames = append(c.dnsNames, values...)
+// WithURIs adds URI subject alternative names, each URI must be absolute
+func (c *CertificateBuilder) WithURIs(values ...*url.URL) *CertificateBuilder {
+	for _, value := range values {
+		if err := validateURI(value); err != nil {
+			c.addError("WithURIs", value, err)
+		}
+	}
+	if c.err != nil {
+		return c
+	}
+	c.uris = append(c.uris, values...)
 	return c
 }
 
+// WithKeyUsage sets the key usage, when not set (or set to zero) a default suited to the key algorithm is used
 func (c *CertificateBuilder) WithKeyUsage(usage x509.KeyUsage) *CertificateBuilder {
 	if c.err != nil {
 		return c
@@ -203,7 +396,11 @@ func (c *CertificateBuilder) WithExtensions(values ...pkix.Extension) *Certifica
 	return c
 }
 
+// WithNotBefore sets the start of the validity period, which must be before the not after time when one is set
 func (c *CertificateBuilder) WithNotBefore(value time.Time) *CertificateBuilder {
+	if c.notAfter != nil && !c.notAfter.After(value) {
+		c.addError("WithNotBefore", value, fmt.Errorf("%w, not before must be before not after %v", ErrInvalidValue, *c.notAfter))
+	}
 	if c.err != nil {
 		return c
 	}
@@ -212,7 +409,11 @@ func (c *CertificateBuilder) WithNotBefore(value time.Time) *CertificateBuilder
 	return c
 }
 
+// WithNotAfter sets the end of the validity period, which must be after the not before time when one is set
 func (c *CertificateBuilder) WithNotAfter(value time.Time) *CertificateBuilder {
+	if c.notBefore != nil && !value.After(*c.notBefore) {
+		c.addError("WithNotAfter", value, fmt.Errorf("%w, not after must be after not before %v", ErrInvalidValue, *c.notBefore))
+	}
 	if c.err != nil {
 		return c
 	}
@@ -220,7 +421,12 @@ func (c *CertificateBuilder) WithNotAfter(value time.Time) *CertificateBuilder {
 	return c
 }
 
+// WithSerialNumber sets a fixed serial number, which must be positive and no longer than 20 octets, in place of one
+// from the serial number source
 func (c *CertificateBuilder) WithSerialNumber(value *big.Int) *CertificateBuilder {
+	if err := validateSerialNumber(value); err != nil {
+		c.addError("WithSerialNumber", value, err)
+	}
 	if c.err != nil {
 		return c
 	}
@@ -228,6 +434,32 @@ func (c *CertificateBuilder) WithSerialNumber(value *big.Int) *CertificateBuilde
 	return c
 }
 
+// WithSerialNumberSource sets the source of serial numbers used when no fixed serial number is set, by default
+// serial numbers are positive 128-bit random values
+func (c *CertificateBuilder) WithSerialNumberSource(value SerialNumberSource) *CertificateBuilder {
+	if value == nil {
+		c.addError("WithSerialNumberSource", value, ErrNilValue)
+	}
+	if c.err != nil {
+		return c
+	}
+	c.serialNumberSource = value
+	return c
+}
+
+// WithKeySource sets the source of the key generated when no key is supplied, by default the key generation of the
+// standard library
+func (c *CertificateBuilder) WithKeySource(value KeySource) *CertificateBuilder {
+	if value == nil {
+		c.addError("WithKeySource", value, ErrNilValue)
+	}
+	if c.err != nil {
+		return c
+	}
+	c.keySource = value
+	return c
+}
+
 func (c *CertificateBuilder) WithBasicConstraint() *CertificateBuilder {
 	if c.err != nil {
 		return c
@@ -236,6 +468,7 @@ func (c *CertificateBuilder) WithBasicConstraint() *CertificateBuilder {
 	return c
 }
 
+// WithIncludeSubjectKeyIdentifier adds a subject key identifier computed from the public key
 func (c *CertificateBuilder) WithIncludeSubjectKeyIdentifier() *CertificateBuilder {
 	if c.err != nil {
 		return c
@@ -244,6 +477,20 @@ func (c *CertificateBuilder) WithIncludeSubjectKeyIdentifier() *CertificateBuild
 	return c
 }
 
+// WithSubjectKeyIdentifierMethod sets how key identifiers are computed, the default is the RFC 5280 SHA-1 method
+func (c *CertificateBuilder) WithSubjectKeyIdentifierMethod(value SubjectKeyIdentifierMethod) *CertificateBuilder {
+	if value != SubjectKeyIdentifierMethodSHA1 && value != SubjectKeyIdentifierMethodTruncatedSHA256 {
+		c.addError("WithSubjectKeyIdentifierMethod", value, fmt.Errorf("%w, unsupported subject key identifier method", ErrInvalidValue))
+	}
+	if c.err != nil {
+		return c
+	}
+	c.subjectKeyIdentifierMethod = value
+	return c
+}
+
+// WithSubjectKeyIdentifierCritical marks the subject key identifier critical, which also includes it. RFC 5280 requires
+// the extension to be non-critical so this is only intended for testing how relying parties handle it
 func (c *CertificateBuilder) WithSubjectKeyIdentifierCritical(value bool) *CertificateBuilder {
 	if c.err != nil {
 		return c
@@ -252,6 +499,7 @@ func (c *CertificateBuilder) WithSubjectKeyIdentifierCritical(value bool) *Certi
 	return c
 }
 
+// WithIncludeAuthorityKeyIdentifier adds an authority key identifier copied from the issuer's subject key identifier
 func (c *CertificateBuilder) WithIncludeAuthorityKeyIdentifier() *CertificateBuilder {
 	if c.err != nil {
 		return c
@@ -260,57 +508,233 @@ func (c *CertificateBuilder) WithIncludeAuthorityKeyIdentifier() *CertificateBui
 	return c
 }
 
-func (c *CertificateBuilder) BuildSelfSignedCertificate() (*x509.Certificate, *rsa.PrivateKey, error) {
+// WithClock sets the source of the current time used for the default validity period, by default time.Now
+func (c *CertificateBuilder) WithClock(value func() time.Time) *CertificateBuilder {
+	if value == nil {
+		c.addError("WithClock", value, ErrNilValue)
+	}
+	if c.err != nil {
+		return c
+	}
+	c.clock = value
+	return c
+}
+
+// WithRandom sets the source of randomness used for keys, serial numbers and signatures, by default crypto/rand. With a
+// seeded source the same configuration produces byte-identical certificates and keys when the keys are Ed25519, or RSA
+// keys signing with PKCS #1 v1.5. The standard library deliberately mixes additional randomness into RSA and ECDSA key
+// generation and ECDSA signatures, so reproducing those requires a KeySource set with WithKeySource which derives keys
+// solely from random and returns signers that sign deterministically
+func (c *CertificateBuilder) WithRandom(value io.Reader) *CertificateBuilder {
+	if value == nil {
+		c.addError("WithRandom", value, ErrNilValue)
+	}
+	if c.err != nil {
+		return c
+	}
+	c.random = value
+	return c
+}
+
+// BuildSelfSignedCertificate builds a certificate from the current configuration signed by its own key, the key is
+// generated unless one was supplied using WithSigner
+func (c *CertificateBuilder) BuildSelfSignedCertificate() (*x509.Certificate, crypto.Signer, error) {
+	return c.buildCertificate(nil, nil)
+}
+
+// BuildSignedCertificate issues a certificate signed by issuerCert using issuerKey, issuerCert must be a certificate
+// authority permitted to sign certificates. The returned key is nil when only a public key was supplied
+func (c *CertificateBuilder) BuildSignedCertificate(issuerCert *x509.Certificate, issuerKey crypto.Signer) (*x509.Certificate, crypto.Signer, error) {
+	if err := validateIssuer(issuerCert, issuerKey); err != nil {
+		return nil, nil, err
+	}
+	return c.buildCertificate(issuerCert, issuerKey)
+}
+
+func (c *CertificateBuilder) buildCertificate(issuerCert *x509.Certificate, issuerKey crypto.Signer) (*x509.Certificate, crypto.Signer, error) {
+	if c.err != nil {
+		return nil, nil, c.err
+	}
 	template, err := c.buildCertificateTemplate()
 	if err != nil {
 		return nil, nil, err
 	}
 
-	rootKey, err := rsa.GenerateKey(rand.Reader, c.bitSize)
+	publicKey, key, err := c.resolveKey(issuerCert == nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	publicKeyAlgorithm, err := publicKeyAlgorithmOf(publicKey)
 	if err != nil {
 		return nil, nil, err
 	}
 
 	if c.isCertificateAuthority {
 		template.IsCA = true
+	} else if c.maxPathLength >= 0 || !c.nameConstraints.isEmpty() || c.hasPolicyConstraints() {
+		return nil, nil, fmt.Errorf("path length, name and policy constraints can only be applied to a certificate authority")
+	}
+	if issuerCert != nil {
+		if err := checkNameConstraints(issuerCert, template); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := c.applyValidity(template, issuerCert); err != nil {
+		return nil, nil, err
+	}
+	if template.KeyUsage == 0 {
+		template.KeyUsage = defaultKeyUsage(publicKeyAlgorithm, c.isCertificateAuthority)
+	}
+	if err := c.applyKeyIdentifiers(template, publicKey, issuerCert); err != nil {
+		return nil, nil, err
+	}
+
+	parent := template
+	signer := key
+	if issuerCert != nil {
+		parent = issuerCert
+		signer = issuerKey
+	}
+	if template.SignatureAlgorithm, err = c.resolveSignatureAlgorithm(signer); err != nil {
+		return nil, nil, err
 	}
 
-	certBytes, err := x509.CreateCertificate(rand.Reader, template, template, &rootKey.PublicKey, rootKey)
+	certBytes, err := x509.CreateCertificate(c.randomReader(), template, parent, publicKey, signer)
+	if err != nil {
+		return nil, nil, err
+	}
+	var cert *x509.Certificate
+	if c.subjectKeyIdentifierCritical {
+		cert, err = parseCertificateWithCriticalSubjectKeyIdentifier(certBytes)
+	} else {
+		cert, err = x509.ParseCertificate(certBytes)
+	}
 	if err != nil {
 		return nil, nil, err
 	}
-	cert, err := x509.ParseCertificate(certBytes)
+	return cert, key, nil
+}
+
+// resolveKey returns the subject public key along with its private key, which is nil when only a public key was supplied.
+// requireSigner is set when the subject key must sign the result. Keys are generated by the key source when one is set
+func (c *CertificateBuilder) resolveKey(requireSigner bool) (crypto.PublicKey, crypto.Signer, error) {
+	if c.signer != nil {
+		return c.signer.Public(), c.signer, nil
+	}
+	if c.publicKey != nil {
+		if requireSigner {
+			return nil, nil, fmt.Errorf("a signer is required to sign with the subject key, use WithSigner rather than WithPublicKey")
+		}
+		return c.publicKey, nil, nil
+	}
+
+	var key crypto.Signer
+	var err error
+	if c.keySource != nil {
+		key, err = c.keySource.GenerateKey(c.keyAlgorithm, c.bitSize, c.randomReader())
+	} else {
+		key, err = c.keyAlgorithm.generateKey(c.randomReader(), c.bitSize)
+	}
 	if err != nil {
 		return nil, nil, err
 	}
-	return cert, rootKey, nil
+	if key == nil {
+		return nil, nil, fmt.Errorf("key source returned a nil key")
+	}
+	return key.Public(), key, nil
+}
+
+func (c *CertificateBuilder) now() time.Time {
+	if c.clock != nil {
+		return c.clock()
+	}
+	return time.Now()
+}
+
+func (c *CertificateBuilder) randomReader() io.Reader {
+	if c.random != nil {
+		return c.random
+	}
+	return rand.Reader
+}
+
+func validateIssuer(issuerCert *x509.Certificate, issuerKey crypto.Signer) error {
+	if issuerCert == nil {
+		return fmt.Errorf("invalid argument, issuer certificate cannot be nil")
+	}
+	if issuerKey == nil {
+		return fmt.Errorf("invalid argument, issuer key cannot be nil")
+	}
+	if !issuerCert.BasicConstraintsValid || !issuerCert.IsCA {
+		return fmt.Errorf("invalid issuer, %q is not a certificate authority", issuerCert.Subject.CommonName)
+	}
+	if issuerCert.KeyUsage&x509.KeyUsageCertSign == 0 {
+		return fmt.Errorf("invalid issuer, %q does not have the certificate signing key usage", issuerCert.Subject.CommonName)
+	}
+	if !publicKeysEqual(issuerKey.Public(), issuerCert.PublicKey) {
+		return fmt.Errorf("invalid issuer, key does not match the public key of %q", issuerCert.Subject.CommonName)
+	}
+	return nil
 }
 
 func (c *CertificateBuilder) buildCertificateTemplate() (*x509.Certificate, error) {
-	if err := c.ensureSerialNumberIsSet(); err != nil {
+	serialNumber, err := c.nextSerialNumber()
+	if err != nil {
 		return nil, err
 	}
 	notBefore, notAfter := c.getNotBeforeAfterPair()
-	subject := c.buildSubjectName()
+	subject, rawSubject, err := c.buildSubjectName()
+	if err != nil {
+		return nil, err
+	}
 	cert := &x509.Certificate{
-		SerialNumber:          c.serialNumber,
-		Subject:               *subject,
-		BasicConstraintsValid: c.includeBasicConstraint,
-		KeyUsage:              c.keyUsage,
-		ExtKeyUsage:           c.enhancedKeyUsages,
-		NotBefore:             notBefore,
-		NotAfter:              notAfter,
-		Extensions:            c.extensions,
+		SerialNumber:                serialNumber,
+		Subject:                     subject,
+		RawSubject:                  rawSubject,
+		BasicConstraintsValid:       c.includeBasicConstraint,
+		KeyUsage:                    c.keyUsage,
+		ExtKeyUsage:                 c.enhancedKeyUsages,
+		DNSNames:                    c.dnsNames,
+		IPAddresses:                 c.ipAddresses,
+		EmailAddresses:              c.emailAddresses,
+		URIs:                        c.uris,
+		CRLDistributionPoints:       c.crlDistributionPoints,
+		OCSPServer:                  c.ocspServers,
+		IssuingCertificateURL:       c.issuingCertificateURLs,
+		MaxPathLen:                  c.maxPathLength,
+		MaxPathLenZero:              c.maxPathLength == 0,
+		PermittedDNSDomainsCritical: c.nameConstraints.critical,
+		PermittedDNSDomains:         c.nameConstraints.permittedDnsDomains,
+		ExcludedDNSDomains:          c.nameConstraints.excludedDnsDomains,
+		PermittedIPRanges:           c.nameConstraints.permittedIPRanges,
+		ExcludedIPRanges:            c.nameConstraints.excludedIPRanges,
+		PermittedEmailAddresses:     c.nameConstraints.permittedEmailAddresses,
+		ExcludedEmailAddresses:      c.nameConstraints.excludedEmailAddresses,
+		PermittedURIDomains:         c.nameConstraints.permittedURIDomains,
+		ExcludedURIDomains:          c.nameConstraints.excludedURIDomains,
+		NotBefore:                   notBefore,
+		NotAfter:                    notAfter,
+	}
+	policyExtensions, err := c.buildPolicyExtensions()
+	if err != nil {
+		return nil, err
 	}
+	cert.ExtraExtensions = append(policyExtensions, c.extensions...)
 	return cert, nil
 }
 
 func (c *CertificateBuilder) getNotBeforeAfterPair() (time.Time, time.Time) {
-	notBefore := time.Now()
+	start := c.now()
+	notBefore := start.Add(-c.backdate)
 	if c.notBefore != nil {
 		notBefore = *c.notBefore
+		start = notBefore
+	}
+	validity := c.validity
+	if validity == 0 {
+		validity = defaultValidity
 	}
-	notAfter := notBefore.Add(time.Hour * 24 * 365)
+	notAfter := start.Add(validity)
 	if c.notAfter != nil {
 		notAfter = *c.notAfter
 	}
@@ -318,38 +742,22 @@ func (c *CertificateBuilder) getNotBeforeAfterPair() (time.Time, time.Time) {
 	return notBefore, notAfter
 }
 
-func (c *CertificateBuilder) ensureSerialNumberIsSet() error {
-
+// nextSerialNumber returns the fixed serial number if set, otherwise a new one from the serial number source so that
+// each certificate built by the same builder has its own serial number
+func (c *CertificateBuilder) nextSerialNumber() (*big.Int, error) {
 	if c.serialNumber != nil {
-		return nil
+		return c.serialNumber, nil
 	}
-	serialNumber, err := rand.Int(rand.Reader, big.NewInt(200000000))
-	if err != nil {
-		return err
-	}
-	c.serialNumber = serialNumber
-	return nil
-}
-
-func (c *CertificateBuilder) buildSubjectName() *pkix.Name {
-	name := pkix.Name{
-		CommonName: c.commonName,
+	source := c.serialNumberSource
+	if source == nil {
+		source = NewRandomSerialNumberSource(c.random)
 	}
-
-	if c.organization != "" {
-		name.Organization = []string{c.organization}
-	}
-	if c.organizationUnit != "" {
-		name.OrganizationalUnit = []string{c.organizationUnit}
-	}
-	if c.city != "" {
-		name.Locality = []string{c.city}
-	}
-	if c.state != "" {
-		name.Province = []string{c.state}
+	serialNumber, err := source.NextSerialNumber()
+	if err != nil {
+		return nil, err
 	}
-	if c.country != "" {
-		name.Country = []string{c.country}
+	if err := validateSerialNumber(serialNumber); err != nil {
+		return nil, fmt.Errorf("serial number source returned an invalid serial number: %w", err)
 	}
-	return &name
+	return serialNumber, nil
 }
@@ -62,7 +62,7 @@ func TestCertificateBuilder_BuildSelfSignedCertificate_ShouldCreateCertForLocalA
 		WithOrganizationUnit("Anvils").
 		WithCity("Saskatoon").
 		WithState("Saskatchewan").
-		WithCountry("Canada").
+		WithCountry("CA").
 		WithKeyUsage(x509.KeyUsageDigitalSignature|x509.KeyUsageDataEncipherment|x509.KeyUsageContentCommitment).
 		WithEnhancedKeyUsage(x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth).
 		WithBasicConstraint().
@@ -84,3 +84,63 @@ func TestCertificateBuilder_BuildSelfSignedCertificate_ShouldCreateCertForLocalA
 	}
 
 }
+
+func TestCertificateBuilder_BuildSignedCertificate_ShouldCreateCertSignedByIssuer_WhenIssuerIsCertificateAuthority(t *testing.T) {
+	issuer, issuerKey, err := NewCertificateBuilder().
+		WithBitSize(2048).
+		WithCommonName("Acme Root CA").
+		WithIsCertificateAuthority(true).
+		WithBasicConstraint().
+		WithKeyUsage(x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature).
+		BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, _, err := NewCertificateBuilder().
+		WithBitSize(2048).
+		WithCommonName("localhost").
+		WithEnhancedKeyUsage(x509.ExtKeyUsageServerAuth).
+		BuildSignedCertificate(issuer, issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.CheckSignatureFrom(issuer); err != nil {
+		t.Fatal(err)
+	}
+	if c.Issuer.String() != issuer.Subject.String() {
+		t.Fatalf("issuer %v does not match expected value %v", c.Issuer, issuer.Subject)
+	}
+}
+
+func TestCertificateBuilder_BuildSignedCertificate_ShouldReturnError_WhenIssuerIsNotCertificateAuthority(t *testing.T) {
+	issuer, issuerKey, err := NewCertificateBuilder().
+		WithBitSize(2048).
+		WithCommonName("not a ca").
+		BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := NewCertificateBuilder().WithBitSize(2048).WithCommonName("localhost").BuildSignedCertificate(issuer, issuerKey); err == nil {
+		t.Fatal("error was not returned when issuer is not a certificate authority")
+	}
+}
+
+func TestCertificateBuilder_BuildSignedCertificate_ShouldReturnError_WhenIssuerCannotSignCertificates(t *testing.T) {
+	issuer, issuerKey, err := NewCertificateBuilder().
+		WithBitSize(2048).
+		WithCommonName("Acme Root CA").
+		WithIsCertificateAuthority(true).
+		WithBasicConstraint().
+		WithKeyUsage(x509.KeyUsageDigitalSignature).
+		BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := NewCertificateBuilder().WithBitSize(2048).WithCommonName("localhost").BuildSignedCertificate(issuer, issuerKey); err == nil {
+		t.Fatal("error was not returned when issuer lacks certificate signing key usage")
+	}
+}
@@ -0,0 +1,295 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+	"testing"
+)
+
+var (
+	bigOne       = big.NewInt(1)
+	rsaPublicExp = 65537
+)
+
+// deterministicKeySource generates keys solely from the values read from random so that a seeded source reproduces
+// the same keys, and wraps ECDSA keys to sign as described in RFC 6979. The standard library deliberately reads a
+// varying amount of randomness when generating RSA and ECDSA keys and signing with ECDSA, so snapshot tests inject
+// this source with WithKeySource. It is not constant-time and must only be used by tests
+type deterministicKeySource struct{}
+
+func (deterministicKeySource) GenerateKey(algorithm KeyAlgorithm, bitSize int, random io.Reader) (crypto.Signer, error) {
+	switch algorithm {
+	case KeyAlgorithmRSA2048, KeyAlgorithmRSA3072, KeyAlgorithmRSA4096:
+		return generateDeterministicRSAKey(random, bitSize)
+	case KeyAlgorithmECDSAP256:
+		return newRFC6979Signer(generateDeterministicECDSAKey(elliptic.P256(), random))
+	case KeyAlgorithmECDSAP384:
+		return newRFC6979Signer(generateDeterministicECDSAKey(elliptic.P384(), random))
+	case KeyAlgorithmECDSAP521:
+		return newRFC6979Signer(generateDeterministicECDSAKey(elliptic.P521(), random))
+	default:
+		return algorithm.generateKey(random, bitSize)
+	}
+}
+
+func generateDeterministicRSAKey(random io.Reader, bits int) (*rsa.PrivateKey, error) {
+	e := big.NewInt(int64(rsaPublicExp))
+	for {
+		p, err := generateDeterministicPrime(random, bits-bits/2, e)
+		if err != nil {
+			return nil, err
+		}
+		q, err := generateDeterministicPrime(random, bits/2, e)
+		if err != nil {
+			return nil, err
+		}
+		if p.Cmp(q) == 0 {
+			continue
+		}
+		n := new(big.Int).Mul(p, q)
+		if n.BitLen() != bits {
+			continue
+		}
+		totient := new(big.Int).Mul(new(big.Int).Sub(p, bigOne), new(big.Int).Sub(q, bigOne))
+		d := new(big.Int).ModInverse(e, totient)
+		if d == nil {
+			continue
+		}
+
+		key := &rsa.PrivateKey{
+			PublicKey: rsa.PublicKey{N: n, E: rsaPublicExp},
+			D:         d,
+			Primes:    []*big.Int{p, q},
+		}
+		key.Precompute()
+		if err := key.Validate(); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+}
+
+// generateDeterministicPrime returns the first prime p of exactly bits bits, with p-1 coprime to e, found by searching
+// upwards from a value read from random with its top two bits set so that the product of two such primes has the
+// full length
+func generateDeterministicPrime(random io.Reader, bits int, e *big.Int) (*big.Int, error) {
+	candidate := make([]byte, (bits+7)/8)
+	topBits := uint(bits % 8)
+	if topBits == 0 {
+		topBits = 8
+	}
+	for {
+		if _, err := io.ReadFull(random, candidate); err != nil {
+			return nil, err
+		}
+		candidate[0] &= uint8(int(1<<topBits) - 1)
+		if topBits >= 2 {
+			candidate[0] |= 3 << (topBits - 2)
+		} else {
+			candidate[0] |= 1
+			candidate[1] |= 0x80
+		}
+		candidate[len(candidate)-1] |= 1
+
+		p := new(big.Int).SetBytes(candidate)
+		for p.BitLen() == bits {
+			if p.ProbablyPrime(20) && new(big.Int).GCD(nil, nil, e, new(big.Int).Sub(p, bigOne)).Cmp(bigOne) == 0 {
+				return p, nil
+			}
+			p.Add(p, big.NewInt(2))
+		}
+	}
+}
+
+// generateDeterministicECDSAKey reads a scalar 64 bits longer than the curve order from random and reduces it into
+// [1, N-1], which keeps the bias negligible as in FIPS 186-4 B.4.1
+func generateDeterministicECDSAKey(curve elliptic.Curve, random io.Reader) (*ecdsa.PrivateKey, error) {
+	params := curve.Params()
+	bytes := make([]byte, (params.N.BitLen()+7)/8+8)
+	if _, err := io.ReadFull(random, bytes); err != nil {
+		return nil, err
+	}
+	d := new(big.Int).SetBytes(bytes)
+	d.Mod(d, new(big.Int).Sub(params.N, bigOne))
+	d.Add(d, bigOne)
+
+	key := &ecdsa.PrivateKey{D: d}
+	key.PublicKey.Curve = curve
+	key.PublicKey.X, key.PublicKey.Y = curve.ScalarBaseMult(d.FillBytes(make([]byte, (params.N.BitLen()+7)/8)))
+	return key, nil
+}
+
+type rfc6979Signer struct {
+	key *ecdsa.PrivateKey
+}
+
+func newRFC6979Signer(key *ecdsa.PrivateKey, err error) (crypto.Signer, error) {
+	if err != nil {
+		return nil, err
+	}
+	return &rfc6979Signer{key: key}, nil
+}
+
+func (s *rfc6979Signer) Public() crypto.PublicKey {
+	return &s.key.PublicKey
+}
+
+// Sign signs digest with a nonce derived from the private key and digest, random is ignored
+func (s *rfc6979Signer) Sign(_ io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	hash := opts.HashFunc()
+	if hash == 0 || !hash.Available() {
+		return nil, fmt.Errorf("unsupported hash function %v for deterministic ECDSA signatures", hash)
+	}
+	n := s.key.Curve.Params().N
+	e := bitsToInt(digest, n.BitLen())
+
+	nonces := newRFC6979Nonces(hash, s.key.D, n, digest)
+	for {
+		k := nonces.next()
+		x, _ := s.key.Curve.ScalarBaseMult(k.FillBytes(make([]byte, (n.BitLen()+7)/8)))
+		r := new(big.Int).Mod(x, n)
+		if r.Sign() == 0 {
+			continue
+		}
+		signature := new(big.Int).Mul(r, s.key.D)
+		signature.Add(signature, e)
+		signature.Mul(signature, new(big.Int).ModInverse(k, n))
+		signature.Mod(signature, n)
+		if signature.Sign() == 0 {
+			continue
+		}
+		return asn1.Marshal(struct{ R, S *big.Int }{r, signature})
+	}
+}
+
+// rfc6979Nonces is the HMAC_DRBG based nonce generator of RFC 6979 section 3.2
+type rfc6979Nonces struct {
+	hash crypto.Hash
+	n    *big.Int
+	k    []byte
+	v    []byte
+}
+
+func newRFC6979Nonces(hash crypto.Hash, x *big.Int, n *big.Int, digest []byte) *rfc6979Nonces {
+	size := hash.Size()
+	g := &rfc6979Nonces{hash: hash, n: n, k: make([]byte, size), v: make([]byte, size)}
+	for i := range g.v {
+		g.v[i] = 0x01
+	}
+
+	octetLength := (n.BitLen() + 7) / 8
+	privateKey := x.FillBytes(make([]byte, octetLength))
+	h1 := bitsToInt(digest, n.BitLen())
+	if h1.Cmp(n) >= 0 {
+		h1.Sub(h1, n)
+	}
+	message := h1.FillBytes(make([]byte, octetLength))
+
+	g.k = g.mac(g.k, g.v, []byte{0x00}, privateKey, message)
+	g.v = g.mac(g.k, g.v)
+	g.k = g.mac(g.k, g.v, []byte{0x01}, privateKey, message)
+	g.v = g.mac(g.k, g.v)
+	return g
+}
+
+// next returns the next candidate nonce in [1, n-1], updating the generator state so that a rejected nonce is not reused
+func (g *rfc6979Nonces) next() *big.Int {
+	for {
+		t := make([]byte, 0, (g.n.BitLen()+7)/8)
+		for len(t)*8 < g.n.BitLen() {
+			g.v = g.mac(g.k, g.v)
+			t = append(t, g.v...)
+		}
+		k := bitsToInt(t, g.n.BitLen())
+
+		g.k = g.mac(g.k, g.v, []byte{0x00})
+		g.v = g.mac(g.k, g.v)
+		if k.Sign() > 0 && k.Cmp(g.n) < 0 {
+			return k
+		}
+	}
+}
+
+func (g *rfc6979Nonces) mac(key []byte, data ...[]byte) []byte {
+	mac := hmac.New(g.hash.New, key)
+	for _, value := range data {
+		mac.Write(value)
+	}
+	return mac.Sum(nil)
+}
+
+// bitsToInt converts the leftmost bitLength bits of value to an integer, the bits2int function of RFC 6979
+func bitsToInt(value []byte, bitLength int) *big.Int {
+	result := new(big.Int).SetBytes(value)
+	if excess := len(value)*8 - bitLength; excess > 0 {
+		result.Rsh(result, uint(excess))
+	}
+	return result
+}
+
+func TestCertificateBuilder_BuildSelfSignedCertificate_ShouldBeReproducible_WhenKeySourceIsDeterministic(t *testing.T) {
+	for _, algorithm := range []KeyAlgorithm{KeyAlgorithmRSA2048, KeyAlgorithmECDSAP256, KeyAlgorithmECDSAP384} {
+		t.Run(algorithm.String(), func(t *testing.T) {
+			first, firstKey := buildDeterministicCertificate(t, algorithm, deterministicKeySource{})
+			second, secondKey := buildDeterministicCertificate(t, algorithm, deterministicKeySource{})
+
+			if !bytes.Equal(first.Raw, second.Raw) {
+				t.Fatal("certificates are not byte-identical")
+			}
+			if !bytes.Equal(firstKey, secondKey) {
+				t.Fatal("keys are not byte-identical")
+			}
+			if !first.NotBefore.Equal(fixedClock()) {
+				t.Fatalf("not before %v was not taken from the clock", first.NotBefore)
+			}
+			if err := first.CheckSignature(first.SignatureAlgorithm, first.RawTBSCertificate, first.Signature); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestRFC6979Signer_Sign_ShouldMatchPublishedVector_WhenCurveIsP256(t *testing.T) {
+	// RFC 6979 appendix A.2.5, P-256 with SHA-256 and the message "sample"
+	d, _ := new(big.Int).SetString("C9AFA9D845BA75166B5C215767B1D6934E50C3DB36E89B127B8A622B120F6721", 16)
+	key := &ecdsa.PrivateKey{D: d}
+	key.PublicKey.Curve = elliptic.P256()
+	key.PublicKey.X, key.PublicKey.Y = elliptic.P256().ScalarBaseMult(d.Bytes())
+	digest := sha256.Sum256([]byte("sample"))
+
+	signature, err := (&rfc6979Signer{key: key}).Sign(nil, digest[:], crypto.SHA256)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, _ := hex.DecodeString("3046022100EFD48B2AACB6A8FD1140DD9CD45E81D69D2C877B56AAF991C34D0EA84EAF3716022100F7CB1C942D657C41D436C7A1B6E29F65F3E900DBB9AFF4064DC4AB2F843ACDA8")
+	if !bytes.Equal(signature, expected) {
+		t.Fatalf("signature %X does not match the published vector", signature)
+	}
+	if !ecdsa.VerifyASN1(&key.PublicKey, digest[:], signature) {
+		t.Fatal("signature does not verify")
+	}
+}
@@ -0,0 +1,214 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// seededReader is a reproducible stream of bytes formed from SHA-256 of the seed and a counter
+type seededReader struct {
+	seed    []byte
+	counter uint64
+	buffer  []byte
+}
+
+func newSeededReader(seed string) *seededReader {
+	return &seededReader{seed: []byte(seed)}
+}
+
+func (r *seededReader) Read(p []byte) (int, error) {
+	for len(r.buffer) < len(p) {
+		block := make([]byte, 8)
+		binary.BigEndian.PutUint64(block, r.counter)
+		r.counter++
+		sum := sha256.Sum256(append(append([]byte{}, r.seed...), block...))
+		r.buffer = append(r.buffer, sum[:]...)
+	}
+	n := copy(p, r.buffer)
+	r.buffer = r.buffer[n:]
+	return n, nil
+}
+
+func fixedClock() time.Time {
+	return time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+}
+
+func buildDeterministicCertificate(t *testing.T, algorithm KeyAlgorithm, keySource KeySource) (*x509.Certificate, []byte) {
+	t.Helper()
+	builder := NewCertificateBuilder().
+		WithCommonName("snapshot").
+		WithKeyAlgorithm(algorithm).
+		WithDnsNames("snapshot.example.com").
+		WithClock(fixedClock).
+		WithRandom(newSeededReader("snapshot"))
+	if keySource != nil {
+		builder.WithKeySource(keySource)
+	}
+	cert, key, err := builder.BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signer, ok := key.(*rfc6979Signer); ok {
+		key = signer.key
+	}
+	keyBytes, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, keyBytes
+}
+
+func TestCertificateBuilder_BuildSelfSignedCertificate_ShouldBeReproducible_WhenKeyIsEd25519(t *testing.T) {
+	first, firstKey := buildDeterministicCertificate(t, KeyAlgorithmEd25519, nil)
+	second, secondKey := buildDeterministicCertificate(t, KeyAlgorithmEd25519, nil)
+
+	if !bytes.Equal(first.Raw, second.Raw) {
+		t.Fatal("certificates are not byte-identical")
+	}
+	if !bytes.Equal(firstKey, secondKey) {
+		t.Fatal("keys are not byte-identical")
+	}
+	if !first.NotBefore.Equal(fixedClock()) {
+		t.Fatalf("not before %v was not taken from the clock", first.NotBefore)
+	}
+	if err := first.CheckSignature(first.SignatureAlgorithm, first.RawTBSCertificate, first.Signature); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCertificateFactory_NewServerCertificate_ShouldBeReproducible_WhenClockAndRandomAreFixed(t *testing.T) {
+	build := func() []byte {
+		factory := NewCertificateFactory().
+			WithKeyAlgorithm(KeyAlgorithmEd25519).
+			WithClock(fixedClock).
+			WithRandom(newSeededReader("factory"))
+		root, err := factory.NewRootCA("Snapshot Root CA")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, _, err := factory.NewServerCertificate(root, "www.example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert.Raw
+	}
+
+	if !bytes.Equal(build(), build()) {
+		t.Fatal("certificates are not byte-identical")
+	}
+}
+
+func TestCertificateFactory_NewServerCertificate_ShouldBeReproducible_WhenKeySourceIsDeterministic(t *testing.T) {
+	build := func() []byte {
+		factory := NewCertificateFactory().
+			WithKeySource(deterministicKeySource{}).
+			WithClock(fixedClock).
+			WithRandom(newSeededReader("factory"))
+		root, err := factory.NewRootCA("Snapshot Root CA")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cert, _, err := factory.NewServerCertificate(root, "www.example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return cert.Raw
+	}
+
+	if !bytes.Equal(build(), build()) {
+		t.Fatal("certificates are not byte-identical")
+	}
+}
+
+func TestCertificateBuilder_WithKeySource_ShouldSetError_WhenValueIsNil(t *testing.T) {
+	c := NewCertificateBuilder().WithKeySource(nil)
+
+	if c.err == nil {
+		t.Fatal("error not set for nil key source")
+	}
+}
+
+func TestCertificateBuilder_WithClock_ShouldSetError_WhenValueIsNil(t *testing.T) {
+	c := NewCertificateBuilder().WithClock(nil)
+
+	if c.err == nil {
+		t.Fatal("error not set for nil clock")
+	}
+}
+
+func TestCertificateBuilder_WithRandom_ShouldSetError_WhenValueIsNil(t *testing.T) {
+	c := NewCertificateBuilder().WithRandom(nil)
+
+	if c.err == nil {
+		t.Fatal("error not set for nil random")
+	}
+}
+
+func TestWriteFile_ShouldWriteIdenticalPfx_WhenRandomIsFixed(t *testing.T) {
+	cert, keyBytes := buildDeterministicCertificate(t, KeyAlgorithmEd25519, nil)
+	key, err := x509.ParsePKCS8PrivateKey(keyBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	directory := t.TempDir()
+
+	contents := make([][]byte, 0, 2)
+	for _, name := range []string{"first.pfx", "second.pfx"} {
+		filename := filepath.Join(directory, name)
+		if err := WriteFile(filename, ExportFormatPFX, cert, key.(crypto.Signer), "password", WriteWithRandom(newSeededReader("pfx"))); err != nil {
+			t.Fatal(err)
+		}
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents = append(contents, content)
+	}
+
+	if !bytes.Equal(contents[0], contents[1]) {
+		t.Fatal("pfx files are not byte-identical")
+	}
+}
+
+func TestCertificateBuilder_ResolveKey_ShouldUseSuppliedKey_WhenKeySourceIsSet(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewCertificateBuilder().
+		WithSigner(key).
+		WithKeySource(deterministicKeySource{}).
+		WithRandom(newSeededReader("supplied"))
+
+	_, signer, err := c.resolveKey(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if signer != crypto.Signer(key) {
+		t.Fatalf("supplied key was replaced by %T", signer)
+	}
+}
@@ -0,0 +1,691 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	oidAttributeCommonName         = asn1.ObjectIdentifier{2, 5, 4, 3}
+	oidAttributeSerialNumber       = asn1.ObjectIdentifier{2, 5, 4, 5}
+	oidAttributeCountry            = asn1.ObjectIdentifier{2, 5, 4, 6}
+	oidAttributeLocality           = asn1.ObjectIdentifier{2, 5, 4, 7}
+	oidAttributeProvince           = asn1.ObjectIdentifier{2, 5, 4, 8}
+	oidAttributeStreetAddress      = asn1.ObjectIdentifier{2, 5, 4, 9}
+	oidAttributeOrganization       = asn1.ObjectIdentifier{2, 5, 4, 10}
+	oidAttributeOrganizationalUnit = asn1.ObjectIdentifier{2, 5, 4, 11}
+	oidAttributePostalCode         = asn1.ObjectIdentifier{2, 5, 4, 17}
+	oidAttributeUserID             = asn1.ObjectIdentifier{0, 9, 2342, 19200300, 100, 1, 1}
+	oidAttributeDomainComponent    = asn1.ObjectIdentifier{0, 9, 2342, 19200300, 100, 1, 25}
+	oidAttributeEmailAddress       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 1}
+)
+
+// Upper bounds, in characters, of the subject attributes from RFC 5280 appendix A and X.520
+const (
+	maxCommonNameLength             = 64
+	maxLocalityNameLength           = 128
+	maxStateNameLength              = 128
+	maxOrganizationNameLength       = 64
+	maxOrganizationalUnitNameLength = 64
+	maxStreetAddressLength          = 128
+	maxPostalCodeLength             = 40
+	maxSubjectSerialNumberLength    = 64
+	maxEmailAddressLength           = 255
+	maxDomainComponentLength        = 63
+)
+
+// SubjectStringEncoding selects the ASN.1 string type used for the directory string attributes of the subject, such as
+// the common name and organization. The country and serial number are always PrintableStrings while the domain
+// components and email address are always IA5Strings
+type SubjectStringEncoding int32
+
+const (
+	// SubjectStringEncodingDefault uses a PrintableString when the value only contains printable characters and a
+	// UTF8String otherwise, matching crypto/x509
+	SubjectStringEncodingDefault SubjectStringEncoding = iota
+	// SubjectStringEncodingUTF8 always uses a UTF8String as recommended by RFC 5280
+	SubjectStringEncodingUTF8
+	// SubjectStringEncodingPrintable always uses a PrintableString, building fails for values with other characters
+	SubjectStringEncodingPrintable
+)
+
+func (e SubjectStringEncoding) String() string {
+	switch e {
+	case SubjectStringEncodingDefault:
+		return "Default"
+	case SubjectStringEncodingUTF8:
+		return "UTF8String"
+	case SubjectStringEncodingPrintable:
+		return "PrintableString"
+	default:
+		return fmt.Sprintf("SubjectStringEncoding(%d)", int32(e))
+	}
+}
+
+// distinguishedNameKeywords maps the attribute type keywords accepted by WithDistinguishedName, those of RFC 4514 along
+// with the commonly used SERIALNUMBER, POSTALCODE and EMAILADDRESS, to their object identifiers
+var distinguishedNameKeywords = map[string]asn1.ObjectIdentifier{
+	"CN":           oidAttributeCommonName,
+	"L":            oidAttributeLocality,
+	"ST":           oidAttributeProvince,
+	"O":            oidAttributeOrganization,
+	"OU":           oidAttributeOrganizationalUnit,
+	"C":            oidAttributeCountry,
+	"STREET":       oidAttributeStreetAddress,
+	"DC":           oidAttributeDomainComponent,
+	"UID":          oidAttributeUserID,
+	"SERIALNUMBER": oidAttributeSerialNumber,
+	"POSTALCODE":   oidAttributePostalCode,
+	"EMAILADDRESS": oidAttributeEmailAddress,
+	"E":            oidAttributeEmailAddress,
+}
+
+// WithStreetAddress sets the street address lines of the subject, replacing any set previously
+func (c *CertificateBuilder) WithStreetAddress(values ...string) *CertificateBuilder {
+	values = c.validateNameValues("WithStreetAddress", values, maxStreetAddressLength)
+	if c.err != nil {
+		return c
+	}
+	c.streetAddress = values
+	c.rawSubject = nil
+	return c
+}
+
+// WithPostalCode sets the postal code of the subject, at most 40 characters
+func (c *CertificateBuilder) WithPostalCode(value string) *CertificateBuilder {
+	if err := validateDirectoryString(value, maxPostalCodeLength); err != nil {
+		c.addError("WithPostalCode", value, err)
+	}
+	if c.err != nil {
+		return c
+	}
+	c.postalCode = value
+	c.rawSubject = nil
+	return c
+}
+
+// WithSubjectSerialNumber sets the serialNumber attribute of the subject, which identifies the subject and is unrelated
+// to the serial number of the certificate. It is encoded as a PrintableString of at most 64 characters
+func (c *CertificateBuilder) WithSubjectSerialNumber(value string) *CertificateBuilder {
+	if err := validatePrintableString(value, maxSubjectSerialNumberLength); err != nil {
+		c.addError("WithSubjectSerialNumber", value, err)
+	}
+	if c.err != nil {
+		return c
+	}
+	c.subjectSerialNumber = value
+	c.rawSubject = nil
+	return c
+}
+
+// WithSubjectEmailAddress sets the emailAddress attribute of the subject, new certificates should prefer email subject
+// alternative names set with WithEmailAddresses
+func (c *CertificateBuilder) WithSubjectEmailAddress(value string) *CertificateBuilder {
+	if err := validateEmailAddress(value); err != nil {
+		c.addError("WithSubjectEmailAddress", value, err)
+	} else if len(value) > maxEmailAddressLength {
+		c.addError("WithSubjectEmailAddress", value, fmt.Errorf("%w, must be at most %d characters", ErrValueTooLong, maxEmailAddressLength))
+	} else if !isIA5String(value) {
+		c.addError("WithSubjectEmailAddress", value, fmt.Errorf("%w, must be ASCII to be encoded as an IA5String", ErrInvalidEmailAddress))
+	}
+	if c.err != nil {
+		return c
+	}
+	c.subjectEmailAddress = value
+	c.rawSubject = nil
+	return c
+}
+
+// WithDomainComponents sets the domain components of the subject, one label per value in the order they appear in the
+// domain name, so corp.example is set with WithDomainComponents("corp", "example")
+func (c *CertificateBuilder) WithDomainComponents(values ...string) *CertificateBuilder {
+	if len(values) == 0 {
+		c.addError("WithDomainComponents", values, ErrEmptyValue)
+	}
+	for _, value := range values {
+		if err := validateDomainComponent(value); err != nil {
+			c.addError("WithDomainComponents", value, err)
+		}
+	}
+	if c.err != nil {
+		return c
+	}
+	c.domainComponents = append(make([]string, 0, len(values)), values...)
+	c.rawSubject = nil
+	return c
+}
+
+// WithExtraNames adds attributes to the end of the subject, each in its own relative distinguished name, for attribute
+// types the builder has no option for
+func (c *CertificateBuilder) WithExtraNames(values ...pkix.AttributeTypeAndValue) *CertificateBuilder {
+	for _, value := range values {
+		if len(value.Type) == 0 {
+			c.addError("WithExtraNames", value, fmt.Errorf("%w, attribute type is required", ErrEmptyValue))
+		} else if value.Value == nil {
+			c.addError("WithExtraNames", value, fmt.Errorf("%w, attribute %v has no value", ErrNilValue, value.Type))
+		}
+	}
+	if c.err != nil {
+		return c
+	}
+	c.extraNames = append(c.extraNames, values...)
+	c.rawSubject = nil
+	return c
+}
+
+// WithSubjectStringEncoding selects the string type used for the directory string attributes of the subject
+func (c *CertificateBuilder) WithSubjectStringEncoding(value SubjectStringEncoding) *CertificateBuilder {
+	if value < SubjectStringEncodingDefault || value > SubjectStringEncodingPrintable {
+		c.addError("WithSubjectStringEncoding", value, ErrInvalidValue)
+	}
+	if c.err != nil {
+		return c
+	}
+	c.subjectStringEncoding = value
+	c.rawSubject = nil
+	return c
+}
+
+// WithDistinguishedName replaces the subject with the RFC 4514 distinguished name value, for example
+// "CN=svc,OU=a,OU=b,DC=corp,DC=example". Each attribute is placed in its own relative distinguished name and the
+// attributes are encoded in the same order as those set by the individual options. Names the builder cannot reproduce,
+// such as multi-valued relative distinguished names joined with '+', are rejected and leave the subject unchanged
+func (c *CertificateBuilder) WithDistinguishedName(value string) *CertificateBuilder {
+	sequence, err := parseDistinguishedName(value)
+	if err != nil {
+		c.addError("WithDistinguishedName", value, err)
+	}
+	if c.err != nil {
+		return c
+	}
+
+	subject := NewCertificateBuilder()
+	if err := applySubjectName(subject, sequence); err != nil {
+		c.addError("WithDistinguishedName", value, err)
+	} else if subject.err != nil {
+		c.addError("WithDistinguishedName", value, subject.err)
+	}
+	if c.err != nil {
+		return c
+	}
+
+	c.commonName = subject.commonName
+	c.organization = subject.organization
+	c.organizationUnit = subject.organizationUnit
+	c.city = subject.city
+	c.state = subject.state
+	c.country = subject.country
+	c.streetAddress = subject.streetAddress
+	c.postalCode = subject.postalCode
+	c.subjectSerialNumber = subject.subjectSerialNumber
+	c.subjectEmailAddress = subject.subjectEmailAddress
+	c.domainComponents = subject.domainComponents
+	c.extraNames = subject.extraNames
+	c.rawSubject = nil
+	return c
+}
+
+func (c *CertificateBuilder) validateNameValues(option string, values []string, upperBound int) []string {
+	if len(values) == 0 {
+		c.addError(option, values, ErrEmptyValue)
+	}
+	for _, value := range values {
+		if err := validateDirectoryString(value, upperBound); err != nil {
+			c.addError(option, value, err)
+		}
+	}
+	return append(make([]string, 0, len(values)), values...)
+}
+
+// validateDirectoryString checks value is non-empty, valid UTF-8 without control characters and at most upperBound
+// characters long
+func validateDirectoryString(value string, upperBound int) error {
+	if len(value) == 0 {
+		return ErrEmptyValue
+	}
+	if !utf8.ValidString(value) {
+		return fmt.Errorf("%w, value is not valid UTF-8", ErrInvalidValue)
+	}
+	for _, r := range value {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("%w, value contains the control character %U", ErrInvalidValue, r)
+		}
+	}
+	if length := utf8.RuneCountInString(value); length > upperBound {
+		return fmt.Errorf("%w, %d characters is more than the limit of %d", ErrValueTooLong, length, upperBound)
+	}
+	return nil
+}
+
+func validatePrintableString(value string, upperBound int) error {
+	if len(value) == 0 {
+		return ErrEmptyValue
+	}
+	if !isPrintableString(value) {
+		return fmt.Errorf("%w, value contains characters not permitted in a PrintableString", ErrInvalidValue)
+	}
+	if len(value) > upperBound {
+		return fmt.Errorf("%w, %d characters is more than the limit of %d", ErrValueTooLong, len(value), upperBound)
+	}
+	return nil
+}
+
+func validateCountryCode(value string) error {
+	if len(value) == 0 {
+		return ErrEmptyValue
+	}
+	if !isCountryCode(value) {
+		return ErrInvalidCountryCode
+	}
+	return nil
+}
+
+func validateDomainComponent(value string) error {
+	if len(value) == 0 {
+		return ErrEmptyValue
+	}
+	if !isIA5String(value) {
+		return fmt.Errorf("%w, domain component must be ASCII", ErrInvalidValue)
+	}
+	if strings.Contains(value, ".") {
+		return fmt.Errorf("%w, domain component must be a single label", ErrInvalidValue)
+	}
+	if len(value) > maxDomainComponentLength {
+		return fmt.Errorf("%w, %d characters is more than the limit of %d", ErrValueTooLong, len(value), maxDomainComponentLength)
+	}
+	return nil
+}
+
+// buildSubjectName returns the subject as a name along with its DER encoding. Each attribute is placed in its own
+// relative distinguished name, starting with the domain components, most significant first, followed by the country,
+// state, city, street address, postal code, organizations, organizational units, common name, serial number, email
+// address and finally the extra names. A subject copied from an existing certificate is returned unchanged until one of
+// the subject options is used
+func (c *CertificateBuilder) buildSubjectName() (pkix.Name, []byte, error) {
+	if c.rawSubject != nil {
+		sequence, err := unmarshalSubject(c.rawSubject)
+		if err != nil {
+			return pkix.Name{}, nil, fmt.Errorf("unable to decode subject: %v", err)
+		}
+		var name pkix.Name
+		name.FillFromRDNSequence(&sequence)
+		return name, append([]byte(nil), c.rawSubject...), nil
+	}
+	sequence := make(pkix.RDNSequence, 0)
+	appendAttribute := func(oid asn1.ObjectIdentifier, value interface{}) {
+		sequence = append(sequence, pkix.RelativeDistinguishedNameSET{{Type: oid, Value: value}})
+	}
+	var err error
+	appendStrings := func(oid asn1.ObjectIdentifier, values ...string) {
+		for _, value := range values {
+			if value == "" || err != nil {
+				continue
+			}
+			var encoded interface{}
+			if encoded, err = c.directoryStringValue(oid, value); err == nil {
+				appendAttribute(oid, encoded)
+			}
+		}
+	}
+
+	for i := len(c.domainComponents) - 1; i >= 0; i-- {
+		appendAttribute(oidAttributeDomainComponent, ia5StringValue(c.domainComponents[i]))
+	}
+	if c.country != "" {
+		appendAttribute(oidAttributeCountry, printableStringValue(c.country))
+	}
+	appendStrings(oidAttributeProvince, c.state)
+	appendStrings(oidAttributeLocality, c.city)
+	appendStrings(oidAttributeStreetAddress, c.streetAddress...)
+	appendStrings(oidAttributePostalCode, c.postalCode)
+	appendStrings(oidAttributeOrganization, c.organization...)
+	appendStrings(oidAttributeOrganizationalUnit, c.organizationUnit...)
+	appendStrings(oidAttributeCommonName, c.commonName)
+	if c.subjectSerialNumber != "" {
+		appendAttribute(oidAttributeSerialNumber, printableStringValue(c.subjectSerialNumber))
+	}
+	if c.subjectEmailAddress != "" {
+		appendAttribute(oidAttributeEmailAddress, ia5StringValue(c.subjectEmailAddress))
+	}
+	for _, extra := range c.extraNames {
+		if value, ok := extra.Value.(string); ok {
+			appendStrings(extra.Type, value)
+		} else {
+			appendAttribute(extra.Type, extra.Value)
+		}
+	}
+	if err != nil {
+		return pkix.Name{}, nil, err
+	}
+
+	rawSubject, err := asn1.Marshal(sequence)
+	if err != nil {
+		return pkix.Name{}, nil, fmt.Errorf("unable to encode subject: %v", err)
+	}
+	var parsed pkix.RDNSequence
+	if _, err := asn1.Unmarshal(rawSubject, &parsed); err != nil {
+		return pkix.Name{}, nil, fmt.Errorf("unable to encode subject: %v", err)
+	}
+	var name pkix.Name
+	name.FillFromRDNSequence(&parsed)
+	return name, rawSubject, nil
+}
+
+// directoryStringValue encodes value using the configured subject string encoding
+func (c *CertificateBuilder) directoryStringValue(oid asn1.ObjectIdentifier, value string) (interface{}, error) {
+	switch c.subjectStringEncoding {
+	case SubjectStringEncodingUTF8:
+		return asn1.RawValue{Tag: asn1.TagUTF8String, Bytes: []byte(value)}, nil
+	case SubjectStringEncodingPrintable:
+		if !isPrintableString(value) {
+			return nil, fmt.Errorf("subject attribute %v %q cannot be encoded as a PrintableString", oid, value)
+		}
+		return printableStringValue(value), nil
+	default:
+		return value, nil
+	}
+}
+
+func printableStringValue(value string) asn1.RawValue {
+	return asn1.RawValue{Tag: asn1.TagPrintableString, Bytes: []byte(value)}
+}
+
+func ia5StringValue(value string) asn1.RawValue {
+	return asn1.RawValue{Tag: asn1.TagIA5String, Bytes: []byte(value)}
+}
+
+// singleValuedNameAttributes lists the subject attributes the builder holds a single value of, along with the keyword
+// used to report them
+var singleValuedNameAttributes = []struct {
+	oid     asn1.ObjectIdentifier
+	keyword string
+}{
+	{oidAttributeCommonName, "CN"},
+	{oidAttributeSerialNumber, "SERIALNUMBER"},
+	{oidAttributeCountry, "C"},
+	{oidAttributeLocality, "L"},
+	{oidAttributeProvince, "ST"},
+	{oidAttributePostalCode, "POSTALCODE"},
+	{oidAttributeEmailAddress, "EMAILADDRESS"},
+}
+
+// unmarshalSubject decodes the DER encoded subject of a certificate or certificate request
+func unmarshalSubject(rawSubject []byte) (pkix.RDNSequence, error) {
+	var sequence pkix.RDNSequence
+	rest, err := asn1.Unmarshal(rawSubject, &sequence)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("trailing data after subject")
+	}
+	return sequence, nil
+}
+
+// validateSubjectName checks every attribute of sequence can be reproduced by the builder, which places each attribute
+// in its own relative distinguished name and holds a single common name, serial number, country, locality, state,
+// postal code and email address
+func validateSubjectName(sequence pkix.RDNSequence) error {
+	counts := make([]int, len(singleValuedNameAttributes))
+	for _, set := range sequence {
+		if len(set) != 1 {
+			return fmt.Errorf("%w, multi-valued relative distinguished names are not supported", ErrInvalidValue)
+		}
+		for i, attribute := range singleValuedNameAttributes {
+			if set[0].Type.Equal(attribute.oid) {
+				counts[i]++
+				if counts[i] > 1 {
+					return fmt.Errorf("%w, %s can only appear once in the subject", ErrDuplicateValue, attribute.keyword)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// applySubjectName configures builder with every attribute of sequence, attributes without an option of their own are
+// added as extra names. An error is returned rather than dropping attributes when the subject cannot be reproduced
+func applySubjectName(builder *CertificateBuilder, sequence pkix.RDNSequence) error {
+	if err := validateSubjectName(sequence); err != nil {
+		return err
+	}
+	var name pkix.Name
+	name.FillFromRDNSequence(&sequence)
+
+	if name.CommonName != "" {
+		builder.WithCommonName(name.CommonName)
+	}
+	if len(name.Organization) > 0 {
+		builder.WithOrganization(name.Organization...)
+	}
+	if len(name.OrganizationalUnit) > 0 {
+		builder.WithOrganizationUnit(name.OrganizationalUnit...)
+	}
+	if len(name.Locality) > 0 {
+		builder.WithCity(name.Locality[0])
+	}
+	if len(name.Province) > 0 {
+		builder.WithState(name.Province[0])
+	}
+	if len(name.Country) > 0 {
+		builder.WithCountry(name.Country[0])
+	}
+	if len(name.StreetAddress) > 0 {
+		builder.WithStreetAddress(name.StreetAddress...)
+	}
+	if len(name.PostalCode) > 0 {
+		builder.WithPostalCode(name.PostalCode[0])
+	}
+	if name.SerialNumber != "" {
+		builder.WithSubjectSerialNumber(name.SerialNumber)
+	}
+
+	domainComponents := make([]string, 0)
+	extraNames := make([]pkix.AttributeTypeAndValue, 0)
+	for _, attribute := range name.Names {
+		switch {
+		case isNameAttribute(attribute.Type):
+			continue
+		case attribute.Type.Equal(oidAttributeDomainComponent):
+			if value, ok := attribute.Value.(string); ok {
+				domainComponents = append([]string{value}, domainComponents...)
+				continue
+			}
+		case attribute.Type.Equal(oidAttributeEmailAddress):
+			if value, ok := attribute.Value.(string); ok {
+				builder.WithSubjectEmailAddress(value)
+				continue
+			}
+		}
+		extraNames = append(extraNames, attribute)
+	}
+	if len(domainComponents) > 0 {
+		builder.WithDomainComponents(domainComponents...)
+	}
+	if len(extraNames) > 0 {
+		builder.WithExtraNames(extraNames...)
+	}
+	return nil
+}
+
+// isNameAttribute reports whether oid is one of the attributes crypto/x509/pkix parses into the fields of pkix.Name
+func isNameAttribute(oid asn1.ObjectIdentifier) bool {
+	return containsOID([]asn1.ObjectIdentifier{
+		oidAttributeCommonName,
+		oidAttributeSerialNumber,
+		oidAttributeCountry,
+		oidAttributeLocality,
+		oidAttributeProvince,
+		oidAttributeStreetAddress,
+		oidAttributeOrganization,
+		oidAttributeOrganizationalUnit,
+		oidAttributePostalCode,
+	}, oid)
+}
+
+// parseDistinguishedName parses an RFC 4514 string representation of a distinguished name, returning its relative
+// distinguished names in encoding order, which is the reverse of the order they are written in
+func parseDistinguishedName(value string) (pkix.RDNSequence, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, ErrEmptyValue
+	}
+
+	sequence := make(pkix.RDNSequence, 0)
+	for position := 0; ; position++ {
+		attribute, next, err := parseAttributeTypeAndValue(value, position)
+		if err != nil {
+			return nil, fmt.Errorf("%w, %v", ErrInvalidValue, err)
+		}
+		sequence = append(sequence, pkix.RelativeDistinguishedNameSET{attribute})
+		if next == len(value) {
+			break
+		}
+		if value[next] == '+' {
+			return nil, fmt.Errorf("%w, multi-valued relative distinguished names are not supported", ErrInvalidValue)
+		}
+		position = next
+	}
+
+	for i, j := 0, len(sequence)-1; i < j; i, j = i+1, j-1 {
+		sequence[i], sequence[j] = sequence[j], sequence[i]
+	}
+	return sequence, nil
+}
+
+// parseAttributeTypeAndValue parses the attribute starting at position of value, returning it along with the position
+// of the separator which ends it, or the length of value for the last attribute
+func parseAttributeTypeAndValue(value string, position int) (pkix.AttributeTypeAndValue, int, error) {
+	equals := strings.IndexByte(value[position:], '=')
+	if equals < 0 {
+		return pkix.AttributeTypeAndValue{}, 0, fmt.Errorf("attribute %q has no value", strings.TrimSpace(value[position:]))
+	}
+	equals += position
+	oid, err := parseAttributeType(strings.TrimSpace(value[position:equals]))
+	if err != nil {
+		return pkix.AttributeTypeAndValue{}, 0, err
+	}
+
+	position = equals + 1
+	for position < len(value) && value[position] == ' ' {
+		position++
+	}
+	if position < len(value) && value[position] == '#' {
+		attributeValue, next, err := parseHexAttributeValue(value, position+1)
+		if err != nil {
+			return pkix.AttributeTypeAndValue{}, 0, fmt.Errorf("attribute %v: %v", oid, err)
+		}
+		return pkix.AttributeTypeAndValue{Type: oid, Value: attributeValue}, next, nil
+	}
+
+	var builder strings.Builder
+	significant := 0
+	for ; position < len(value); position++ {
+		character := value[position]
+		switch character {
+		case ',', '+', ';':
+			return stringAttribute(oid, builder.String()[:significant], position)
+		case '\\':
+			if position+1 >= len(value) {
+				return pkix.AttributeTypeAndValue{}, 0, fmt.Errorf("attribute %v ends with an incomplete escape", oid)
+			}
+			if decoded, err := hex.DecodeString(safeSlice(value, position+1, position+3)); err == nil {
+				builder.WriteByte(decoded[0])
+				position += 2
+			} else if strings.IndexByte("\"+,;<>\\#= ", value[position+1]) >= 0 {
+				builder.WriteByte(value[position+1])
+				position++
+			} else {
+				return pkix.AttributeTypeAndValue{}, 0, fmt.Errorf("attribute %v has an invalid escape \\%c", oid, value[position+1])
+			}
+			significant = builder.Len()
+		case '"', '<', '>':
+			return pkix.AttributeTypeAndValue{}, 0, fmt.Errorf("attribute %v has an unescaped %c", oid, character)
+		default:
+			builder.WriteByte(character)
+			if character != ' ' {
+				significant = builder.Len()
+			}
+		}
+	}
+	return stringAttribute(oid, builder.String()[:significant], position)
+}
+
+func stringAttribute(oid asn1.ObjectIdentifier, value string, next int) (pkix.AttributeTypeAndValue, int, error) {
+	if !utf8.ValidString(value) {
+		return pkix.AttributeTypeAndValue{}, 0, fmt.Errorf("attribute %v is not valid UTF-8", oid)
+	}
+	return pkix.AttributeTypeAndValue{Type: oid, Value: value}, next, nil
+}
+
+// parseHexAttributeValue decodes the BER encoded value of a #hexstring, values of a string type are returned as a
+// string and all others as the raw encoded value
+func parseHexAttributeValue(value string, position int) (interface{}, int, error) {
+	end := position
+	for end < len(value) && strings.IndexByte(",+;", value[end]) < 0 {
+		end++
+	}
+	encoded, err := hex.DecodeString(strings.TrimRight(value[position:end], " "))
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid hex string: %v", err)
+	}
+	var raw asn1.RawValue
+	if rest, err := asn1.Unmarshal(encoded, &raw); err != nil {
+		return nil, 0, fmt.Errorf("invalid encoded value: %v", err)
+	} else if len(rest) > 0 {
+		return nil, 0, fmt.Errorf("invalid encoded value: trailing data")
+	}
+	var text string
+	if _, err := asn1.Unmarshal(encoded, &text); err == nil {
+		return text, end, nil
+	}
+	return raw, end, nil
+}
+
+// parseAttributeType resolves a keyword or dotted decimal object identifier, optionally prefixed with "OID."
+func parseAttributeType(value string) (asn1.ObjectIdentifier, error) {
+	if oid, ok := distinguishedNameKeywords[strings.ToUpper(value)]; ok {
+		return oid, nil
+	}
+	if len(value) > 4 && strings.EqualFold(value[:4], "OID.") {
+		value = value[4:]
+	}
+	components := strings.Split(value, ".")
+	if len(components) < 2 {
+		return nil, fmt.Errorf("unknown attribute type %q", value)
+	}
+	oid := make(asn1.ObjectIdentifier, 0, len(components))
+	for _, component := range components {
+		number, err := strconv.Atoi(component)
+		if err != nil || number < 0 || (len(component) > 1 && component[0] == '0') {
+			return nil, fmt.Errorf("unknown attribute type %q", value)
+		}
+		oid = append(oid, number)
+	}
+	return oid, nil
+}
+
+func safeSlice(value string, start int, end int) string {
+	if end > len(value) {
+		end = len(value)
+	}
+	return value[start:end]
+}
@@ -0,0 +1,315 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func parseRawSubject(t *testing.T, cert *x509.Certificate) pkix.RDNSequence {
+	t.Helper()
+	var sequence pkix.RDNSequence
+	if rest, err := asn1.Unmarshal(cert.RawSubject, &sequence); err != nil {
+		t.Fatal(err)
+	} else if len(rest) > 0 {
+		t.Fatal("trailing data after subject")
+	}
+	return sequence
+}
+
+func TestCertificateBuilder_WithDistinguishedName_ShouldEncodeEachAttributeInItsOwnRDN(t *testing.T) {
+	cert, _, err := NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithDistinguishedName("CN=svc,OU=a,OU=b,DC=corp,DC=example").
+		BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		oid   asn1.ObjectIdentifier
+		value string
+	}{
+		{oidAttributeDomainComponent, "example"},
+		{oidAttributeDomainComponent, "corp"},
+		{oidAttributeOrganizationalUnit, "b"},
+		{oidAttributeOrganizationalUnit, "a"},
+		{oidAttributeCommonName, "svc"},
+	}
+	sequence := parseRawSubject(t, cert)
+	if len(sequence) != len(expected) {
+		t.Fatalf("subject %v does not have %d relative distinguished names", sequence, len(expected))
+	}
+	for i, rdn := range sequence {
+		if len(rdn) != 1 || !rdn[0].Type.Equal(expected[i].oid) || rdn[0].Value != expected[i].value {
+			t.Fatalf("relative distinguished name %d %v does not match expected %v=%v", i, rdn, expected[i].oid, expected[i].value)
+		}
+	}
+	if cert.Subject.CommonName != "svc" {
+		t.Fatalf("common name %q does not match expected svc", cert.Subject.CommonName)
+	}
+}
+
+func TestCertificateBuilder_WithDistinguishedName_ShouldDecodeEscapedAndHexValues(t *testing.T) {
+	c := NewCertificateBuilder().
+		WithDistinguishedName(`CN=Acme\, Inc.\20,O=R\2bD,OU=\#1, L = #0c06426572676e65 ,2.5.4.17=S7K 0A1,STREET=1 Main St.`)
+	if c.err != nil {
+		t.Fatal(c.err)
+	}
+
+	if c.commonName != "Acme, Inc. " {
+		t.Fatalf("common name %q does not match expected value", c.commonName)
+	}
+	if len(c.organization) != 1 || c.organization[0] != "R+D" {
+		t.Fatalf("organization %v does not match expected value", c.organization)
+	}
+	if len(c.organizationUnit) != 1 || c.organizationUnit[0] != "#1" {
+		t.Fatalf("organizational unit %v does not match expected value", c.organizationUnit)
+	}
+	if c.city != "Bergne" {
+		t.Fatalf("city %q does not match expected value", c.city)
+	}
+	if c.postalCode != "S7K 0A1" {
+		t.Fatalf("postal code %q does not match expected value", c.postalCode)
+	}
+	if len(c.streetAddress) != 1 || c.streetAddress[0] != "1 Main St." {
+		t.Fatalf("street address %v does not match expected value", c.streetAddress)
+	}
+}
+
+func TestCertificateBuilder_WithDistinguishedName_ShouldReplaceExistingSubject(t *testing.T) {
+	c := NewCertificateBuilder().
+		WithCommonName("old").
+		WithOrganization("Acme.").
+		WithDistinguishedName("CN=new")
+	if c.err != nil {
+		t.Fatal(c.err)
+	}
+
+	if c.commonName != "new" || len(c.organization) != 0 {
+		t.Fatalf("subject was not replaced, common name %q organization %v", c.commonName, c.organization)
+	}
+}
+
+func TestCertificateBuilder_WithDistinguishedName_ShouldSetError_WhenValueIsInvalid(t *testing.T) {
+	for _, value := range []string{"", "CN", "CN=a,", "XYZ=a", "CN=a\\", "CN=a\\q", "CN=\"a\"", "CN=#zz", "1.02.3=a"} {
+		c := NewCertificateBuilder().WithDistinguishedName(value)
+		if c.err == nil {
+			t.Fatalf("error was not set for invalid distinguished name %q", value)
+		}
+	}
+}
+
+func TestCertificateBuilder_WithDistinguishedName_ShouldSetError_WhenRelativeDistinguishedNameIsMultiValued(t *testing.T) {
+	c := NewCertificateBuilder().WithDistinguishedName("CN=svc+UID=42,O=Acme.")
+	if !errors.Is(c.err, ErrInvalidValue) {
+		t.Fatalf("error %v is not ErrInvalidValue", c.err)
+	}
+}
+
+func TestCertificateBuilder_WithDistinguishedName_ShouldSetError_WhenSingleValuedAttributeIsRepeated(t *testing.T) {
+	for _, value := range []string{"CN=a,CN=b", "L=a,L=b", "ST=a,ST=b", "C=CA,C=US", "2.5.4.17=a,2.5.4.17=b"} {
+		c := NewCertificateBuilder().WithDistinguishedName(value)
+		if !errors.Is(c.err, ErrDuplicateValue) {
+			t.Fatalf("error %v for %q is not ErrDuplicateValue", c.err, value)
+		}
+	}
+}
+
+func TestCertificateBuilder_WithDistinguishedName_ShouldKeepExistingSubject_WhenValueIsRejected(t *testing.T) {
+	c := NewCertificateBuilder().
+		WithCommonName("old").
+		WithOrganization("Acme.").
+		WithCity("Saskatoon").
+		WithDistinguishedName("CN=new,L=a,L=b")
+	if c.err == nil {
+		t.Fatal("error was not set for repeated locality")
+	}
+
+	if c.commonName != "old" || len(c.organization) != 1 || c.organization[0] != "Acme." || c.city != "Saskatoon" {
+		t.Fatalf("subject was modified, common name %q organization %v city %q", c.commonName, c.organization, c.city)
+	}
+}
+
+func TestCertificateBuilder_WithDomainComponents_ShouldSetError_WhenValueIsNotSingleLabel(t *testing.T) {
+	c := NewCertificateBuilder().WithDomainComponents("corp.example")
+	if !errors.Is(c.err, ErrInvalidValue) {
+		t.Fatalf("error %v is not ErrInvalidValue", c.err)
+	}
+}
+
+func TestCertificateBuilder_BuildSelfSignedCertificate_ShouldEncodeAdditionalSubjectAttributes(t *testing.T) {
+	oidTitle := asn1.ObjectIdentifier{2, 5, 4, 12}
+	cert, _, err := NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithCommonName("svc").
+		WithOrganization("Acme.", "Acme Holdings").
+		WithStreetAddress("1 Main St.").
+		WithPostalCode("S7K 0A1").
+		WithSubjectSerialNumber("1234").
+		WithSubjectEmailAddress("svc@example.com").
+		WithDomainComponents("corp", "example").
+		WithExtraNames(pkix.AttributeTypeAndValue{Type: oidTitle, Value: "Service"}).
+		BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cert.Subject.Organization) != 2 || cert.Subject.Organization[1] != "Acme Holdings" {
+		t.Fatalf("organizations %v do not match expected value", cert.Subject.Organization)
+	}
+	if cert.Subject.SerialNumber != "1234" || cert.Subject.PostalCode[0] != "S7K 0A1" || cert.Subject.StreetAddress[0] != "1 Main St." {
+		t.Fatalf("subject %v does not match expected value", cert.Subject)
+	}
+	sequence := parseRawSubject(t, cert)
+	last := sequence[len(sequence)-1][0]
+	if !last.Type.Equal(oidTitle) || last.Value != "Service" {
+		t.Fatalf("last attribute %v is not the extra name", last)
+	}
+	email := sequence[len(sequence)-2][0]
+	if !email.Type.Equal(oidAttributeEmailAddress) || email.Value != "svc@example.com" {
+		t.Fatalf("attribute %v is not the email address", email)
+	}
+	// domain components and email addresses must be IA5Strings
+	if !bytes.Contains(cert.RawSubject, []byte{asn1.TagIA5String, 7, 'e', 'x', 'a', 'm', 'p', 'l', 'e'}) {
+		t.Fatal("domain component was not encoded as an IA5String")
+	}
+}
+
+func TestNewCertificateBuilderFromCertificate_ShouldCopyFullSubject(t *testing.T) {
+	source, _, err := NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithDistinguishedName("CN=svc,E=svc@example.com,2.5.4.12=Service,OU=a,OU=b,O=Acme.,DC=corp,DC=example").
+		BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	builder, err := NewCertificateBuilderFromCertificate(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _, err := builder.BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(cert.RawSubject, source.RawSubject) {
+		t.Fatalf("subject %v does not match source %v", cert.Subject, source.Subject)
+	}
+}
+
+func TestCertificateBuilder_WithCountry_ShouldSetError_WhenValueIsNotCountryCode(t *testing.T) {
+	for _, value := range []string{"Canada", "ca", "XX", "C"} {
+		c := NewCertificateBuilder().WithCountry(value)
+		if !errors.Is(c.err, ErrInvalidCountryCode) {
+			t.Fatalf("error %v for %q is not ErrInvalidCountryCode", c.err, value)
+		}
+	}
+}
+
+func TestCertificateBuilder_WithCommonName_ShouldSetError_WhenValueExceedsUpperBound(t *testing.T) {
+	c := NewCertificateBuilder().WithCommonName(strings.Repeat("é", maxCommonNameLength))
+	if c.err != nil {
+		t.Fatalf("error %v was set for a common name of exactly %d characters", c.err, maxCommonNameLength)
+	}
+
+	c.WithCommonName(strings.Repeat("a", maxCommonNameLength+1))
+	if !errors.Is(c.err, ErrValueTooLong) {
+		t.Fatalf("error %v is not ErrValueTooLong", c.err)
+	}
+}
+
+func TestCertificateBuilder_SubjectSetters_ShouldSetError_WhenValueIsInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		apply    func(c *CertificateBuilder)
+		expected error
+	}{
+		{"organization too long", func(c *CertificateBuilder) { c.WithOrganization(strings.Repeat("a", 65)) }, ErrValueTooLong},
+		{"organizational unit too long", func(c *CertificateBuilder) { c.WithOrganizationUnit("a", strings.Repeat("a", 65)) }, ErrValueTooLong},
+		{"city too long", func(c *CertificateBuilder) { c.WithCity(strings.Repeat("a", 129)) }, ErrValueTooLong},
+		{"state control character", func(c *CertificateBuilder) { c.WithState("Sask\natchewan") }, ErrInvalidValue},
+		{"postal code too long", func(c *CertificateBuilder) { c.WithPostalCode(strings.Repeat("1", 41)) }, ErrValueTooLong},
+		{"serial number not printable", func(c *CertificateBuilder) { c.WithSubjectSerialNumber("id#1") }, ErrInvalidValue},
+		{"common name invalid UTF-8", func(c *CertificateBuilder) { c.WithCommonName("\xff") }, ErrInvalidValue},
+		{"email address not ASCII", func(c *CertificateBuilder) { c.WithSubjectEmailAddress("josé@example.com") }, ErrInvalidEmailAddress},
+	}
+	for _, test := range tests {
+		c := NewCertificateBuilder()
+		test.apply(c)
+		if !errors.Is(c.err, test.expected) {
+			t.Fatalf("%s: error %v is not %v", test.name, c.err, test.expected)
+		}
+	}
+}
+
+// rawAttributeSET decodes a relative distinguished name keeping the string type of each value
+type rawAttributeSET []struct {
+	Type  asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+func TestCertificateBuilder_WithSubjectStringEncoding_ShouldEncodeDirectoryStrings(t *testing.T) {
+	tests := []struct {
+		encoding SubjectStringEncoding
+		tag      int
+	}{
+		{SubjectStringEncodingDefault, asn1.TagPrintableString},
+		{SubjectStringEncodingUTF8, asn1.TagUTF8String},
+		{SubjectStringEncodingPrintable, asn1.TagPrintableString},
+	}
+	for _, test := range tests {
+		cert, _, err := NewCertificateBuilder().
+			WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+			WithSubjectStringEncoding(test.encoding).
+			WithCountry("CA").
+			WithCommonName("svc").
+			BuildSelfSignedCertificate()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var values []rawAttributeSET
+		if _, err := asn1.Unmarshal(cert.RawSubject, &values); err != nil {
+			t.Fatal(err)
+		}
+		if values[0][0].Value.Tag != asn1.TagPrintableString {
+			t.Fatalf("%v: country tag %d is not PrintableString", test.encoding, values[0][0].Value.Tag)
+		}
+		if values[1][0].Value.Tag != test.tag {
+			t.Fatalf("%v: common name tag %d does not match expected %d", test.encoding, values[1][0].Value.Tag, test.tag)
+		}
+		if cert.Subject.CommonName != "svc" || cert.Subject.Country[0] != "CA" {
+			t.Fatalf("%v: subject %v does not match expected value", test.encoding, cert.Subject)
+		}
+	}
+}
+
+func TestCertificateBuilder_BuildSelfSignedCertificate_ShouldReturnError_WhenValueIsNotPrintable(t *testing.T) {
+	_, _, err := NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithSubjectStringEncoding(SubjectStringEncodingPrintable).
+		WithCommonName("Zoë").
+		BuildSelfSignedCertificate()
+	if err == nil {
+		t.Fatal("error was not returned for a common name that is not a PrintableString")
+	}
+}
@@ -0,0 +1,102 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"crypto"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Sentinel errors wrapped by OptionError, use errors.Is to test the reason a builder option was rejected
+var (
+	ErrEmptyValue              = errors.New("value cannot be empty")
+	ErrNilValue                = errors.New("value cannot be nil")
+	ErrNegativeValue           = errors.New("value cannot be negative")
+	ErrDuplicateValue          = errors.New("value is included more than once")
+	ErrInvalidValue            = errors.New("invalid value")
+	ErrInvalidBitSize          = errors.New("bit size cannot be less than 2048")
+	ErrUnsupportedKeyAlgorithm = errors.New("unsupported key algorithm")
+	ErrKeyMismatch             = errors.New("keys do not match")
+	ErrInvalidDnsName          = errors.New("invalid dns name")
+	ErrInvalidIPAddress        = errors.New("invalid ip address")
+	ErrInvalidIPRange          = errors.New("invalid ip range")
+	ErrInvalidEmailAddress     = errors.New("invalid email address")
+	ErrInvalidURI              = errors.New("invalid uri")
+	ErrValueTooLong            = errors.New("value exceeds the maximum length")
+	ErrInvalidCountryCode      = errors.New("invalid ISO 3166-1 alpha-2 country code")
+	ErrWeakSignatureAlgorithm  = errors.New("signature algorithm is too weak")
+	ErrInvalidChain            = errors.New("invalid certificate chain")
+)
+
+// OptionError records a value rejected by a CertificateBuilder option
+type OptionError struct {
+	// Option is the name of the builder method, such as WithCommonName
+	Option string
+	// Value is the rejected value, for options taking several values it is the first value found to be invalid
+	Value interface{}
+	// Err is the reason the value was rejected, it wraps one of the sentinel errors
+	Err error
+}
+
+func (e *OptionError) Error() string {
+	return fmt.Sprintf("invalid argument, %s %s: %v", e.Option, formatOptionValue(e.Value), e.Err)
+}
+
+func (e *OptionError) Unwrap() error {
+	return e.Err
+}
+
+// BuilderError collects every error recorded by a CertificateBuilder, it is returned by GetError and the Build methods
+type BuilderError struct {
+	Errors []error
+}
+
+func (e *BuilderError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Unwrap returns the collected errors so that errors.Is and errors.As examine each of them
+func (e *BuilderError) Unwrap() []error {
+	return e.Errors
+}
+
+// addError records that option rejected value, any existing error is kept so every violation is reported
+func (c *CertificateBuilder) addError(option string, value interface{}, err error) {
+	optionErr := &OptionError{Option: option, Value: value, Err: err}
+	switch existing := c.err.(type) {
+	case nil:
+		c.err = &BuilderError{Errors: []error{optionErr}}
+	case *BuilderError:
+		existing.Errors = append(existing.Errors, optionErr)
+	default:
+		c.err = &BuilderError{Errors: []error{existing, optionErr}}
+	}
+}
+
+func formatOptionValue(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return fmt.Sprintf("%q", v)
+	case crypto.Signer, interface{ Equal(crypto.PublicKey) bool }:
+		return fmt.Sprintf("%T", v)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
@@ -0,0 +1,98 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+)
+
+func TestCertificateBuilder_GetError_ShouldReturnEveryViolation_WhenSeveralOptionsAreInvalid(t *testing.T) {
+	c := NewCertificateBuilder().
+		WithCommonName("").
+		WithBitSize(1024).
+		WithDnsNames("localhost", "bad name").
+		WithIPAddresses(net.IP{127, 0})
+
+	var builderErr *BuilderError
+	if !errors.As(c.GetError(), &builderErr) {
+		t.Fatalf("error %v is not a builder error", c.GetError())
+	}
+	if len(builderErr.Errors) != 4 {
+		t.Fatalf("expected 4 errors but found %d: %v", len(builderErr.Errors), builderErr)
+	}
+	expected := []string{"WithCommonName", "WithBitSize", "WithDnsNames", "WithIPAddresses"}
+	for i, err := range builderErr.Errors {
+		var optionErr *OptionError
+		if !errors.As(err, &optionErr) || optionErr.Option != expected[i] {
+			t.Fatalf("error %d (%v) is not for option %s", i, err, expected[i])
+		}
+	}
+}
+
+func TestCertificateBuilder_GetError_ShouldMatchSentinelErrors_WhenOptionsAreInvalid(t *testing.T) {
+	c := NewCertificateBuilder().
+		WithCommonName("").
+		WithBitSize(1024).
+		WithEmailAddresses("not-an-email")
+
+	for _, sentinel := range []error{ErrEmptyValue, ErrInvalidBitSize, ErrInvalidEmailAddress} {
+		if !errors.Is(c.GetError(), sentinel) {
+			t.Fatalf("error %v does not match %v", c.GetError(), sentinel)
+		}
+	}
+	if errors.Is(c.GetError(), ErrInvalidURI) {
+		t.Fatal("error unexpectedly matches an option that was not used")
+	}
+}
+
+func TestCertificateBuilder_GetError_ShouldIncludeRejectedValue_WhenOptionIsInvalid(t *testing.T) {
+	c := NewCertificateBuilder().WithDnsNames("localhost", "bad name")
+
+	var optionErr *OptionError
+	if !errors.As(c.GetError(), &optionErr) {
+		t.Fatalf("error %v is not an option error", c.GetError())
+	}
+	if optionErr.Value != "bad name" {
+		t.Fatalf("unexpected value %v", optionErr.Value)
+	}
+	if !errors.Is(optionErr, ErrInvalidDnsName) {
+		t.Fatalf("error %v does not match ErrInvalidDnsName", optionErr)
+	}
+}
+
+func TestCertificateBuilder_GetError_ShouldKeepExistingError_WhenFurtherOptionsAreInvalid(t *testing.T) {
+	c := NewCertificateBuilder()
+	existing := fmt.Errorf("sample error")
+	c.err = existing
+	c.WithCommonName("")
+
+	if !errors.Is(c.GetError(), existing) || !errors.Is(c.GetError(), ErrEmptyValue) {
+		t.Fatalf("error %v does not include every violation", c.GetError())
+	}
+}
+
+func TestCertificateBuilder_BuildSelfSignedCertificate_ShouldReturnBuilderError_WhenOptionsAreInvalid(t *testing.T) {
+	_, _, err := NewCertificateBuilder().
+		WithCommonName("").
+		WithCountry("").
+		BuildSelfSignedCertificate()
+
+	var builderErr *BuilderError
+	if !errors.As(err, &builderErr) || len(builderErr.Errors) != 2 {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+)
+
+var (
+	oidExtensionKeyUsage         = asn1.ObjectIdentifier{2, 5, 29, 15}
+	oidExtensionExtendedKeyUsage = asn1.ObjectIdentifier{2, 5, 29, 37}
+	oidExtensionBasicConstraints = asn1.ObjectIdentifier{2, 5, 29, 19}
+)
+
+// extKeyUsageOIDs maps the extended key usages known to crypto/x509 to their object identifiers
+var extKeyUsageOIDs = map[x509.ExtKeyUsage]asn1.ObjectIdentifier{
+	x509.ExtKeyUsageAny:                            {2, 5, 29, 37, 0},
+	x509.ExtKeyUsageServerAuth:                     {1, 3, 6, 1, 5, 5, 7, 3, 1},
+	x509.ExtKeyUsageClientAuth:                     {1, 3, 6, 1, 5, 5, 7, 3, 2},
+	x509.ExtKeyUsageCodeSigning:                    {1, 3, 6, 1, 5, 5, 7, 3, 3},
+	x509.ExtKeyUsageEmailProtection:                {1, 3, 6, 1, 5, 5, 7, 3, 4},
+	x509.ExtKeyUsageIPSECEndSystem:                 {1, 3, 6, 1, 5, 5, 7, 3, 5},
+	x509.ExtKeyUsageIPSECTunnel:                    {1, 3, 6, 1, 5, 5, 7, 3, 6},
+	x509.ExtKeyUsageIPSECUser:                      {1, 3, 6, 1, 5, 5, 7, 3, 7},
+	x509.ExtKeyUsageTimeStamping:                   {1, 3, 6, 1, 5, 5, 7, 3, 8},
+	x509.ExtKeyUsageOCSPSigning:                    {1, 3, 6, 1, 5, 5, 7, 3, 9},
+	x509.ExtKeyUsageMicrosoftServerGatedCrypto:     {1, 3, 6, 1, 4, 1, 311, 10, 3, 3},
+	x509.ExtKeyUsageNetscapeServerGatedCrypto:      {2, 16, 840, 1, 113730, 4, 1},
+	x509.ExtKeyUsageMicrosoftCommercialCodeSigning: {1, 3, 6, 1, 4, 1, 311, 2, 1, 22},
+	x509.ExtKeyUsageMicrosoftKernelCodeSigning:     {1, 3, 6, 1, 4, 1, 311, 61, 1, 1},
+}
+
+type basicConstraints struct {
+	IsCA       bool `asn1:"optional"`
+	MaxPathLen int  `asn1:"optional,default:-1"`
+}
+
+// marshalKeyUsageExtension encodes usage as a critical key usage extension, bit n of the BIT STRING corresponds to
+// bit n of usage
+func marshalKeyUsageExtension(usage x509.KeyUsage) (pkix.Extension, error) {
+	bits := make([]byte, 2)
+	bitLength := 0
+	for i := 0; i < 9; i++ {
+		if usage&(1<<uint(i)) != 0 {
+			bits[i/8] |= 0x80 >> uint(i%8)
+			bitLength = i + 1
+		}
+	}
+	value, err := asn1.Marshal(asn1.BitString{Bytes: bits[:(bitLength+7)/8], BitLength: bitLength})
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+	return pkix.Extension{Id: oidExtensionKeyUsage, Critical: true, Value: value}, nil
+}
+
+func marshalExtKeyUsageExtension(usages []x509.ExtKeyUsage) (pkix.Extension, error) {
+	oids := make([]asn1.ObjectIdentifier, 0, len(usages))
+	for _, usage := range usages {
+		oid, ok := extKeyUsageOIDs[usage]
+		if !ok {
+			return pkix.Extension{}, fmt.Errorf("unknown extended key usage %d", usage)
+		}
+		oids = append(oids, oid)
+	}
+	value, err := asn1.Marshal(oids)
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+	return pkix.Extension{Id: oidExtensionExtendedKeyUsage, Critical: false, Value: value}, nil
+}
+
+// marshalBasicConstraintsExtension encodes a critical basic constraints extension, maxPathLength is only included for
+// certificate authorities and a negative value leaves it unconstrained
+func marshalBasicConstraintsExtension(isCA bool, maxPathLength int) (pkix.Extension, error) {
+	if !isCA {
+		maxPathLength = -1
+	}
+	value, err := asn1.Marshal(basicConstraints{IsCA: isCA, MaxPathLen: maxPathLength})
+	if err != nil {
+		return pkix.Extension{}, err
+	}
+	return pkix.Extension{Id: oidExtensionBasicConstraints, Critical: true, Value: value}, nil
+}
+
+func parseKeyUsageExtension(value []byte) (x509.KeyUsage, error) {
+	var bits asn1.BitString
+	if rest, err := asn1.Unmarshal(value, &bits); err != nil {
+		return 0, err
+	} else if len(rest) != 0 {
+		return 0, fmt.Errorf("trailing data after key usage")
+	}
+	var usage x509.KeyUsage
+	for i := 0; i < 9; i++ {
+		if bits.At(i) != 0 {
+			usage |= 1 << uint(i)
+		}
+	}
+	return usage, nil
+}
+
+// parseExtKeyUsageExtension returns the extended key usages known to crypto/x509 along with the object identifiers
+// of any others
+func parseExtKeyUsageExtension(value []byte) ([]x509.ExtKeyUsage, []asn1.ObjectIdentifier, error) {
+	var oids []asn1.ObjectIdentifier
+	if rest, err := asn1.Unmarshal(value, &oids); err != nil {
+		return nil, nil, err
+	} else if len(rest) != 0 {
+		return nil, nil, fmt.Errorf("trailing data after extended key usage")
+	}
+	usages := make([]x509.ExtKeyUsage, 0, len(oids))
+	unknown := make([]asn1.ObjectIdentifier, 0)
+	for _, oid := range oids {
+		if usage, ok := extKeyUsageFromOID(oid); ok {
+			usages = append(usages, usage)
+		} else {
+			unknown = append(unknown, oid)
+		}
+	}
+	return usages, unknown, nil
+}
+
+func extKeyUsageFromOID(oid asn1.ObjectIdentifier) (x509.ExtKeyUsage, bool) {
+	for usage, usageOID := range extKeyUsageOIDs {
+		if usageOID.Equal(oid) {
+			return usage, true
+		}
+	}
+	return 0, false
+}
+
+func parseBasicConstraintsExtension(value []byte) (basicConstraints, error) {
+	constraints := basicConstraints{MaxPathLen: -1}
+	if rest, err := asn1.Unmarshal(value, &constraints); err != nil {
+		return constraints, err
+	} else if len(rest) != 0 {
+		return constraints, fmt.Errorf("trailing data after basic constraints")
+	}
+	return constraints, nil
+}
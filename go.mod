@@ -4,6 +4,9 @@ go 1.20
 
 require software.sslmate.com/src/go-pkcs12 v0.4.0
 
-require golang.org/x/crypto v0.25.0 // indirect
+require golang.org/x/crypto v0.25.0
 
-require golang.org/x/net v0.27.0 // indirect
+require (
+	golang.org/x/net v0.27.0
+	golang.org/x/text v0.16.0 // indirect
+)
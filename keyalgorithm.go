@@ -0,0 +1,182 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"io"
+)
+
+type KeyAlgorithm int32
+
+const (
+	KeyAlgorithmRSA2048 KeyAlgorithm = iota
+	KeyAlgorithmRSA3072
+	KeyAlgorithmRSA4096
+	KeyAlgorithmECDSAP256
+	KeyAlgorithmECDSAP384
+	KeyAlgorithmECDSAP521
+	KeyAlgorithmEd25519
+)
+
+func (a KeyAlgorithm) String() string {
+	switch a {
+	case KeyAlgorithmRSA2048:
+		return "RSA-2048"
+	case KeyAlgorithmRSA3072:
+		return "RSA-3072"
+	case KeyAlgorithmRSA4096:
+		return "RSA-4096"
+	case KeyAlgorithmECDSAP256:
+		return "ECDSA-P256"
+	case KeyAlgorithmECDSAP384:
+		return "ECDSA-P384"
+	case KeyAlgorithmECDSAP521:
+		return "ECDSA-P521"
+	case KeyAlgorithmEd25519:
+		return "Ed25519"
+	default:
+		return fmt.Sprintf("KeyAlgorithm(%d)", int32(a))
+	}
+}
+
+func (a KeyAlgorithm) isValid() bool {
+	return a >= KeyAlgorithmRSA2048 && a <= KeyAlgorithmEd25519
+}
+
+// rsaBitSize returns the modulus size for RSA algorithms and zero for everything else
+func (a KeyAlgorithm) rsaBitSize() int {
+	switch a {
+	case KeyAlgorithmRSA2048:
+		return 2048
+	case KeyAlgorithmRSA3072:
+		return 3072
+	case KeyAlgorithmRSA4096:
+		return 4096
+	default:
+		return 0
+	}
+}
+
+func (a KeyAlgorithm) publicKeyAlgorithm() x509.PublicKeyAlgorithm {
+	switch a {
+	case KeyAlgorithmRSA2048, KeyAlgorithmRSA3072, KeyAlgorithmRSA4096:
+		return x509.RSA
+	case KeyAlgorithmECDSAP256, KeyAlgorithmECDSAP384, KeyAlgorithmECDSAP521:
+		return x509.ECDSA
+	case KeyAlgorithmEd25519:
+		return x509.Ed25519
+	default:
+		return x509.UnknownPublicKeyAlgorithm
+	}
+}
+
+// KeySource generates the keys of certificates and certificate requests built without a supplied key, implementations
+// must be safe for concurrent use. random is the source set with WithRandom, or crypto/rand by default
+type KeySource interface {
+	GenerateKey(algorithm KeyAlgorithm, bitSize int, random io.Reader) (crypto.Signer, error)
+}
+
+// generateKey creates a new private key for the algorithm, bitSize is only used for RSA keys
+func (a KeyAlgorithm) generateKey(random io.Reader, bitSize int) (crypto.Signer, error) {
+	switch a {
+	case KeyAlgorithmRSA2048, KeyAlgorithmRSA3072, KeyAlgorithmRSA4096:
+		return rsa.GenerateKey(random, bitSize)
+	case KeyAlgorithmECDSAP256:
+		return ecdsa.GenerateKey(elliptic.P256(), random)
+	case KeyAlgorithmECDSAP384:
+		return ecdsa.GenerateKey(elliptic.P384(), random)
+	case KeyAlgorithmECDSAP521:
+		return ecdsa.GenerateKey(elliptic.P521(), random)
+	case KeyAlgorithmEd25519:
+		_, key, err := ed25519.GenerateKey(random)
+		return key, err
+	default:
+		return nil, fmt.Errorf("unsupported key algorithm %v", a)
+	}
+}
+
+// publicKeyAlgorithmOf returns the algorithm of key, or an error if the key is not one supported by the builder
+func publicKeyAlgorithmOf(key crypto.PublicKey) (x509.PublicKeyAlgorithm, error) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < 2048 {
+			return x509.UnknownPublicKeyAlgorithm, fmt.Errorf("RSA key size %d is less than 2048", k.N.BitLen())
+		}
+		return x509.RSA, nil
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256(), elliptic.P384(), elliptic.P521():
+			return x509.ECDSA, nil
+		default:
+			return x509.UnknownPublicKeyAlgorithm, fmt.Errorf("unsupported ECDSA curve %s", k.Curve.Params().Name)
+		}
+	case ed25519.PublicKey:
+		return x509.Ed25519, nil
+	default:
+		return x509.UnknownPublicKeyAlgorithm, fmt.Errorf("unsupported key type %T", key)
+	}
+}
+
+// keyAlgorithmOf returns the key algorithm generating keys of the same type as key along with its RSA modulus size,
+// false is returned for keys the builder cannot generate
+func keyAlgorithmOf(key crypto.PublicKey) (KeyAlgorithm, int, bool) {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		switch bits := k.N.BitLen(); bits {
+		case 2048:
+			return KeyAlgorithmRSA2048, bits, true
+		case 3072:
+			return KeyAlgorithmRSA3072, bits, true
+		default:
+			return KeyAlgorithmRSA4096, bits, bits >= 2048
+		}
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P256():
+			return KeyAlgorithmECDSAP256, 0, true
+		case elliptic.P384():
+			return KeyAlgorithmECDSAP384, 0, true
+		case elliptic.P521():
+			return KeyAlgorithmECDSAP521, 0, true
+		}
+	case ed25519.PublicKey:
+		return KeyAlgorithmEd25519, 0, true
+	}
+	return 0, 0, false
+}
+
+func publicKeysEqual(a crypto.PublicKey, b crypto.PublicKey) bool {
+	key, ok := a.(interface{ Equal(crypto.PublicKey) bool })
+	return ok && key.Equal(b)
+}
+
+// defaultKeyUsage returns the key usage used when none has been configured, key encipherment only
+// applies to RSA keys since ECDSA and Ed25519 keys can only be used for signatures
+func defaultKeyUsage(algorithm x509.PublicKeyAlgorithm, isCertificateAuthority bool) x509.KeyUsage {
+	usage := x509.KeyUsageDigitalSignature | x509.KeyUsageContentCommitment
+	if algorithm == x509.RSA {
+		usage |= x509.KeyUsageKeyEncipherment | x509.KeyUsageDataEncipherment
+	}
+	if isCertificateAuthority {
+		usage |= x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+	}
+	return usage
+}
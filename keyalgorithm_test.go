@@ -0,0 +1,217 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"fmt"
+	"testing"
+)
+
+func TestNewCertificateBuilder_ShouldReturnCertificateWithKeyAlgorithmRSA4096(t *testing.T) {
+	c := NewCertificateBuilder()
+	if c.keyAlgorithm != KeyAlgorithmRSA4096 {
+		t.Fatalf("key algorithm %v not equal to expected %v", c.keyAlgorithm, KeyAlgorithmRSA4096)
+	}
+}
+
+func TestCertificateBuilder_WithKeyAlgorithm_ShouldUpdateBitSize_WhenAlgorithmIsRSA(t *testing.T) {
+	c := NewCertificateBuilder()
+	c.WithKeyAlgorithm(KeyAlgorithmRSA3072)
+	if c.bitSize != 3072 {
+		t.Fatalf("bit size %v not equal to expected 3072", c.bitSize)
+	}
+}
+
+func TestCertificateBuilder_WithKeyAlgorithm_ShouldSetError_WhenAlgorithmIsUnknown(t *testing.T) {
+	c := NewCertificateBuilder()
+	c.WithKeyAlgorithm(KeyAlgorithm(42))
+	if c.err == nil {
+		t.Fatal("error was not set for unknown key algorithm")
+	}
+}
+
+func TestCertificateBuilder_WithKeyAlgorithm_ShouldNotUpdateKeyAlgorithm_WhenBuilderHasError(t *testing.T) {
+	c := NewCertificateBuilder()
+	c.err = fmt.Errorf("sample error")
+	c.WithKeyAlgorithm(KeyAlgorithmEd25519)
+	if c.keyAlgorithm == KeyAlgorithmEd25519 {
+		t.Fatal("key algorithm was updated when builder had error")
+	}
+}
+
+func TestCertificateBuilder_BuildSelfSignedCertificate_ShouldGenerateECDSAKey_WhenKeyAlgorithmIsECDSAP256(t *testing.T) {
+	c, key, err := NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithCommonName("localhost").
+		BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		t.Fatalf("key type %T is not *ecdsa.PrivateKey", key)
+	}
+	if ecKey.Curve != elliptic.P256() {
+		t.Fatalf("curve %v is not P-256", ecKey.Curve.Params().Name)
+	}
+	if c.KeyUsage&x509.KeyUsageKeyEncipherment != 0 {
+		t.Fatal("key encipherment was included in the default key usage of an ECDSA certificate")
+	}
+	if c.KeyUsage&x509.KeyUsageDigitalSignature == 0 {
+		t.Fatal("digital signature was not included in the default key usage of an ECDSA certificate")
+	}
+}
+
+func TestCertificateBuilder_BuildSelfSignedCertificate_ShouldGenerateEd25519Key_WhenKeyAlgorithmIsEd25519(t *testing.T) {
+	c, key, err := NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmEd25519).
+		WithCommonName("localhost").
+		BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := key.(ed25519.PrivateKey); !ok {
+		t.Fatalf("key type %T is not ed25519.PrivateKey", key)
+	}
+	if c.PublicKeyAlgorithm != x509.Ed25519 {
+		t.Fatalf("public key algorithm %v is not Ed25519", c.PublicKeyAlgorithm)
+	}
+}
+
+func TestCertificateBuilder_BuildSelfSignedCertificate_ShouldIncludeCertSignKeyUsage_WhenCertificateAuthorityUsesDefaultKeyUsage(t *testing.T) {
+	c, _, err := NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithCommonName("Acme Root CA").
+		WithIsCertificateAuthority(true).
+		WithBasicConstraint().
+		BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.KeyUsage&x509.KeyUsageCertSign == 0 {
+		t.Fatal("cert sign was not included in the default key usage of a certificate authority")
+	}
+}
+
+func TestCertificateBuilder_WithSigner_ShouldSignSelfSignedCertificateWithSuppliedKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, actual, err := NewCertificateBuilder().
+		WithCommonName("localhost").
+		WithSigner(key).
+		BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if actual != key {
+		t.Fatal("returned key is not the supplied signer")
+	}
+	if !key.PublicKey.Equal(c.PublicKey) {
+		t.Fatal("certificate public key does not match the supplied signer")
+	}
+}
+
+func TestCertificateBuilder_WithSigner_ShouldSetError_WhenKeyAlgorithmDoesNotMatch(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCertificateBuilder().WithKeyAlgorithm(KeyAlgorithmECDSAP256).WithSigner(key)
+	if c.err == nil {
+		t.Fatal("error was not set when signer does not match the configured key algorithm")
+	}
+}
+
+func TestCertificateBuilder_WithSigner_ShouldSetError_WhenCurveIsNotSupported(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCertificateBuilder().WithSigner(key)
+	if c.err == nil {
+		t.Fatal("error was not set for unsupported P-224 key")
+	}
+}
+
+func TestCertificateBuilder_WithPublicKey_ShouldSetError_WhenKeyDoesNotMatchSigner(t *testing.T) {
+	signer, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCertificateBuilder().WithSigner(signer).WithPublicKey(other.Public())
+	if c.err == nil {
+		t.Fatal("error was not set when public key does not match the signer")
+	}
+}
+
+func TestCertificateBuilder_WithPublicKey_ShouldReturnError_WhenBuildingSelfSignedCertificate(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := NewCertificateBuilder().WithCommonName("localhost").WithPublicKey(key.Public()).BuildSelfSignedCertificate(); err == nil {
+		t.Fatal("error was not returned when building a self-signed certificate without a signer")
+	}
+}
+
+func TestCertificateBuilder_WithPublicKey_ShouldCertifySuppliedKey_WhenSignedByIssuer(t *testing.T) {
+	issuer, issuerKey, err := NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithCommonName("Acme Root CA").
+		WithIsCertificateAuthority(true).
+		WithBasicConstraint().
+		BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, actual, err := NewCertificateBuilder().
+		WithCommonName("localhost").
+		WithPublicKey(key.Public()).
+		BuildSignedCertificate(issuer, issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if actual != nil {
+		t.Fatal("a key was returned when only a public key was supplied")
+	}
+	if !key.PublicKey.Equal(c.PublicKey) {
+		t.Fatal("certificate public key does not match the supplied public key")
+	}
+}
@@ -0,0 +1,307 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"crypto/x509"
+	"fmt"
+	"net"
+	"strings"
+)
+
+type nameConstraints struct {
+	critical                bool
+	permittedDnsDomains     []string
+	excludedDnsDomains      []string
+	permittedIPRanges       []*net.IPNet
+	excludedIPRanges        []*net.IPNet
+	permittedEmailAddresses []string
+	excludedEmailAddresses  []string
+	permittedURIDomains     []string
+	excludedURIDomains      []string
+}
+
+func (n *nameConstraints) isEmpty() bool {
+	return len(n.permittedDnsDomains) == 0 && len(n.excludedDnsDomains) == 0 &&
+		len(n.permittedIPRanges) == 0 && len(n.excludedIPRanges) == 0 &&
+		len(n.permittedEmailAddresses) == 0 && len(n.excludedEmailAddresses) == 0 &&
+		len(n.permittedURIDomains) == 0 && len(n.excludedURIDomains) == 0
+}
+
+// WithPermittedDnsDomains restricts the DNS names of certificates issued by this certificate authority to the given
+// domains and their subdomains, a leading "." only permits subdomains
+func (c *CertificateBuilder) WithPermittedDnsDomains(values ...string) *CertificateBuilder {
+	domains := c.normalizeDomainConstraints("WithPermittedDnsDomains", values)
+	if c.err != nil {
+		return c
+	}
+	c.nameConstraints.permittedDnsDomains = append(c.nameConstraints.permittedDnsDomains, domains...)
+	return c
+}
+
+// WithExcludedDnsDomains prevents this certificate authority issuing certificates for the given domains and their
+// subdomains, a leading "." only excludes subdomains
+func (c *CertificateBuilder) WithExcludedDnsDomains(values ...string) *CertificateBuilder {
+	domains := c.normalizeDomainConstraints("WithExcludedDnsDomains", values)
+	if c.err != nil {
+		return c
+	}
+	c.nameConstraints.excludedDnsDomains = append(c.nameConstraints.excludedDnsDomains, domains...)
+	return c
+}
+
+// WithPermittedIPRanges restricts the IP addresses of certificates issued by this certificate authority to the given ranges
+func (c *CertificateBuilder) WithPermittedIPRanges(values ...*net.IPNet) *CertificateBuilder {
+	for _, value := range values {
+		if err := validateIPRange(value); err != nil {
+			c.addError("WithPermittedIPRanges", value, err)
+		}
+	}
+	if c.err != nil {
+		return c
+	}
+	c.nameConstraints.permittedIPRanges = append(c.nameConstraints.permittedIPRanges, values...)
+	return c
+}
+
+// WithExcludedIPRanges prevents this certificate authority issuing certificates for addresses in the given ranges
+func (c *CertificateBuilder) WithExcludedIPRanges(values ...*net.IPNet) *CertificateBuilder {
+	for _, value := range values {
+		if err := validateIPRange(value); err != nil {
+			c.addError("WithExcludedIPRanges", value, err)
+		}
+	}
+	if c.err != nil {
+		return c
+	}
+	c.nameConstraints.excludedIPRanges = append(c.nameConstraints.excludedIPRanges, values...)
+	return c
+}
+
+// WithPermittedEmailAddresses restricts the email addresses of certificates issued by this certificate authority, each
+// value is either a mailbox, a host or a domain with a leading "." matching any of its subdomains
+func (c *CertificateBuilder) WithPermittedEmailAddresses(values ...string) *CertificateBuilder {
+	for _, value := range values {
+		if err := validateEmailConstraint(value); err != nil {
+			c.addError("WithPermittedEmailAddresses", value, err)
+		}
+	}
+	if c.err != nil {
+		return c
+	}
+	c.nameConstraints.permittedEmailAddresses = append(c.nameConstraints.permittedEmailAddresses, values...)
+	return c
+}
+
+// WithExcludedEmailAddresses prevents this certificate authority issuing certificates for the given mailboxes, hosts or
+// domains with a leading "."
+func (c *CertificateBuilder) WithExcludedEmailAddresses(values ...string) *CertificateBuilder {
+	for _, value := range values {
+		if err := validateEmailConstraint(value); err != nil {
+			c.addError("WithExcludedEmailAddresses", value, err)
+		}
+	}
+	if c.err != nil {
+		return c
+	}
+	c.nameConstraints.excludedEmailAddresses = append(c.nameConstraints.excludedEmailAddresses, values...)
+	return c
+}
+
+// WithPermittedURIDomains restricts the hosts of URIs in certificates issued by this certificate authority, a leading
+// "." matches any subdomain otherwise the host must match exactly
+func (c *CertificateBuilder) WithPermittedURIDomains(values ...string) *CertificateBuilder {
+	domains := c.normalizeDomainConstraints("WithPermittedURIDomains", values)
+	if c.err != nil {
+		return c
+	}
+	c.nameConstraints.permittedURIDomains = append(c.nameConstraints.permittedURIDomains, domains...)
+	return c
+}
+
+// WithExcludedURIDomains prevents this certificate authority issuing certificates with URIs whose host matches the
+// given domains
+func (c *CertificateBuilder) WithExcludedURIDomains(values ...string) *CertificateBuilder {
+	domains := c.normalizeDomainConstraints("WithExcludedURIDomains", values)
+	if c.err != nil {
+		return c
+	}
+	c.nameConstraints.excludedURIDomains = append(c.nameConstraints.excludedURIDomains, domains...)
+	return c
+}
+
+// WithNameConstraintsCritical sets whether the name constraints extension is marked critical
+func (c *CertificateBuilder) WithNameConstraintsCritical(value bool) *CertificateBuilder {
+	if c.err != nil {
+		return c
+	}
+	c.nameConstraints.critical = value
+	return c
+}
+
+// normalizeDomainConstraints returns the ASCII form of each valid domain, recording an error against option for the others
+func (c *CertificateBuilder) normalizeDomainConstraints(option string, values []string) []string {
+	domains := make([]string, 0, len(values))
+	for _, value := range values {
+		domain, err := normalizeDomainConstraint(value)
+		if err != nil {
+			c.addError(option, value, err)
+			continue
+		}
+		domains = append(domains, domain)
+	}
+	return domains
+}
+
+func normalizeDomainConstraint(value string) (string, error) {
+	domain := strings.TrimPrefix(value, ".")
+	if domain == "" {
+		return "", ErrEmptyValue
+	}
+	ascii, err := dnsNameProfile.ToASCII(domain)
+	if err != nil {
+		return "", fmt.Errorf("%w, %v", ErrInvalidDnsName, err)
+	}
+	if strings.HasPrefix(value, ".") {
+		ascii = "." + ascii
+	}
+	return ascii, nil
+}
+
+func validateIPRange(value *net.IPNet) error {
+	if value == nil {
+		return ErrNilValue
+	}
+	if _, bits := value.Mask.Size(); bits == 0 || (len(value.IP) != net.IPv4len && len(value.IP) != net.IPv6len) || bits != len(value.IP)*8 {
+		return ErrInvalidIPRange
+	}
+	return nil
+}
+
+func validateEmailConstraint(value string) error {
+	if strings.Contains(value, "@") {
+		return validateEmailAddress(value)
+	}
+	if _, err := normalizeDomainConstraint(value); err != nil {
+		return fmt.Errorf("%w, %v", ErrInvalidEmailAddress, err)
+	}
+	return nil
+}
+
+// checkNameConstraints verifies that the subject alternative names of template satisfy the name constraints of issuer
+// so that violations are found when the certificate is built rather than when it is first verified
+func checkNameConstraints(issuer *x509.Certificate, template *x509.Certificate) error {
+	for _, name := range template.DNSNames {
+		if err := checkConstraints("dns name", name, issuer.PermittedDNSDomains, issuer.ExcludedDNSDomains, matchDomainConstraint); err != nil {
+			return err
+		}
+	}
+	for _, ip := range template.IPAddresses {
+		if err := checkIPConstraints(ip, issuer.PermittedIPRanges, issuer.ExcludedIPRanges); err != nil {
+			return err
+		}
+	}
+	for _, email := range template.EmailAddresses {
+		if err := checkConstraints("email address", email, issuer.PermittedEmailAddresses, issuer.ExcludedEmailAddresses, matchEmailConstraint); err != nil {
+			return err
+		}
+	}
+	for _, uri := range template.URIs {
+		if len(issuer.PermittedURIDomains) == 0 && len(issuer.ExcludedURIDomains) == 0 {
+			break
+		}
+		host := uri.Hostname()
+		if host == "" || net.ParseIP(host) != nil {
+			return fmt.Errorf("uri %q does not have a domain that can be checked against the name constraints of %q", uri, issuer.Subject.CommonName)
+		}
+		if err := checkConstraints("uri", host, issuer.PermittedURIDomains, issuer.ExcludedURIDomains, matchHostConstraint); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func checkConstraints(kind string, name string, permitted []string, excluded []string, match func(string, string) bool) error {
+	for _, constraint := range excluded {
+		if match(name, constraint) {
+			return fmt.Errorf("%s %q is excluded by name constraint %q", kind, name, constraint)
+		}
+	}
+	if len(permitted) == 0 {
+		return nil
+	}
+	for _, constraint := range permitted {
+		if match(name, constraint) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s %q is not permitted by the name constraints of the issuer", kind, name)
+}
+
+func checkIPConstraints(ip net.IP, permitted []*net.IPNet, excluded []*net.IPNet) error {
+	for _, constraint := range excluded {
+		if matchIPConstraint(ip, constraint) {
+			return fmt.Errorf("ip address %v is excluded by name constraint %v", ip, constraint)
+		}
+	}
+	if len(permitted) == 0 {
+		return nil
+	}
+	for _, constraint := range permitted {
+		if matchIPConstraint(ip, constraint) {
+			return nil
+		}
+	}
+	return fmt.Errorf("ip address %v is not permitted by the name constraints of the issuer", ip)
+}
+
+func matchIPConstraint(ip net.IP, constraint *net.IPNet) bool {
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	return len(ip) == len(constraint.IP) && constraint.Contains(ip)
+}
+
+// matchDomainConstraint reports whether name is constraint or one of its subdomains, a constraint with a leading "."
+// only matches subdomains
+func matchDomainConstraint(name string, constraint string) bool {
+	name = strings.ToLower(name)
+	constraint = strings.ToLower(constraint)
+	if constraint == "" {
+		return true
+	}
+	if strings.HasPrefix(constraint, ".") {
+		return strings.HasSuffix(name, constraint)
+	}
+	return name == constraint || strings.HasSuffix(name, "."+constraint)
+}
+
+// matchHostConstraint reports whether host is exactly constraint, or one of its subdomains when constraint has a leading "."
+func matchHostConstraint(host string, constraint string) bool {
+	host = strings.ToLower(host)
+	constraint = strings.ToLower(constraint)
+	if strings.HasPrefix(constraint, ".") {
+		return strings.HasSuffix(host, constraint)
+	}
+	return host == constraint
+}
+
+// matchEmailConstraint matches a mailbox exactly when constraint contains "@", otherwise the host of the mailbox is matched
+func matchEmailConstraint(email string, constraint string) bool {
+	if strings.Contains(constraint, "@") {
+		return strings.EqualFold(email, constraint)
+	}
+	at := strings.LastIndex(email, "@")
+	return matchHostConstraint(email[at+1:], constraint)
+}
@@ -0,0 +1,143 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"crypto/x509"
+	"net"
+	"testing"
+	"time"
+)
+
+func newTestConstrainedCertificateAuthority(t *testing.T, root *CertificateAuthority) *CertificateAuthority {
+	t.Helper()
+	_, excluded, _ := net.ParseCIDR("10.1.0.0/16")
+	cert, key, err := NewCertificateBuilder().
+		WithCommonName("Team Sandbox CA").
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithIsCertificateAuthority(true).
+		WithMaxPathLength(0).
+		WithPermittedDnsDomains("sandbox.example.com").
+		WithExcludedDnsDomains("secret.sandbox.example.com").
+		WithExcludedIPRanges(excluded).
+		WithNameConstraintsCritical(true).
+		WithNotBefore(time.Now().Add(-time.Minute)).
+		WithNotAfter(time.Now().Add(24*time.Hour)).
+		BuildSignedCertificate(root.Certificate, root.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &CertificateAuthority{Certificate: cert, Key: key}
+}
+
+func newTestLeafBuilder(dnsNames ...string) *CertificateBuilder {
+	return NewCertificateBuilder().
+		WithCommonName(dnsNames[0]).
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithDnsNames(dnsNames...).
+		WithEnhancedKeyUsage(x509.ExtKeyUsageServerAuth).
+		WithNotBefore(time.Now().Add(-time.Minute)).
+		WithNotAfter(time.Now().Add(time.Hour))
+}
+
+func TestCertificateBuilder_WithMaxPathLength_ShouldSetError_WhenValueIsNegative(t *testing.T) {
+	c := NewCertificateBuilder().WithMaxPathLength(-1)
+
+	if c.err == nil {
+		t.Fatal("error not set for negative max path length")
+	}
+}
+
+func TestCertificateBuilder_WithPermittedDnsDomains_ShouldSetError_WhenDomainIsInvalid(t *testing.T) {
+	c := NewCertificateBuilder().WithPermittedDnsDomains("bad domain")
+
+	if c.err == nil {
+		t.Fatal("error not set for invalid domain")
+	}
+}
+
+func TestCertificateBuilder_BuildSelfSignedCertificate_ShouldReturnError_WhenNameConstraintsAppliedToEndEntity(t *testing.T) {
+	_, _, err := NewCertificateBuilder().
+		WithCommonName("leaf").
+		WithPermittedDnsDomains("example.com").
+		BuildSelfSignedCertificate()
+
+	if err == nil {
+		t.Fatal("expected an error for name constraints on an end entity certificate")
+	}
+}
+
+func TestCertificateBuilder_BuildSignedCertificate_ShouldIncludeConstraints_WhenCertificateAuthority(t *testing.T) {
+	_, root, _ := newTestCertificateAuthorities(t)
+	ca := newTestConstrainedCertificateAuthority(t, root)
+
+	if ca.Certificate.MaxPathLen != 0 || !ca.Certificate.MaxPathLenZero {
+		t.Fatalf("max path length %d not zero", ca.Certificate.MaxPathLen)
+	}
+	if !ca.Certificate.PermittedDNSDomainsCritical {
+		t.Fatal("name constraints not critical")
+	}
+	if len(ca.Certificate.PermittedDNSDomains) != 1 || ca.Certificate.PermittedDNSDomains[0] != "sandbox.example.com" {
+		t.Fatalf("unexpected permitted domains %v", ca.Certificate.PermittedDNSDomains)
+	}
+	if len(ca.Certificate.ExcludedIPRanges) != 1 {
+		t.Fatalf("unexpected excluded ip ranges %v", ca.Certificate.ExcludedIPRanges)
+	}
+}
+
+func TestCertificateBuilder_BuildSignedCertificate_ShouldSucceed_WhenNamesArePermitted(t *testing.T) {
+	_, root, _ := newTestCertificateAuthorities(t)
+	ca := newTestConstrainedCertificateAuthority(t, root)
+
+	cert, _, err := newTestLeafBuilder("api.sandbox.example.com", "sandbox.example.com").BuildSignedCertificate(ca.Certificate, ca.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifyChain(t, root, ca, cert, x509.VerifyOptions{DNSName: "api.sandbox.example.com"})
+}
+
+func TestCertificateBuilder_BuildSignedCertificate_ShouldReturnError_WhenNameIsNotPermitted(t *testing.T) {
+	_, root, _ := newTestCertificateAuthorities(t)
+	ca := newTestConstrainedCertificateAuthority(t, root)
+
+	if _, _, err := newTestLeafBuilder("api.example.org").BuildSignedCertificate(ca.Certificate, ca.Key); err == nil {
+		t.Fatal("expected an error for a dns name outside the permitted domains")
+	}
+}
+
+func TestCertificateBuilder_BuildSignedCertificate_ShouldReturnError_WhenNameIsExcluded(t *testing.T) {
+	_, root, _ := newTestCertificateAuthorities(t)
+	ca := newTestConstrainedCertificateAuthority(t, root)
+
+	if _, _, err := newTestLeafBuilder("db.secret.sandbox.example.com").BuildSignedCertificate(ca.Certificate, ca.Key); err == nil {
+		t.Fatal("expected an error for an excluded dns name")
+	}
+	if _, _, err := newTestLeafBuilder("api.sandbox.example.com").
+		WithIPAddresses(net.ParseIP("10.1.2.3")).
+		BuildSignedCertificate(ca.Certificate, ca.Key); err == nil {
+		t.Fatal("expected an error for an excluded ip address")
+	}
+}
+
+func TestMatchDomainConstraint_ShouldOnlyMatchSubdomains_WhenConstraintHasLeadingDot(t *testing.T) {
+	if matchDomainConstraint("example.com", ".example.com") {
+		t.Fatal("leading dot constraint matched the domain itself")
+	}
+	if !matchDomainConstraint("www.Example.com", ".example.com") {
+		t.Fatal("leading dot constraint did not match subdomain")
+	}
+	if matchDomainConstraint("badexample.com", "example.com") {
+		t.Fatal("constraint matched a different domain with the same suffix")
+	}
+}
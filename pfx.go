@@ -0,0 +1,511 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"crypto"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"hash"
+	"io"
+	"software.sslmate.com/src/go-pkcs12"
+	"unicode/utf16"
+)
+
+var (
+	oidDataContentType               = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidEncryptedDataContentType      = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 6}
+	oidPBEWithSHAAnd3KeyTripleDESCBC = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 1, 3}
+	oidPKCS8ShroudedKeyBag           = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidCertBag                       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidCertTypeX509Certificate       = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidFriendlyName                  = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 20}
+	oidLocalKeyID                    = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 21}
+	oidSHA1                          = asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26}
+	oidSHA256                        = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+)
+
+// PfxProfile selects the algorithms protecting a PFX file
+type PfxProfile int32
+
+const (
+	// PfxProfileLegacyRC2 encrypts certificates with 40-bit RC2 and keys with 3DES, matching pkcs12.LegacyRC2 and
+	// OpenSSL before 3.0. It is the default but OpenSSL 3 cannot read it without the legacy provider
+	PfxProfileLegacyRC2 PfxProfile = iota
+	// PfxProfileLegacyDES encrypts certificates and keys with 3DES and uses a SHA-1 MAC, matching pkcs12.LegacyDES.
+	// It is readable by the widest range of software including older versions of Windows
+	PfxProfileLegacyDES
+	// PfxProfileModern encrypts certificates and keys with PBES2, PBKDF2-HMAC-SHA256 and AES-256-CBC and uses a SHA-256
+	// MAC, matching pkcs12.Modern and the defaults of OpenSSL 3
+	PfxProfileModern
+)
+
+func (p PfxProfile) String() string {
+	switch p {
+	case PfxProfileLegacyRC2:
+		return "LegacyRC2"
+	case PfxProfileLegacyDES:
+		return "LegacyDES"
+	case PfxProfileModern:
+		return "Modern"
+	default:
+		return fmt.Sprintf("PfxProfile(%d)", int32(p))
+	}
+}
+
+// encoder returns the go-pkcs12 encoder implementing the profile
+func (p PfxProfile) encoder(random io.Reader) (*pkcs12.Encoder, error) {
+	switch p {
+	case PfxProfileLegacyRC2:
+		return pkcs12.LegacyRC2.WithRand(random), nil
+	case PfxProfileLegacyDES:
+		return pkcs12.LegacyDES.WithRand(random), nil
+	case PfxProfileModern:
+		return pkcs12.Modern.WithRand(random), nil
+	default:
+		return nil, fmt.Errorf("unsupported pfx profile %v", p)
+	}
+}
+
+// The iteration counts and salt sizes match those of the go-pkcs12 encoders for the same profile
+const (
+	pfxIterations      = 2048
+	pfxLegacySaltSize  = 8
+	pfxLegacyMacRounds = 1
+)
+
+type pfxPdu struct {
+	Version  int
+	AuthSafe pfxContentInfo
+	MacData  pfxMacData `asn1:"optional"`
+}
+
+type pfxContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue `asn1:"tag:0,explicit,optional"`
+}
+
+type pfxEncryptedData struct {
+	Version              int
+	EncryptedContentInfo pfxEncryptedContentInfo
+}
+
+type pfxEncryptedContentInfo struct {
+	ContentType                asn1.ObjectIdentifier
+	ContentEncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedContent           []byte `asn1:"tag:0,optional"`
+}
+
+type pfxMacData struct {
+	Mac        pfxDigestInfo
+	MacSalt    []byte
+	Iterations int `asn1:"optional,default:1"`
+}
+
+type pfxDigestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type pfxSafeBag struct {
+	Id         asn1.ObjectIdentifier
+	Value      asn1.RawValue  `asn1:"tag:0,explicit"`
+	Attributes []pfxAttribute `asn1:"set,optional"`
+}
+
+type pfxAttribute struct {
+	Id    asn1.ObjectIdentifier
+	Value asn1.RawValue `asn1:"set"`
+}
+
+type pfxCertBag struct {
+	Id   asn1.ObjectIdentifier
+	Data []byte `asn1:"tag:0,explicit"`
+}
+
+type pbeParameters struct {
+	Salt       []byte
+	Iterations int
+}
+
+// pfxContents describes what is written to a PFX file, key is nil for trust stores
+type pfxContents struct {
+	key          crypto.Signer
+	certificate  *x509.Certificate
+	chain        []*x509.Certificate
+	friendlyName string
+	localKeyID   []byte
+}
+
+// encodePfx writes the certificate, chain and key of contents as a PFX file. go-pkcs12 encodes the file unless a friendly
+// name or local key ID is set, which go-pkcs12 cannot add to the bags of the certificate and key, in which case the file
+// is encoded with the same layout and algorithms here. The RC2 cipher of PfxProfileLegacyRC2 is only available through
+// go-pkcs12, so that profile cannot carry these attributes
+func encodePfx(w io.Writer, contents pfxContents, password string, profile PfxProfile, random io.Reader) error {
+	if contents.certificate == nil {
+		return fmt.Errorf("invalid argument, certificate cannot be nil")
+	}
+	if contents.key == nil {
+		return fmt.Errorf("invalid argument, key cannot be nil")
+	}
+	encoder, err := profile.encoder(random)
+	if err != nil {
+		return err
+	}
+
+	var pfxBytes []byte
+	switch {
+	case contents.friendlyName == "" && contents.localKeyID == nil:
+		pfxBytes, err = encoder.Encode(contents.key, contents.certificate, contents.chain, password)
+	case profile == PfxProfileLegacyRC2:
+		return fmt.Errorf("friendly names and local key ids are not supported by the %v profile, use %v or %v", profile, PfxProfileLegacyDES, PfxProfileModern)
+	default:
+		pfxBytes, err = newPfxEncoder(profile, password, random).encode(contents)
+	}
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(pfxBytes)
+	return err
+}
+
+// encodePfxTrustStore writes the certificate and chain of contents without a key, each trusted for any purpose in the
+// form Java expects of a trust store. The certificate is named friendlyName, or its subject when empty, and the chain
+// by their subjects
+func encodePfxTrustStore(w io.Writer, contents pfxContents, password string, profile PfxProfile, random io.Reader) error {
+	if contents.certificate == nil {
+		return fmt.Errorf("invalid argument, certificate cannot be nil")
+	}
+	if contents.localKeyID != nil {
+		return fmt.Errorf("local key ids only apply to PFX files with a key")
+	}
+	encoder, err := profile.encoder(random)
+	if err != nil {
+		return err
+	}
+	friendlyName := contents.friendlyName
+	if friendlyName == "" {
+		friendlyName = contents.certificate.Subject.String()
+	}
+	entries := []pkcs12.TrustStoreEntry{{Cert: contents.certificate, FriendlyName: friendlyName}}
+	for _, cert := range contents.chain {
+		entries = append(entries, pkcs12.TrustStoreEntry{Cert: cert, FriendlyName: cert.Subject.String()})
+	}
+	pfxBytes, err := encoder.EncodeTrustStoreEntries(entries, password)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(pfxBytes)
+	return err
+}
+
+// pfxEncoder builds PKCS#12 files as described by RFC 7292, following the layout of OpenSSL's PKCS12_create and
+// go-pkcs12 with certificates in an encrypted safe and the shrouded key in a plain one
+type pfxEncoder struct {
+	profile  PfxProfile
+	password string
+	random   io.Reader
+}
+
+func newPfxEncoder(profile PfxProfile, password string, random io.Reader) *pfxEncoder {
+	return &pfxEncoder{profile: profile, password: password, random: random}
+}
+
+// encode writes the certificate, chain and key of contents. The certificate and key both carry the friendly name and
+// local key ID, which defaults to the SHA-1 hash of the certificate as it does with go-pkcs12
+func (e *pfxEncoder) encode(contents pfxContents) ([]byte, error) {
+	localKeyID := contents.localKeyID
+	if localKeyID == nil {
+		fingerprint := sha1.Sum(contents.certificate.Raw)
+		localKeyID = fingerprint[:]
+	}
+	var attributes []pfxAttribute
+	if contents.friendlyName != "" {
+		friendlyName, err := newPfxFriendlyNameAttribute(contents.friendlyName)
+		if err != nil {
+			return nil, err
+		}
+		attributes = append(attributes, friendlyName)
+	}
+	localKeyIDAttribute, err := newPfxAttribute(oidLocalKeyID, localKeyID)
+	if err != nil {
+		return nil, err
+	}
+	attributes = append(attributes, localKeyIDAttribute)
+
+	certBags := make([]pfxSafeBag, 0, len(contents.chain)+1)
+	for i, cert := range append([]*x509.Certificate{contents.certificate}, contents.chain...) {
+		var bagAttributes []pfxAttribute
+		if i == 0 {
+			bagAttributes = attributes
+		}
+		bag, err := newPfxCertBag(cert, bagAttributes)
+		if err != nil {
+			return nil, err
+		}
+		certBags = append(certBags, bag)
+	}
+	certSafe, err := e.encryptedSafeContents(certBags)
+	if err != nil {
+		return nil, err
+	}
+	keyBag, err := e.shroudedKeyBag(contents.key, attributes)
+	if err != nil {
+		return nil, err
+	}
+	keySafe, err := plainSafeContents([]pfxSafeBag{keyBag})
+	if err != nil {
+		return nil, err
+	}
+
+	authenticatedSafeBytes, err := asn1.Marshal([]pfxContentInfo{certSafe, keySafe})
+	if err != nil {
+		return nil, err
+	}
+	macData, err := e.mac(authenticatedSafeBytes)
+	if err != nil {
+		return nil, err
+	}
+	content, err := asn1.Marshal(authenticatedSafeBytes)
+	if err != nil {
+		return nil, err
+	}
+	return asn1.Marshal(pfxPdu{
+		Version:  3,
+		AuthSafe: pfxContentInfo{ContentType: oidDataContentType, Content: explicitContent(content)},
+		MacData:  macData,
+	})
+}
+
+// encrypt encrypts data with the algorithm of the profile, returning the algorithm identifier describing it
+func (e *pfxEncoder) encrypt(data []byte) (pkix.AlgorithmIdentifier, []byte, error) {
+	if e.profile == PfxProfileModern {
+		return encryptPBES2(data, []byte(e.password), KeyDerivationPBKDF2, pfxIterations, e.random)
+	}
+
+	salt := make([]byte, pfxLegacySaltSize)
+	if _, err := io.ReadFull(e.random, salt); err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+	password, err := bmpPassword(e.password)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+	key := pkcs12KeyDerivation(sha1.New, password, salt, pfxIterations, 1, 24)
+	iv := pkcs12KeyDerivation(sha1.New, password, salt, pfxIterations, 2, des.BlockSize)
+	block, err := des.NewTripleDESCipher(key)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+	plaintext := padBlocks(data, des.BlockSize)
+	encrypted := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, plaintext)
+
+	parameters, err := asn1.Marshal(pbeParameters{Salt: salt, Iterations: pfxIterations})
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+	return pkix.AlgorithmIdentifier{Algorithm: oidPBEWithSHAAnd3KeyTripleDESCBC, Parameters: asn1.RawValue{FullBytes: parameters}}, encrypted, nil
+}
+
+func (e *pfxEncoder) encryptedSafeContents(bags []pfxSafeBag) (pfxContentInfo, error) {
+	data, err := asn1.Marshal(bags)
+	if err != nil {
+		return pfxContentInfo{}, err
+	}
+	algorithm, encrypted, err := e.encrypt(data)
+	if err != nil {
+		return pfxContentInfo{}, err
+	}
+	content, err := asn1.Marshal(pfxEncryptedData{
+		EncryptedContentInfo: pfxEncryptedContentInfo{
+			ContentType:                oidDataContentType,
+			ContentEncryptionAlgorithm: algorithm,
+			EncryptedContent:           encrypted,
+		},
+	})
+	if err != nil {
+		return pfxContentInfo{}, err
+	}
+	return pfxContentInfo{ContentType: oidEncryptedDataContentType, Content: explicitContent(content)}, nil
+}
+
+func (e *pfxEncoder) shroudedKeyBag(key crypto.Signer, attributes []pfxAttribute) (pfxSafeBag, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return pfxSafeBag{}, err
+	}
+	algorithm, encrypted, err := e.encrypt(der)
+	if err != nil {
+		return pfxSafeBag{}, err
+	}
+	value, err := asn1.Marshal(encryptedPrivateKeyInfo{EncryptionAlgorithm: algorithm, EncryptedData: encrypted})
+	if err != nil {
+		return pfxSafeBag{}, err
+	}
+	return pfxSafeBag{Id: oidPKCS8ShroudedKeyBag, Value: explicitContent(value), Attributes: attributes}, nil
+}
+
+// mac authenticates data with an HMAC keyed from the password, SHA-1 for the legacy profiles and SHA-256 otherwise
+func (e *pfxEncoder) mac(data []byte) (pfxMacData, error) {
+	newHash, algorithm, saltSize, iterations := sha1.New, oidSHA1, pfxLegacySaltSize, pfxLegacyMacRounds
+	if e.profile == PfxProfileModern {
+		newHash, algorithm, saltSize, iterations = sha256.New, oidSHA256, pbes2SaltSize, pfxIterations
+	}
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(e.random, salt); err != nil {
+		return pfxMacData{}, err
+	}
+	password, err := bmpPassword(e.password)
+	if err != nil {
+		return pfxMacData{}, err
+	}
+	key := pkcs12KeyDerivation(newHash, password, salt, iterations, 3, newHash().Size())
+	mac := hmac.New(newHash, key)
+	mac.Write(data)
+	return pfxMacData{
+		Mac: pfxDigestInfo{
+			Algorithm: pkix.AlgorithmIdentifier{Algorithm: algorithm, Parameters: asn1.NullRawValue},
+			Digest:    mac.Sum(nil),
+		},
+		MacSalt:    salt,
+		Iterations: iterations,
+	}, nil
+}
+
+func plainSafeContents(bags []pfxSafeBag) (pfxContentInfo, error) {
+	data, err := asn1.Marshal(bags)
+	if err != nil {
+		return pfxContentInfo{}, err
+	}
+	content, err := asn1.Marshal(data)
+	if err != nil {
+		return pfxContentInfo{}, err
+	}
+	return pfxContentInfo{ContentType: oidDataContentType, Content: explicitContent(content)}, nil
+}
+
+func newPfxCertBag(cert *x509.Certificate, attributes []pfxAttribute) (pfxSafeBag, error) {
+	value, err := asn1.Marshal(pfxCertBag{Id: oidCertTypeX509Certificate, Data: cert.Raw})
+	if err != nil {
+		return pfxSafeBag{}, err
+	}
+	return pfxSafeBag{Id: oidCertBag, Value: explicitContent(value), Attributes: attributes}, nil
+}
+
+// newPfxAttribute returns an attribute holding the single value
+func newPfxAttribute(oid asn1.ObjectIdentifier, value interface{}) (pfxAttribute, error) {
+	encoded, err := asn1.Marshal(value)
+	if err != nil {
+		return pfxAttribute{}, err
+	}
+	return pfxAttribute{Id: oid, Value: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: encoded}}, nil
+}
+
+func newPfxFriendlyNameAttribute(name string) (pfxAttribute, error) {
+	encoded, err := bmpString(name)
+	if err != nil {
+		return pfxAttribute{}, err
+	}
+	return newPfxAttribute(oidFriendlyName, asn1.RawValue{Tag: asn1.TagBMPString, Bytes: encoded})
+}
+
+// explicitContent wraps the DER encoded value in the [0] EXPLICIT tag used by content infos and safe bags, crypto's
+// asn1 package ignores explicit tags on raw values so the tag is added here
+func explicitContent(value []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: value}
+}
+
+// bmpString encodes value as the UTF-16 big endian BMPString used by PKCS#12, characters outside the basic
+// multilingual plane cannot be represented
+func bmpString(value string) ([]byte, error) {
+	encoded := make([]byte, 0, len(value)*2)
+	for _, r := range value {
+		if r > 0xffff || utf16.IsSurrogate(r) {
+			return nil, fmt.Errorf("%q cannot be encoded as a BMPString", value)
+		}
+		encoded = append(encoded, byte(r>>8), byte(r))
+	}
+	return encoded, nil
+}
+
+// bmpPassword encodes password as a zero terminated BMPString, the form used by the PKCS#12 key derivation function
+func bmpPassword(password string) ([]byte, error) {
+	encoded, err := bmpString(password)
+	if err != nil {
+		return nil, err
+	}
+	return append(encoded, 0, 0), nil
+}
+
+// pkcs12KeyDerivation implements the key derivation function of RFC 7292 appendix B.2, id selects whether the key
+// material is used as an encryption key (1), an initialization vector (2) or a MAC key (3)
+func pkcs12KeyDerivation(newHash func() hash.Hash, password []byte, salt []byte, iterations int, id byte, size int) []byte {
+	const v = 64
+	u := newHash().Size()
+
+	diversifier := make([]byte, v)
+	for i := range diversifier {
+		diversifier[i] = id
+	}
+	fill := func(value []byte) []byte {
+		if len(value) == 0 {
+			return nil
+		}
+		filled := make([]byte, v*((len(value)+v-1)/v))
+		for i := range filled {
+			filled[i] = value[i%len(value)]
+		}
+		return filled
+	}
+	input := append(fill(salt), fill(password)...)
+
+	result := make([]byte, 0, size+u)
+	for len(result) < size {
+		h := newHash()
+		h.Write(diversifier)
+		h.Write(input)
+		block := h.Sum(nil)
+		for i := 1; i < iterations; i++ {
+			h = newHash()
+			h.Write(block)
+			block = h.Sum(block[:0])
+		}
+		result = append(result, block...)
+		if len(result) >= size {
+			break
+		}
+
+		b := make([]byte, v)
+		for i := range b {
+			b[i] = block[i%u]
+		}
+		for j := 0; j < len(input); j += v {
+			carry := 1
+			for k := v - 1; k >= 0; k-- {
+				sum := int(input[j+k]) + int(b[k]) + carry
+				input[j+k] = byte(sum)
+				carry = sum >> 8
+			}
+		}
+	}
+	return result[:size]
+}
@@ -0,0 +1,206 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/sha1"
+	"encoding/hex"
+	"path/filepath"
+	"software.sslmate.com/src/go-pkcs12"
+	"testing"
+)
+
+var pfxProfiles = []PfxProfile{PfxProfileLegacyRC2, PfxProfileLegacyDES, PfxProfileModern}
+
+func TestEncodeToBytes_ShouldIncludeChainInPfx_ForEveryProfile(t *testing.T) {
+	factory, root, intermediate := newTestCertificateAuthorities(t)
+	cert, key, err := factory.NewServerCertificate(intermediate, "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, profile := range pfxProfiles {
+		t.Run(profile.String(), func(t *testing.T) {
+			data, err := EncodeToBytes(ExportFormatPFX, cert, key, "password",
+				WriteWithPfxProfile(profile),
+				WriteWithChain(intermediate.Certificate, root.Certificate))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			decodedKey, decodedCert, chain, err := pkcs12.DecodeChain(data, "password")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(decodedCert.Raw, cert.Raw) {
+				t.Fatal("decoded certificate does not match the certificate")
+			}
+			if decodedSigner, ok := decodedKey.(crypto.Signer); !ok || !decodedSigner.Public().(interface{ Equal(crypto.PublicKey) bool }).Equal(key.Public()) {
+				t.Fatal("decoded key does not match the key")
+			}
+			if len(chain) != 2 || !bytes.Equal(chain[0].Raw, intermediate.Certificate.Raw) || !bytes.Equal(chain[1].Raw, root.Certificate.Raw) {
+				t.Fatal("decoded chain does not match the chain")
+			}
+		})
+	}
+}
+
+func TestEncodeToBytes_ShouldPairKeyAndCertificateWithLocalKeyID(t *testing.T) {
+	cert, key := newTestWriterCertificate(t)
+	fingerprint := sha1.Sum(cert.Raw)
+
+	data, err := EncodeToBytes(ExportFormatPFX, cert, key, "password", WriteWithPfxProfile(PfxProfileModern))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blocks, err := pkcs12.ToPEM(data, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 2 {
+		t.Fatalf("expected a certificate and a key but found %d blocks", len(blocks))
+	}
+	for _, block := range blocks {
+		if block.Headers["localKeyId"] != hex.EncodeToString(fingerprint[:]) {
+			t.Fatalf("%s local key id is %q", block.Type, block.Headers["localKeyId"])
+		}
+	}
+}
+
+func TestEncodeToBytes_ShouldAddFriendlyNameAndLocalKeyID_WhenSet(t *testing.T) {
+	factory, root, intermediate := newTestCertificateAuthorities(t)
+	cert, key, err := factory.NewServerCertificate(intermediate, "localhost")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, profile := range []PfxProfile{PfxProfileLegacyDES, PfxProfileModern} {
+		t.Run(profile.String(), func(t *testing.T) {
+			data, err := EncodeToBytes(ExportFormatPFX, cert, key, "password",
+				WriteWithPfxProfile(profile),
+				WriteWithChain(intermediate.Certificate, root.Certificate),
+				WriteWithFriendlyName("web server"),
+				WriteWithLocalKeyID([]byte{1, 2, 3, 4}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			decodedKey, decodedCert, chain, err := pkcs12.DecodeChain(data, "password")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(decodedCert.Raw, cert.Raw) || len(chain) != 2 {
+				t.Fatal("decoded certificates do not match the certificate and chain")
+			}
+			if decodedSigner, ok := decodedKey.(crypto.Signer); !ok || !publicKeysEqual(decodedSigner.Public(), key.Public()) {
+				t.Fatal("decoded key does not match the key")
+			}
+
+			blocks, err := pkcs12.ToPEM(data, "password")
+			if err != nil {
+				t.Fatal(err)
+			}
+			named := 0
+			for _, block := range blocks {
+				if block.Headers["friendlyName"] == "" && block.Headers["localKeyId"] == "" {
+					continue
+				}
+				if block.Headers["friendlyName"] != "web server" || block.Headers["localKeyId"] != "01020304" {
+					t.Fatalf("%s attributes %v do not match expected values", block.Type, block.Headers)
+				}
+				named++
+			}
+			if named != 2 {
+				t.Fatalf("expected the certificate and key to carry attributes but found %d blocks", named)
+			}
+		})
+	}
+}
+
+func TestEncodeToBytes_ShouldReturnError_WhenLegacyRC2PfxHasFriendlyName(t *testing.T) {
+	cert, key := newTestWriterCertificate(t)
+
+	if _, err := EncodeToBytes(ExportFormatPFX, cert, key, "password", WriteWithPfxProfile(PfxProfileLegacyRC2), WriteWithFriendlyName("web server")); err == nil {
+		t.Fatal("error was not returned for a friendly name with the LegacyRC2 profile")
+	}
+	if _, err := EncodeToBytes(ExportFormatPFX, cert, key, "password", WriteWithPfxProfile(PfxProfileLegacyRC2), WriteWithLocalKeyID([]byte{1})); err == nil {
+		t.Fatal("error was not returned for a local key id with the LegacyRC2 profile")
+	}
+}
+
+func TestEncodeToBytes_ShouldWritePfxTrustStore_ForEveryProfile(t *testing.T) {
+	_, root, intermediate := newTestCertificateAuthorities(t)
+
+	for _, profile := range pfxProfiles {
+		t.Run(profile.String(), func(t *testing.T) {
+			data, err := EncodeToBytes(ExportFormatPFXTrustStore, root.Certificate, nil, "changeit",
+				WriteWithPfxProfile(profile),
+				WriteWithFriendlyName("acme root"),
+				WriteWithChain(intermediate.Certificate))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			certs, err := pkcs12.DecodeTrustStore(data, "changeit")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(certs) != 2 || !bytes.Equal(certs[0].Raw, root.Certificate.Raw) || !bytes.Equal(certs[1].Raw, intermediate.Certificate.Raw) {
+				t.Fatal("decoded trust store does not match the certificates")
+			}
+		})
+	}
+}
+
+func TestEncodeToBytes_ShouldEncodeIdenticalPfx_WhenRandomIsFixed(t *testing.T) {
+	cert, key := newTestWriterCertificate(t)
+
+	for _, profile := range pfxProfiles {
+		t.Run(profile.String(), func(t *testing.T) {
+			first, err := EncodeToBytes(ExportFormatPFX, cert, key, "password", WriteWithPfxProfile(profile), WriteWithRandom(newSeededReader("pfx")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			second, err := EncodeToBytes(ExportFormatPFX, cert, key, "password", WriteWithPfxProfile(profile), WriteWithRandom(newSeededReader("pfx")))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(first, second) {
+				t.Fatal("PFX files encoded with the same random source differ")
+			}
+		})
+	}
+}
+
+func TestEncodeToBytes_ShouldReturnError_WhenPfxProfileIsUnsupported(t *testing.T) {
+	cert, key := newTestWriterCertificate(t)
+
+	if _, err := EncodeToBytes(ExportFormatPFX, cert, key, "password", WriteWithPfxProfile(PfxProfile(42))); err == nil {
+		t.Fatal("error was not returned for an unsupported profile")
+	}
+}
+
+func TestWriteFile_ShouldWriteTrustStoreWithCertificateFileMode(t *testing.T) {
+	_, root, _ := newTestCertificateAuthorities(t)
+	filename := filepath.Join(t.TempDir(), "truststore.p12")
+
+	if err := WriteFile(filename, ExportFormatPFXTrustStore, root.Certificate, nil, "changeit"); err != nil {
+		t.Fatal(err)
+	}
+
+	assertFileMode(t, filename, defaultCertificateFileMode)
+}
@@ -0,0 +1,227 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+	"io"
+)
+
+var (
+	oidPBES2          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2         = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA256 = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidScrypt         = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 11591, 4, 11}
+	oidAES256CBC      = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+)
+
+// KeyDerivationFunction selects how the key encrypting an ExportFormatPemEncryptedPKCS8PrivateKey is derived from the
+// password
+type KeyDerivationFunction int32
+
+const (
+	// KeyDerivationPBKDF2 uses PBKDF2 with HMAC-SHA256, it is the default and the most widely supported
+	KeyDerivationPBKDF2 KeyDerivationFunction = iota
+	// KeyDerivationScrypt uses scrypt, which is memory hard but requires OpenSSL 1.1 or later to read
+	KeyDerivationScrypt
+)
+
+func (f KeyDerivationFunction) String() string {
+	switch f {
+	case KeyDerivationPBKDF2:
+		return "PBKDF2"
+	case KeyDerivationScrypt:
+		return "scrypt"
+	default:
+		return fmt.Sprintf("KeyDerivationFunction(%d)", int32(f))
+	}
+}
+
+// The scrypt cost matches the OpenSSL default, higher costs exceed the memory limit OpenSSL applies when reading keys
+const (
+	pbkdf2Iterations  = 600000
+	scryptCost        = 1 << 14
+	scryptBlockSize   = 8
+	scryptParallelism = 1
+	pbes2SaltSize     = 16
+	aes256KeySize     = 32
+)
+
+type encryptedPrivateKeyInfo struct {
+	EncryptionAlgorithm pkix.AlgorithmIdentifier
+	EncryptedData       []byte
+}
+
+type pbes2Parameters struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pbkdf2Parameters struct {
+	Salt           []byte
+	IterationCount int
+	PRF            pkix.AlgorithmIdentifier
+}
+
+type scryptParameters struct {
+	Salt                     []byte
+	CostParameter            int
+	BlockSize                int
+	ParallelizationParameter int
+}
+
+func encodePKCS8PrivatePem(w io.Writer, key crypto.Signer) error {
+	if key == nil {
+		return fmt.Errorf("invalid argument, key cannot be nil")
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	return pem.Encode(w, &pem.Block{Type: "PRIVATE KEY", Bytes: der})
+}
+
+func encodeECPrivatePem(w io.Writer, key crypto.Signer) error {
+	ecKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return fmt.Errorf("unsupported key type %T, only ECDSA keys can be written as EC private keys", key)
+	}
+	der, err := x509.MarshalECPrivateKey(ecKey)
+	if err != nil {
+		return err
+	}
+	return pem.Encode(w, &pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+// encodeEncryptedPKCS8PrivatePem writes key as a PKCS#8 EncryptedPrivateKeyInfo protected by PBES2 with AES-256-CBC and
+// a key derived from password by derivation
+func encodeEncryptedPKCS8PrivatePem(w io.Writer, key crypto.Signer, password string, derivation KeyDerivationFunction, random io.Reader) error {
+	if key == nil {
+		return fmt.Errorf("invalid argument, key cannot be nil")
+	}
+	if password == "" {
+		return fmt.Errorf("invalid argument, a password is required to encrypt a private key")
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+	algorithm, encrypted, err := encryptPBES2(der, []byte(password), derivation, pbkdf2Iterations, random)
+	if err != nil {
+		return err
+	}
+	info, err := asn1.Marshal(encryptedPrivateKeyInfo{EncryptionAlgorithm: algorithm, EncryptedData: encrypted})
+	if err != nil {
+		return err
+	}
+	return pem.Encode(w, &pem.Block{Type: "ENCRYPTED PRIVATE KEY", Bytes: info})
+}
+
+// encryptPBES2 encrypts data with AES-256-CBC using a key derived from password, iterations only applies to PBKDF2.
+// It returns the PBES2 algorithm identifier describing the encryption along with the encrypted data
+func encryptPBES2(data []byte, password []byte, derivation KeyDerivationFunction, iterations int, random io.Reader) (pkix.AlgorithmIdentifier, []byte, error) {
+	salt := make([]byte, pbes2SaltSize)
+	if _, err := io.ReadFull(random, salt); err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+	iv := make([]byte, aes.BlockSize)
+	if _, err := io.ReadFull(random, iv); err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+	encryptionKey, keyDerivationFunc, err := deriveEncryptionKey(password, salt, derivation, iterations)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+	plaintext := padBlocks(data, aes.BlockSize)
+	encrypted := make([]byte, len(plaintext))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, plaintext)
+
+	ivBytes, err := asn1.Marshal(iv)
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+	parameters, err := asn1.Marshal(pbes2Parameters{
+		KeyDerivationFunc: keyDerivationFunc,
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: ivBytes}},
+	})
+	if err != nil {
+		return pkix.AlgorithmIdentifier{}, nil, err
+	}
+	return pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: parameters}}, encrypted, nil
+}
+
+// padBlocks returns a copy of data with PKCS#7 padding up to a multiple of blockSize
+func padBlocks(data []byte, blockSize int) []byte {
+	padding := blockSize - len(data)%blockSize
+	padded := make([]byte, len(data), len(data)+padding)
+	copy(padded, data)
+	for i := 0; i < padding; i++ {
+		padded = append(padded, byte(padding))
+	}
+	return padded
+}
+
+// deriveEncryptionKey returns the AES-256 key derived from password along with the algorithm identifier describing how
+// it was derived
+func deriveEncryptionKey(password []byte, salt []byte, derivation KeyDerivationFunction, iterations int) ([]byte, pkix.AlgorithmIdentifier, error) {
+	var algorithm asn1.ObjectIdentifier
+	var parameters interface{}
+	var key []byte
+	switch derivation {
+	case KeyDerivationPBKDF2:
+		algorithm = oidPBKDF2
+		parameters = pbkdf2Parameters{
+			Salt:           salt,
+			IterationCount: iterations,
+			PRF:            pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue},
+		}
+		key = pbkdf2.Key(password, salt, iterations, aes256KeySize, sha256.New)
+	case KeyDerivationScrypt:
+		algorithm = oidScrypt
+		parameters = scryptParameters{
+			Salt:                     salt,
+			CostParameter:            scryptCost,
+			BlockSize:                scryptBlockSize,
+			ParallelizationParameter: scryptParallelism,
+		}
+		var err error
+		if key, err = scrypt.Key(password, salt, scryptCost, scryptBlockSize, scryptParallelism, aes256KeySize); err != nil {
+			return nil, pkix.AlgorithmIdentifier{}, err
+		}
+	default:
+		return nil, pkix.AlgorithmIdentifier{}, fmt.Errorf("unsupported key derivation function %v", derivation)
+	}
+
+	encoded, err := asn1.Marshal(parameters)
+	if err != nil {
+		return nil, pkix.AlgorithmIdentifier{}, err
+	}
+	return key, pkix.AlgorithmIdentifier{Algorithm: algorithm, Parameters: asn1.RawValue{FullBytes: encoded}}, nil
+}
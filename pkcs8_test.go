@@ -0,0 +1,205 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+	"testing"
+)
+
+// decryptTestPKCS8PrivateKey reverses encodeEncryptedPKCS8PrivatePem so the encoded structure can be checked
+func decryptTestPKCS8PrivateKey(t *testing.T, data []byte, password string) (crypto.PrivateKey, asn1.ObjectIdentifier) {
+	t.Helper()
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "ENCRYPTED PRIVATE KEY" {
+		t.Fatal("data is not a PEM encrypted private key")
+	}
+	var info encryptedPrivateKeyInfo
+	if _, err := asn1.Unmarshal(block.Bytes, &info); err != nil {
+		t.Fatal(err)
+	}
+	if !info.EncryptionAlgorithm.Algorithm.Equal(oidPBES2) {
+		t.Fatalf("encryption algorithm %v is not PBES2", info.EncryptionAlgorithm.Algorithm)
+	}
+	var parameters pbes2Parameters
+	if _, err := asn1.Unmarshal(info.EncryptionAlgorithm.Parameters.FullBytes, &parameters); err != nil {
+		t.Fatal(err)
+	}
+	if !parameters.EncryptionScheme.Algorithm.Equal(oidAES256CBC) {
+		t.Fatalf("encryption scheme %v is not AES-256-CBC", parameters.EncryptionScheme.Algorithm)
+	}
+	var iv []byte
+	if _, err := asn1.Unmarshal(parameters.EncryptionScheme.Parameters.FullBytes, &iv); err != nil {
+		t.Fatal(err)
+	}
+
+	var key []byte
+	derivation := parameters.KeyDerivationFunc
+	switch {
+	case derivation.Algorithm.Equal(oidPBKDF2):
+		var kdf pbkdf2Parameters
+		if _, err := asn1.Unmarshal(derivation.Parameters.FullBytes, &kdf); err != nil {
+			t.Fatal(err)
+		}
+		if !kdf.PRF.Algorithm.Equal(oidHMACWithSHA256) {
+			t.Fatalf("prf %v is not HMAC-SHA256", kdf.PRF.Algorithm)
+		}
+		key = pbkdf2.Key([]byte(password), kdf.Salt, kdf.IterationCount, aes256KeySize, sha256.New)
+	case derivation.Algorithm.Equal(oidScrypt):
+		var kdf scryptParameters
+		if _, err := asn1.Unmarshal(derivation.Parameters.FullBytes, &kdf); err != nil {
+			t.Fatal(err)
+		}
+		var err error
+		if key, err = scrypt.Key([]byte(password), kdf.Salt, kdf.CostParameter, kdf.BlockSize, kdf.ParallelizationParameter, aes256KeySize); err != nil {
+			t.Fatal(err)
+		}
+	default:
+		t.Fatalf("unexpected key derivation function %v", derivation.Algorithm)
+	}
+
+	cipherBlock, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plaintext := make([]byte, len(info.EncryptedData))
+	cipher.NewCBCDecrypter(cipherBlock, iv).CryptBlocks(plaintext, info.EncryptedData)
+	padding := int(plaintext[len(plaintext)-1])
+	if padding == 0 || padding > aes.BlockSize || !bytes.Equal(plaintext[len(plaintext)-padding:], bytes.Repeat([]byte{byte(padding)}, padding)) {
+		t.Fatal("decrypted key has invalid padding")
+	}
+	privateKey, err := x509.ParsePKCS8PrivateKey(plaintext[:len(plaintext)-padding])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return privateKey, derivation.Algorithm
+}
+
+func TestEncodeToBytes_ShouldEncodePKCS8PrivateKey_ForEveryKeyAlgorithm(t *testing.T) {
+	for _, algorithm := range []KeyAlgorithm{KeyAlgorithmRSA2048, KeyAlgorithmECDSAP256, KeyAlgorithmEd25519} {
+		_, key, err := NewCertificateBuilder().WithKeyAlgorithm(algorithm).WithCommonName("localhost").BuildSelfSignedCertificate()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := EncodeToBytes(ExportFormatPemPKCS8PrivateKey, nil, key, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		block, _ := pem.Decode(data)
+		if block == nil || block.Type != "PRIVATE KEY" {
+			t.Fatalf("%v: encoded key is not a PKCS#8 private key", algorithm)
+		}
+		decoded, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !publicKeysEqual(key.Public(), decoded.(crypto.Signer).Public()) {
+			t.Fatalf("%v: decoded key does not match the key", algorithm)
+		}
+	}
+}
+
+func TestEncodeToBytes_ShouldEncodeECPrivateKey(t *testing.T) {
+	_, key, err := NewCertificateBuilder().WithKeyAlgorithm(KeyAlgorithmECDSAP384).WithCommonName("localhost").BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := EncodeToBytes(ExportFormatPemECPrivateKey, nil, key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "EC PRIVATE KEY" {
+		t.Fatal("encoded key is not an EC private key")
+	}
+	decoded, err := x509.ParseECPrivateKey(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !decoded.Equal(key.(*ecdsa.PrivateKey)) {
+		t.Fatal("decoded key does not match the key")
+	}
+}
+
+func TestEncodeToBytes_ShouldReturnError_WhenECPrivateKeyIsNotECDSA(t *testing.T) {
+	_, key := newTestWriterCertificate(t)
+
+	if _, err := EncodeToBytes(ExportFormatPemECPrivateKey, nil, key, ""); err == nil {
+		t.Fatal("error was not returned for an RSA key")
+	}
+}
+
+func TestEncodeToBytes_ShouldEncryptPKCS8PrivateKey_WithEachKeyDerivationFunction(t *testing.T) {
+	_, key, err := NewCertificateBuilder().WithKeyAlgorithm(KeyAlgorithmECDSAP256).WithCommonName("localhost").BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for derivation, expected := range map[KeyDerivationFunction]asn1.ObjectIdentifier{
+		KeyDerivationPBKDF2: oidPBKDF2,
+		KeyDerivationScrypt: oidScrypt,
+	} {
+		data, err := EncodeToBytes(ExportFormatPemEncryptedPKCS8PrivateKey, nil, key, "secret", WriteWithKeyDerivationFunction(derivation))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		decoded, actual := decryptTestPKCS8PrivateKey(t, data, "secret")
+		if !actual.Equal(expected) {
+			t.Fatalf("%v: key derivation function %v does not match expected %v", derivation, actual, expected)
+		}
+		if !key.(*ecdsa.PrivateKey).Equal(decoded) {
+			t.Fatalf("%v: decrypted key does not match the key", derivation)
+		}
+	}
+}
+
+func TestEncodeToBytes_ShouldReturnError_WhenEncryptedPrivateKeyHasNoPassword(t *testing.T) {
+	_, key := newTestWriterCertificate(t)
+
+	if _, err := EncodeToBytes(ExportFormatPemEncryptedPKCS8PrivateKey, nil, key, ""); err == nil {
+		t.Fatal("error was not returned for an empty password")
+	}
+	if _, err := EncodeToBytes(ExportFormatPemEncryptedPKCS8PrivateKey, nil, key, "secret", WriteWithKeyDerivationFunction(KeyDerivationFunction(42))); err == nil {
+		t.Fatal("error was not returned for an unknown key derivation function")
+	}
+}
+
+func TestEncodeToBytes_ShouldEncryptIdenticalPrivateKey_WhenRandomIsFixed(t *testing.T) {
+	_, key := newTestWriterCertificate(t)
+
+	first, err := EncodeToBytes(ExportFormatPemEncryptedPKCS8PrivateKey, nil, key, "secret", WriteWithRandom(newSeededReader("pkcs8")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := EncodeToBytes(ExportFormatPemEncryptedPKCS8PrivateKey, nil, key, "secret", WriteWithRandom(newSeededReader("pkcs8")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(first, second) {
+		t.Fatal("encrypted keys differ when encrypted with the same random source")
+	}
+}
@@ -0,0 +1,438 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+)
+
+// CertificatePolicyOptions are the initial inputs to certificate policy processing described in RFC 5280 section 6.1.1
+type CertificatePolicyOptions struct {
+	// InitialPolicies is the set of policies acceptable to the relying party, empty means any policy is acceptable
+	InitialPolicies []asn1.ObjectIdentifier
+	// RequireExplicitPolicy requires that the chain is valid for at least one of InitialPolicies
+	RequireExplicitPolicy bool
+	// InhibitPolicyMapping prevents policy mappings in the chain from being applied
+	InhibitPolicyMapping bool
+	// InhibitAnyPolicy prevents anyPolicy in the chain from matching other policies
+	InhibitAnyPolicy bool
+}
+
+// CertificatePolicyResult is the outcome of certificate policy processing
+type CertificatePolicyResult struct {
+	// Policies are the policies, as named in the end entity certificate's policy domain, for which the chain is valid
+	Policies []asn1.ObjectIdentifier
+	// AnyPolicy is set when the chain is valid for any policy
+	AnyPolicy bool
+}
+
+type policyNode struct {
+	validPolicy       asn1.ObjectIdentifier
+	expectedPolicySet []asn1.ObjectIdentifier
+	parent            *policyNode
+	children          []*policyNode
+	depth             int
+}
+
+// policyTree is the valid_policy_tree of RFC 5280 section 6.1, a nil root is the NULL tree
+type policyTree struct {
+	root *policyNode
+}
+
+type certificatePolicyExtensions struct {
+	policies              []asn1.ObjectIdentifier
+	hasPolicies           bool
+	mappings              []PolicyMapping
+	requireExplicitPolicy int
+	inhibitPolicyMapping  int
+	inhibitAnyPolicy      int
+}
+
+// VerifyCertificatePolicies evaluates the certificate policies of chain following RFC 5280 section 6.1. The chain is
+// ordered as returned by x509.Certificate.Verify, starting with the end entity certificate and ending with the trust
+// anchor, whose own policies are not processed. An error is returned when the chain is not valid for any policy while
+// an explicit policy is required, either by options or by a policy constraint within the chain
+func VerifyCertificatePolicies(chain []*x509.Certificate, options CertificatePolicyOptions) (*CertificatePolicyResult, error) {
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("invalid argument, chain cannot be empty")
+	}
+	n := len(chain) - 1
+	path := make([]*x509.Certificate, 0, n)
+	for i := n - 1; i >= 0; i-- {
+		path = append(path, chain[i])
+	}
+
+	tree := &policyTree{root: &policyNode{validPolicy: OIDAnyPolicy, expectedPolicySet: []asn1.ObjectIdentifier{OIDAnyPolicy}}}
+	explicitPolicy := initialSkipCerts(options.RequireExplicitPolicy, n)
+	inhibitAnyPolicy := initialSkipCerts(options.InhibitAnyPolicy, n)
+	policyMapping := initialSkipCerts(options.InhibitPolicyMapping, n)
+
+	for index, cert := range path {
+		i := index + 1
+		extensions, err := parseCertificatePolicyExtensions(cert)
+		if err != nil {
+			return nil, err
+		}
+		selfIssued := isSelfIssued(cert)
+
+		if extensions.hasPolicies && tree.root != nil {
+			tree.processPolicies(i, n, extensions.policies, inhibitAnyPolicy > 0 || (i < n && selfIssued))
+		} else {
+			tree.root = nil
+		}
+		if explicitPolicy == 0 && tree.root == nil {
+			return nil, fmt.Errorf("certificate %q is not valid for any acceptable policy", cert.Subject.String())
+		}
+		if i == n {
+			if explicitPolicy > 0 {
+				explicitPolicy--
+			}
+			if extensions.requireExplicitPolicy == 0 {
+				explicitPolicy = 0
+			}
+			break
+		}
+
+		for _, mapping := range extensions.mappings {
+			if mapping.IssuerDomainPolicy.Equal(OIDAnyPolicy) || mapping.SubjectDomainPolicy.Equal(OIDAnyPolicy) {
+				return nil, fmt.Errorf("certificate %q maps anyPolicy", cert.Subject.String())
+			}
+		}
+		if len(extensions.mappings) > 0 && tree.root != nil {
+			tree.processMappings(i, extensions.mappings, policyMapping > 0)
+		}
+
+		if !selfIssued {
+			explicitPolicy = decrementSkipCerts(explicitPolicy)
+			policyMapping = decrementSkipCerts(policyMapping)
+			inhibitAnyPolicy = decrementSkipCerts(inhibitAnyPolicy)
+		}
+		if extensions.requireExplicitPolicy >= 0 && extensions.requireExplicitPolicy < explicitPolicy {
+			explicitPolicy = extensions.requireExplicitPolicy
+		}
+		if extensions.inhibitPolicyMapping >= 0 && extensions.inhibitPolicyMapping < policyMapping {
+			policyMapping = extensions.inhibitPolicyMapping
+		}
+		if extensions.inhibitAnyPolicy >= 0 && extensions.inhibitAnyPolicy < inhibitAnyPolicy {
+			inhibitAnyPolicy = extensions.inhibitAnyPolicy
+		}
+	}
+
+	tree.intersect(n, options.InitialPolicies)
+	if explicitPolicy == 0 && tree.root == nil {
+		return nil, fmt.Errorf("chain is not valid for any acceptable policy")
+	}
+
+	result := &CertificatePolicyResult{Policies: make([]asn1.ObjectIdentifier, 0)}
+	for _, node := range tree.nodesAtDepth(n) {
+		if node.validPolicy.Equal(OIDAnyPolicy) {
+			result.AnyPolicy = true
+		} else if !containsOID(result.Policies, node.validPolicy) {
+			result.Policies = append(result.Policies, node.validPolicy)
+		}
+	}
+	return result, nil
+}
+
+// processPolicies applies the certificate policies of the certificate at depth i, steps (d)(1) to (d)(3) of RFC 5280
+// section 6.1.3
+func (t *policyTree) processPolicies(i int, n int, policies []asn1.ObjectIdentifier, anyPolicyAllowed bool) {
+	parents := t.nodesAtDepth(i - 1)
+	certificateHasAnyPolicy := false
+	for _, policy := range policies {
+		if policy.Equal(OIDAnyPolicy) {
+			certificateHasAnyPolicy = true
+			continue
+		}
+		matched := false
+		for _, parent := range parents {
+			if containsOID(parent.expectedPolicySet, policy) {
+				parent.addChild(policy, []asn1.ObjectIdentifier{policy})
+				matched = true
+			}
+		}
+		if matched {
+			continue
+		}
+		for _, parent := range parents {
+			if parent.validPolicy.Equal(OIDAnyPolicy) {
+				parent.addChild(policy, []asn1.ObjectIdentifier{policy})
+			}
+		}
+	}
+	if certificateHasAnyPolicy && anyPolicyAllowed {
+		for _, parent := range parents {
+			for _, expected := range parent.expectedPolicySet {
+				if !parent.hasChild(expected) {
+					parent.addChild(expected, []asn1.ObjectIdentifier{expected})
+				}
+			}
+		}
+	}
+	t.prune(i)
+}
+
+// processMappings applies the policy mappings of the certificate at depth i, step (b) of RFC 5280 section 6.1.4
+func (t *policyTree) processMappings(i int, mappings []PolicyMapping, mappingAllowed bool) {
+	issuerPolicies := make([]asn1.ObjectIdentifier, 0, len(mappings))
+	for _, mapping := range mappings {
+		if !containsOID(issuerPolicies, mapping.IssuerDomainPolicy) {
+			issuerPolicies = append(issuerPolicies, mapping.IssuerDomainPolicy)
+		}
+	}
+	nodes := t.nodesAtDepth(i)
+	for _, issuerPolicy := range issuerPolicies {
+		subjectPolicies := make([]asn1.ObjectIdentifier, 0)
+		for _, mapping := range mappings {
+			if mapping.IssuerDomainPolicy.Equal(issuerPolicy) && !containsOID(subjectPolicies, mapping.SubjectDomainPolicy) {
+				subjectPolicies = append(subjectPolicies, mapping.SubjectDomainPolicy)
+			}
+		}
+
+		if !mappingAllowed {
+			for _, node := range nodes {
+				if node.validPolicy.Equal(issuerPolicy) {
+					node.parent.removeChild(node)
+				}
+			}
+			continue
+		}
+
+		matched := false
+		for _, node := range nodes {
+			if node.validPolicy.Equal(issuerPolicy) {
+				node.expectedPolicySet = subjectPolicies
+				matched = true
+			}
+		}
+		if matched {
+			continue
+		}
+		for _, node := range nodes {
+			if node.validPolicy.Equal(OIDAnyPolicy) {
+				node.parent.addChild(issuerPolicy, subjectPolicies)
+				break
+			}
+		}
+	}
+	if !mappingAllowed {
+		t.prune(i)
+	}
+}
+
+// intersect calculates the intersection of the tree with the initial policies of the relying party, step (g) of RFC
+// 5280 section 6.1.5
+func (t *policyTree) intersect(n int, initialPolicies []asn1.ObjectIdentifier) {
+	if t.root == nil || len(initialPolicies) == 0 || containsOID(initialPolicies, OIDAnyPolicy) {
+		return
+	}
+
+	validPolicyNodes := make([]*policyNode, 0)
+	t.root.walk(func(node *policyNode) {
+		if node.parent != nil && node.parent.validPolicy.Equal(OIDAnyPolicy) && !node.validPolicy.Equal(OIDAnyPolicy) {
+			validPolicyNodes = append(validPolicyNodes, node)
+		}
+	})
+	for _, node := range validPolicyNodes {
+		if !containsOID(initialPolicies, node.validPolicy) {
+			node.parent.removeChild(node)
+		}
+	}
+
+	for _, node := range t.nodesAtDepth(n) {
+		if !node.validPolicy.Equal(OIDAnyPolicy) || node.parent == nil {
+			continue
+		}
+		for _, policy := range initialPolicies {
+			if !containsPolicyNode(validPolicyNodes, policy) {
+				node.parent.addChild(policy, []asn1.ObjectIdentifier{policy})
+			}
+		}
+		node.parent.removeChild(node)
+	}
+	t.prune(n)
+}
+
+// prune removes nodes above depth without children, repeating until none remain; removing the root leaves the NULL tree
+func (t *policyTree) prune(depth int) {
+	for t.root != nil {
+		removed := false
+		t.root.walk(func(node *policyNode) {
+			if node.depth < depth && len(node.children) == 0 {
+				if node.parent == nil {
+					t.root = nil
+				} else {
+					node.parent.removeChild(node)
+				}
+				removed = true
+			}
+		})
+		if !removed {
+			return
+		}
+	}
+}
+
+func (t *policyTree) nodesAtDepth(depth int) []*policyNode {
+	nodes := make([]*policyNode, 0)
+	if t.root == nil {
+		return nodes
+	}
+	t.root.walk(func(node *policyNode) {
+		if node.depth == depth {
+			nodes = append(nodes, node)
+		}
+	})
+	return nodes
+}
+
+func (p *policyNode) walk(visit func(*policyNode)) {
+	children := append([]*policyNode{}, p.children...)
+	visit(p)
+	for _, child := range children {
+		child.walk(visit)
+	}
+}
+
+func (p *policyNode) addChild(policy asn1.ObjectIdentifier, expectedPolicySet []asn1.ObjectIdentifier) {
+	p.children = append(p.children, &policyNode{
+		validPolicy:       policy,
+		expectedPolicySet: expectedPolicySet,
+		parent:            p,
+		depth:             p.depth + 1,
+	})
+}
+
+func (p *policyNode) hasChild(policy asn1.ObjectIdentifier) bool {
+	for _, child := range p.children {
+		if child.validPolicy.Equal(policy) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *policyNode) removeChild(node *policyNode) {
+	for i, child := range p.children {
+		if child == node {
+			p.children = append(p.children[:i], p.children[i+1:]...)
+			return
+		}
+	}
+}
+
+func containsPolicyNode(nodes []*policyNode, policy asn1.ObjectIdentifier) bool {
+	for _, node := range nodes {
+		if node.validPolicy.Equal(policy) {
+			return true
+		}
+	}
+	return false
+}
+
+func initialSkipCerts(inhibited bool, n int) int {
+	if inhibited {
+		return 0
+	}
+	return n + 1
+}
+
+func decrementSkipCerts(value int) int {
+	if value > 0 {
+		return value - 1
+	}
+	return value
+}
+
+func isSelfIssued(cert *x509.Certificate) bool {
+	return bytes.Equal(cert.RawSubject, cert.RawIssuer)
+}
+
+// parseCertificatePolicyExtensions reads the policy related extensions of cert, absent skip certs values are -1
+func parseCertificatePolicyExtensions(cert *x509.Certificate) (*certificatePolicyExtensions, error) {
+	result := &certificatePolicyExtensions{requireExplicitPolicy: -1, inhibitPolicyMapping: -1, inhibitAnyPolicy: -1}
+	for _, extension := range cert.Extensions {
+		var err error
+		switch {
+		case extension.Id.Equal(oidExtensionCertificatePolicies):
+			result.hasPolicies = true
+			result.policies, err = parseCertificatePoliciesExtension(extension.Value)
+		case extension.Id.Equal(oidExtensionPolicyMappings):
+			result.mappings, err = parsePolicyMappingsExtension(extension.Value)
+		case extension.Id.Equal(oidExtensionPolicyConstraints):
+			result.requireExplicitPolicy, result.inhibitPolicyMapping, err = parsePolicyConstraintsExtension(extension.Value)
+		case extension.Id.Equal(oidExtensionInhibitAnyPolicy):
+			err = unmarshalExtension(extension.Value, &result.inhibitAnyPolicy)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("certificate %q has an invalid policy extension %v: %w", cert.Subject.String(), extension.Id, err)
+		}
+	}
+	return result, nil
+}
+
+func parseCertificatePoliciesExtension(value []byte) ([]asn1.ObjectIdentifier, error) {
+	var information []policyInformation
+	if err := unmarshalExtension(value, &information); err != nil {
+		return nil, err
+	}
+	policies := make([]asn1.ObjectIdentifier, 0, len(information))
+	for _, policy := range information {
+		policies = append(policies, policy.Policy)
+	}
+	return policies, nil
+}
+
+func parsePolicyMappingsExtension(value []byte) ([]PolicyMapping, error) {
+	var mappings []PolicyMapping
+	if err := unmarshalExtension(value, &mappings); err != nil {
+		return nil, err
+	}
+	return mappings, nil
+}
+
+func parsePolicyConstraintsExtension(value []byte) (int, int, error) {
+	var elements []asn1.RawValue
+	if err := unmarshalExtension(value, &elements); err != nil {
+		return 0, 0, err
+	}
+	constraints := []int{-1, -1}
+	for _, element := range elements {
+		if element.Class != asn1.ClassContextSpecific || element.Tag > 1 {
+			return 0, 0, fmt.Errorf("unexpected policy constraint tag %d", element.Tag)
+		}
+		integer, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagInteger, Bytes: element.Bytes})
+		if err != nil {
+			return 0, 0, err
+		}
+		if err := unmarshalExtension(integer, &constraints[element.Tag]); err != nil {
+			return 0, 0, err
+		}
+	}
+	return constraints[0], constraints[1], nil
+}
+
+func unmarshalExtension(value []byte, out interface{}) error {
+	rest, err := asn1.Unmarshal(value, out)
+	if err != nil {
+		return err
+	}
+	if len(rest) != 0 {
+		return fmt.Errorf("trailing data")
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// RenewalOption configures how RenewCertificate and RekeyCertificate build the successor certificate
+type RenewalOption func(*renewalOptions)
+
+type renewalOptions struct {
+	validity  time.Duration
+	customize func(*CertificateBuilder)
+}
+
+// RenewWithValidity sets the lifetime of the successor, by default it keeps the lifetime of the certificate it replaces
+func RenewWithValidity(value time.Duration) RenewalOption {
+	return func(o *renewalOptions) {
+		o.validity = value
+	}
+}
+
+// RenewWithCustomization calls customize with the builder seeded from the certificate being replaced so that any
+// further changes can be made before the successor is built
+func RenewWithCustomization(customize func(*CertificateBuilder)) RenewalOption {
+	return func(o *renewalOptions) {
+		o.customize = customize
+	}
+}
+
+// CertificateRenewal is the successor of a renewed or re-keyed certificate along with what changed from its predecessor
+type CertificateRenewal struct {
+	Certificate *x509.Certificate
+	Key         crypto.Signer
+	Changes     []CertificateChange
+}
+
+// CertificateChange describes a field that differs between two certificates
+type CertificateChange struct {
+	Field    string
+	Previous string
+	Current  string
+}
+
+func (c CertificateChange) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Field, c.Previous, c.Current)
+}
+
+// WriteFile writes the successor certificate or its key using WriteFile
+func (r *CertificateRenewal) WriteFile(filename string, encoding ExportFormat, password string, options ...WriteOption) error {
+	return WriteFile(filename, encoding, r.Certificate, r.Key, password, options...)
+}
+
+// RenewCertificate issues a successor to cert for the same identity and key with a new serial number and validity,
+// signed by issuer or self-signed when issuer is nil. key must be the private key of cert
+func RenewCertificate(cert *x509.Certificate, key crypto.Signer, issuer *CertificateAuthority, options ...RenewalOption) (*CertificateRenewal, error) {
+	if key == nil {
+		return nil, fmt.Errorf("invalid argument, key cannot be nil")
+	}
+	if cert != nil && !publicKeysEqual(key.Public(), cert.PublicKey) {
+		return nil, fmt.Errorf("invalid argument, key does not match the public key of the certificate")
+	}
+	return renewCertificate(cert, key, issuer, options)
+}
+
+// RekeyCertificate issues a successor to cert for the same identity with a newly generated key of the same algorithm,
+// a new serial number and validity, signed by issuer or self-signed when issuer is nil
+func RekeyCertificate(cert *x509.Certificate, issuer *CertificateAuthority, options ...RenewalOption) (*CertificateRenewal, error) {
+	return renewCertificate(cert, nil, issuer, options)
+}
+
+func renewCertificate(cert *x509.Certificate, key crypto.Signer, issuer *CertificateAuthority, options []RenewalOption) (*CertificateRenewal, error) {
+	settings := &renewalOptions{}
+	for _, option := range options {
+		option(settings)
+	}
+
+	builder, err := NewCertificateBuilderFromCertificate(cert, CopyWithLifetime())
+	if err != nil {
+		return nil, err
+	}
+	if key != nil {
+		builder.WithSigner(key)
+	}
+	if settings.validity != 0 {
+		builder.WithValidity(settings.validity)
+	}
+	if settings.customize != nil {
+		settings.customize(builder)
+	}
+
+	var successor *x509.Certificate
+	var successorKey crypto.Signer
+	if issuer != nil {
+		successor, successorKey, err = issuer.Issue(builder)
+	} else {
+		successor, successorKey, err = builder.BuildSelfSignedCertificate()
+	}
+	if err != nil {
+		return nil, err
+	}
+	changes, err := CompareCertificates(cert, successor)
+	if err != nil {
+		return nil, err
+	}
+	return &CertificateRenewal{
+		Certificate: successor,
+		Key:         successorKey,
+		Changes:     changes,
+	}, nil
+}
+
+// CompareCertificates reports the fields which differ between previous and current, covering the identity, key,
+// validity, issuer, usages and extensions of the certificates
+func CompareCertificates(previous *x509.Certificate, current *x509.Certificate) ([]CertificateChange, error) {
+	if previous == nil {
+		return nil, fmt.Errorf("invalid argument, previous certificate cannot be nil")
+	}
+	if current == nil {
+		return nil, fmt.Errorf("invalid argument, current certificate cannot be nil")
+	}
+	changes := make([]CertificateChange, 0)
+	compare := func(field string, before string, after string) {
+		if before != after {
+			changes = append(changes, CertificateChange{Field: field, Previous: before, Current: after})
+		}
+	}
+	// names are compared by their encoding, since certificates chain on the exact bytes of the issuer name and an
+	// attribute order or string type change is not visible in the string form
+	compareName := func(field string, before pkix.Name, rawBefore []byte, after pkix.Name, rawAfter []byte) {
+		if bytes.Equal(rawBefore, rawAfter) {
+			return
+		}
+		if before.String() != after.String() {
+			compare(field, before.String(), after.String())
+		} else {
+			compare(field, fmt.Sprintf("%X", rawBefore), fmt.Sprintf("%X", rawAfter))
+		}
+	}
+
+	compareName("Subject", previous.Subject, previous.RawSubject, current.Subject, current.RawSubject)
+	compareName("Issuer", previous.Issuer, previous.RawIssuer, current.Issuer, current.RawIssuer)
+	compare("SerialNumber", previous.SerialNumber.String(), current.SerialNumber.String())
+	compare("NotBefore", previous.NotBefore.UTC().Format(time.RFC3339), current.NotBefore.UTC().Format(time.RFC3339))
+	compare("NotAfter", previous.NotAfter.UTC().Format(time.RFC3339), current.NotAfter.UTC().Format(time.RFC3339))
+	compare("PublicKey", describePublicKey(previous), describePublicKey(current))
+	compare("SignatureAlgorithm", previous.SignatureAlgorithm.String(), current.SignatureAlgorithm.String())
+	compare("SubjectKeyId", fmt.Sprintf("%X", previous.SubjectKeyId), fmt.Sprintf("%X", current.SubjectKeyId))
+	compare("AuthorityKeyId", fmt.Sprintf("%X", previous.AuthorityKeyId), fmt.Sprintf("%X", current.AuthorityKeyId))
+	compare("DNSNames", strings.Join(previous.DNSNames, ","), strings.Join(current.DNSNames, ","))
+	compare("IPAddresses", fmt.Sprint(previous.IPAddresses), fmt.Sprint(current.IPAddresses))
+	compare("EmailAddresses", strings.Join(previous.EmailAddresses, ","), strings.Join(current.EmailAddresses, ","))
+	compare("URIs", fmt.Sprint(previous.URIs), fmt.Sprint(current.URIs))
+	compare("KeyUsage", fmt.Sprint(previous.KeyUsage), fmt.Sprint(current.KeyUsage))
+	compare("ExtKeyUsage", fmt.Sprint(previous.ExtKeyUsage), fmt.Sprint(current.ExtKeyUsage))
+	compare("IsCA", fmt.Sprint(previous.IsCA), fmt.Sprint(current.IsCA))
+	compare("MaxPathLen", fmt.Sprint(previous.MaxPathLen), fmt.Sprint(current.MaxPathLen))
+	compare("Extensions", describeExtensions(previous), describeExtensions(current))
+	return changes, nil
+}
+
+// describePublicKey identifies the public key of cert by its algorithm and the SHA-1 key identifier of RFC 5280
+func describePublicKey(cert *x509.Certificate) string {
+	identifier, err := computeSubjectKeyIdentifier(cert.PublicKey, SubjectKeyIdentifierMethodSHA1)
+	if err != nil {
+		return cert.PublicKeyAlgorithm.String()
+	}
+	return fmt.Sprintf("%v %X", cert.PublicKeyAlgorithm, identifier)
+}
+
+// describeExtensions lists the extension identifiers and values of cert, excluding the key identifiers which are
+// compared separately and change whenever the key does
+func describeExtensions(cert *x509.Certificate) string {
+	descriptions := make([]string, 0, len(cert.Extensions))
+	for _, extension := range cert.Extensions {
+		if extension.Id.Equal(oidExtensionSubjectKeyId) || extension.Id.Equal(oidExtensionAuthorityKeyIdentifier) {
+			continue
+		}
+		description := extension.Id.String()
+		if extension.Critical {
+			description += " (critical)"
+		}
+		descriptions = append(descriptions, fmt.Sprintf("%s=%X", description, extension.Value))
+	}
+	sort.Strings(descriptions)
+	return strings.Join(descriptions, ",")
+}
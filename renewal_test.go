@@ -0,0 +1,286 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"testing"
+	"time"
+)
+
+func newTestRenewalLeaf(t *testing.T) (*CertificateAuthority, *CertificateAuthority, *x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	_, root, intermediate := newTestCertificateAuthorities(t)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _, err := intermediate.Issue(NewCertificateBuilder().
+		WithCommonName("www.example.com").
+		WithSigner(key).
+		WithDnsNames("www.example.com").
+		WithEnhancedKeyUsage(x509.ExtKeyUsageServerAuth).
+		WithNotBefore(time.Now().Add(-60 * 24 * time.Hour)).
+		WithNotAfter(time.Now().Add(30 * 24 * time.Hour)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root, intermediate, cert, key
+}
+
+func findCertificateChange(changes []CertificateChange, field string) (CertificateChange, bool) {
+	for _, change := range changes {
+		if change.Field == field {
+			return change, true
+		}
+	}
+	return CertificateChange{}, false
+}
+
+func TestRenewCertificate_ShouldKeepKeyAndIdentity(t *testing.T) {
+	root, intermediate, cert, key := newTestRenewalLeaf(t)
+
+	renewal, err := RenewCertificate(cert, key, intermediate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if renewal.Key != key {
+		t.Fatal("renewed certificate does not use the existing key")
+	}
+	if !key.PublicKey.Equal(renewal.Certificate.PublicKey) {
+		t.Fatal("renewed certificate does not certify the existing key")
+	}
+	if renewal.Certificate.Subject.String() != cert.Subject.String() {
+		t.Fatalf("subject %v does not match expected %v", renewal.Certificate.Subject, cert.Subject)
+	}
+	if renewal.Certificate.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+		t.Fatal("renewed certificate reused the serial number")
+	}
+	if lifetime := renewal.Certificate.NotAfter.Sub(renewal.Certificate.NotBefore); lifetime != cert.NotAfter.Sub(cert.NotBefore) {
+		t.Fatalf("lifetime %v does not match the lifetime of the replaced certificate", lifetime)
+	}
+	if !renewal.Certificate.NotAfter.After(cert.NotAfter) {
+		t.Fatal("renewed certificate does not expire after the replaced certificate")
+	}
+	verifyChain(t, root, intermediate, renewal.Certificate, x509.VerifyOptions{DNSName: "www.example.com"})
+
+	if _, ok := findCertificateChange(renewal.Changes, "PublicKey"); ok {
+		t.Fatal("public key was reported as changed when renewing")
+	}
+	for _, field := range []string{"SerialNumber", "NotBefore", "NotAfter"} {
+		if _, ok := findCertificateChange(renewal.Changes, field); !ok {
+			t.Fatalf("%s was not reported as changed", field)
+		}
+	}
+	if _, ok := findCertificateChange(renewal.Changes, "Subject"); ok {
+		t.Fatal("subject was reported as changed")
+	}
+}
+
+func TestRenewCertificate_ShouldReturnError_WhenKeyDoesNotMatchCertificate(t *testing.T) {
+	_, intermediate, cert, _ := newTestRenewalLeaf(t)
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := RenewCertificate(cert, other, intermediate); err == nil {
+		t.Fatal("error was not returned when the key does not match the certificate")
+	}
+}
+
+func TestRekeyCertificate_ShouldGenerateNewKeyOfSameAlgorithm(t *testing.T) {
+	root, intermediate, cert, key := newTestRenewalLeaf(t)
+
+	renewal, err := RekeyCertificate(cert, intermediate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	newKey, ok := renewal.Key.(*ecdsa.PrivateKey)
+	if !ok {
+		t.Fatalf("key type %T is not *ecdsa.PrivateKey", renewal.Key)
+	}
+	if newKey.Curve != elliptic.P256() {
+		t.Fatalf("curve %v is not P-256", newKey.Curve.Params().Name)
+	}
+	if key.PublicKey.Equal(renewal.Certificate.PublicKey) {
+		t.Fatal("re-keyed certificate certifies the existing key")
+	}
+	verifyChain(t, root, intermediate, renewal.Certificate, x509.VerifyOptions{DNSName: "www.example.com"})
+
+	for _, field := range []string{"PublicKey", "SerialNumber"} {
+		if _, ok := findCertificateChange(renewal.Changes, field); !ok {
+			t.Fatalf("%s was not reported as changed", field)
+		}
+	}
+}
+
+func TestRenewCertificate_ShouldApplyValidityAndCustomization(t *testing.T) {
+	_, intermediate, cert, key := newTestRenewalLeaf(t)
+
+	renewal, err := RenewCertificate(cert, key, intermediate,
+		RenewWithValidity(7*24*time.Hour),
+		RenewWithCustomization(func(builder *CertificateBuilder) {
+			builder.WithDnsNames("api.example.com")
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if lifetime := renewal.Certificate.NotAfter.Sub(renewal.Certificate.NotBefore); lifetime != 7*24*time.Hour {
+		t.Fatalf("lifetime %v does not match expected 168h", lifetime)
+	}
+	change, ok := findCertificateChange(renewal.Changes, "DNSNames")
+	if !ok {
+		t.Fatal("dns names were not reported as changed")
+	}
+	if change.Previous != "www.example.com" || change.Current != "www.example.com,api.example.com" {
+		t.Fatalf("change %v does not match expected dns names", change)
+	}
+}
+
+func TestRenewCertificate_ShouldSelfSign_WhenIssuerIsNil(t *testing.T) {
+	_, root, _ := newTestCertificateAuthorities(t)
+
+	renewal, err := RenewCertificate(root.Certificate, root.Key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := renewal.Certificate.CheckSignatureFrom(renewal.Certificate); err != nil {
+		t.Fatal(err)
+	}
+	if !renewal.Certificate.IsCA {
+		t.Fatal("renewed root is not a certificate authority")
+	}
+	if _, ok := findCertificateChange(renewal.Changes, "SubjectKeyId"); ok {
+		t.Fatal("subject key identifier was reported as changed when renewing")
+	}
+}
+
+func TestCompareCertificates_ShouldReturnNoChanges_WhenCertificatesAreEqual(t *testing.T) {
+	_, _, cert, _ := newTestRenewalLeaf(t)
+
+	changes, err := CompareCertificates(cert, cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Fatalf("changes %v reported for the same certificate", changes)
+	}
+}
+
+func TestCompareCertificates_ShouldReturnError_WhenCertificateIsNil(t *testing.T) {
+	_, _, cert, _ := newTestRenewalLeaf(t)
+
+	if _, err := CompareCertificates(nil, cert); err == nil {
+		t.Fatal("error was not returned for a nil previous certificate")
+	}
+	if _, err := CompareCertificates(cert, nil); err == nil {
+		t.Fatal("error was not returned for a nil current certificate")
+	}
+}
+
+func TestRenewCertificate_ShouldKeepRawSubject_WhenAttributeOrderIsNotCanonical(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root, _, err := NewCertificateBuilder().
+		WithSigner(key).
+		WithCommonName("Acme Root CA").
+		WithExtraNames(pkix.AttributeTypeAndValue{Type: oidAttributeOrganization, Value: "Acme"}).
+		WithIsCertificateAuthority(true).
+		WithBasicConstraint().
+		WithKeyUsage(x509.KeyUsageCertSign | x509.KeyUsageCRLSign).
+		BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	child, _, err := (&CertificateAuthority{Certificate: root, Key: key}).Issue(NewCertificateBuilder().
+		WithCommonName("www.example.com").
+		WithDnsNames("www.example.com").
+		WithEnhancedKeyUsage(x509.ExtKeyUsageServerAuth))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	renewal, err := RenewCertificate(root, key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(renewal.Certificate.RawSubject, root.RawSubject) {
+		t.Fatalf("subject %X does not match %X", renewal.Certificate.RawSubject, root.RawSubject)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(renewal.Certificate)
+	if _, err := child.Verify(x509.VerifyOptions{Roots: roots, DNSName: "www.example.com"}); err != nil {
+		t.Fatalf("existing certificate does not chain to the renewed certificate authority: %v", err)
+	}
+	if _, ok := findCertificateChange(renewal.Changes, "Subject"); ok {
+		t.Fatal("subject was reported as changed")
+	}
+}
+
+func TestCompareCertificates_ShouldReportSubject_WhenOnlyEncodingDiffers(t *testing.T) {
+	source := newTestNonCanonicalSubjectCertificate(t)
+	builder, err := NewCertificateBuilderFromCertificate(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rebuilt, _, err := builder.
+		WithSubjectStringEncoding(SubjectStringEncodingPrintable).
+		BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rebuilt.Subject.String() != source.Subject.String() {
+		t.Fatalf("subject %v does not match %v", rebuilt.Subject, source.Subject)
+	}
+
+	changes, err := CompareCertificates(source, rebuilt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := findCertificateChange(changes, "Subject"); !ok {
+		t.Fatal("subject with a different encoding was not reported as changed")
+	}
+}
+
+func TestRenewCertificate_ShouldReportExtensions_WhenExtensionValueChanges(t *testing.T) {
+	_, intermediate, cert, key := newTestRenewalLeaf(t)
+	intermediate.CRLDistributionPoints = []string{"http://pki.example.com/crl/partition-1.crl"}
+	previous, err := RenewCertificate(cert, key, intermediate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	renewal, err := RenewCertificate(previous.Certificate, key, intermediate, RenewWithCustomization(func(builder *CertificateBuilder) {
+		builder.WithCRLDistributionPoints("http://pki.example.com/crl/partition-2.crl")
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := findCertificateChange(renewal.Changes, "Extensions"); !ok {
+		t.Fatal("changed crl distribution points were not reported")
+	}
+}
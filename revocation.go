@@ -0,0 +1,89 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// WithCRLDistributionPoints adds the URLs from which the certificate revocation list covering the certificate can be
+// retrieved
+func (c *CertificateBuilder) WithCRLDistributionPoints(values ...string) *CertificateBuilder {
+	for _, value := range values {
+		if err := validateURL(value); err != nil {
+			c.addError("WithCRLDistributionPoints", value, err)
+		}
+	}
+	if c.err != nil {
+		return c
+	}
+	c.crlDistributionPoints = append(c.crlDistributionPoints, values...)
+	return c
+}
+
+// WithOCSPServers adds the URLs of the OCSP responders that can report the revocation status of the certificate,
+// included in the authority information access extension
+func (c *CertificateBuilder) WithOCSPServers(values ...string) *CertificateBuilder {
+	for _, value := range values {
+		if err := validateURL(value); err != nil {
+			c.addError("WithOCSPServers", value, err)
+		}
+	}
+	if c.err != nil {
+		return c
+	}
+	c.ocspServers = append(c.ocspServers, values...)
+	return c
+}
+
+// WithIssuingCertificateURLs adds the URLs from which the certificate of the issuer can be retrieved, included in the
+// authority information access extension
+func (c *CertificateBuilder) WithIssuingCertificateURLs(values ...string) *CertificateBuilder {
+	for _, value := range values {
+		if err := validateURL(value); err != nil {
+			c.addError("WithIssuingCertificateURLs", value, err)
+		}
+	}
+	if c.err != nil {
+		return c
+	}
+	c.issuingCertificateURLs = append(c.issuingCertificateURLs, values...)
+	return c
+}
+
+// inheritRevocationEndpoints applies the revocation and issuer URLs of authority to builder for each kind of URL the
+// builder has not been given explicitly
+func (c *CertificateBuilder) inheritRevocationEndpoints(authority *CertificateAuthority) {
+	if len(c.crlDistributionPoints) == 0 {
+		c.WithCRLDistributionPoints(authority.CRLDistributionPoints...)
+	}
+	if len(c.ocspServers) == 0 {
+		c.WithOCSPServers(authority.OCSPServers...)
+	}
+	if len(c.issuingCertificateURLs) == 0 {
+		c.WithIssuingCertificateURLs(authority.IssuingCertificateURLs...)
+	}
+}
+
+func validateURL(value string) error {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return fmt.Errorf("%w, %v", ErrInvalidURI, err)
+	}
+	if !parsed.IsAbs() || parsed.Host == "" {
+		return fmt.Errorf("%w, url is not absolute", ErrInvalidURI)
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCertificateBuilder_WithCRLDistributionPoints_ShouldSetError_WhenUrlIsNotAbsolute(t *testing.T) {
+	c := NewCertificateBuilder().WithCRLDistributionPoints("/crl/root.crl")
+
+	if c.err == nil {
+		t.Fatal("error not set for relative url")
+	}
+}
+
+func TestCertificateBuilder_WithOCSPServers_ShouldSetError_WhenUrlIsInvalid(t *testing.T) {
+	c := NewCertificateBuilder().WithOCSPServers("not a url")
+
+	if c.err == nil {
+		t.Fatal("error not set for invalid url")
+	}
+}
+
+func TestCertificateBuilder_BuildSelfSignedCertificate_ShouldIncludeRevocationEndpoints_WhenConfigured(t *testing.T) {
+	cert, _, err := NewCertificateBuilder().
+		WithCommonName("leaf").
+		WithCRLDistributionPoints("http://pki.example.com/crl/leaf.crl").
+		WithOCSPServers("http://ocsp.example.com").
+		WithIssuingCertificateURLs("http://pki.example.com/ca.cer").
+		BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(cert.CRLDistributionPoints, []string{"http://pki.example.com/crl/leaf.crl"}) {
+		t.Fatalf("unexpected crl distribution points %v", cert.CRLDistributionPoints)
+	}
+	if !reflect.DeepEqual(cert.OCSPServer, []string{"http://ocsp.example.com"}) {
+		t.Fatalf("unexpected ocsp servers %v", cert.OCSPServer)
+	}
+	if !reflect.DeepEqual(cert.IssuingCertificateURL, []string{"http://pki.example.com/ca.cer"}) {
+		t.Fatalf("unexpected issuing certificate urls %v", cert.IssuingCertificateURL)
+	}
+}
+
+func TestCertificateAuthority_Issue_ShouldInheritRevocationEndpoints_WhenBuilderHasNone(t *testing.T) {
+	factory, _, intermediate := newTestCertificateAuthorities(t)
+	intermediate.CRLDistributionPoints = []string{"http://pki.example.com/crl/issuing.crl"}
+	intermediate.OCSPServers = []string{"http://ocsp.example.com"}
+	intermediate.IssuingCertificateURLs = []string{"http://pki.example.com/issuing.cer"}
+
+	cert, _, err := factory.NewServerCertificate(intermediate, "www.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(cert.CRLDistributionPoints, intermediate.CRLDistributionPoints) {
+		t.Fatalf("unexpected crl distribution points %v", cert.CRLDistributionPoints)
+	}
+	if !reflect.DeepEqual(cert.OCSPServer, intermediate.OCSPServers) {
+		t.Fatalf("unexpected ocsp servers %v", cert.OCSPServer)
+	}
+	if !reflect.DeepEqual(cert.IssuingCertificateURL, intermediate.IssuingCertificateURLs) {
+		t.Fatalf("unexpected issuing certificate urls %v", cert.IssuingCertificateURL)
+	}
+}
+
+func TestCertificateAuthority_Issue_ShouldKeepBuilderRevocationEndpoints_WhenSupplied(t *testing.T) {
+	_, _, intermediate := newTestCertificateAuthorities(t)
+	intermediate.CRLDistributionPoints = []string{"http://pki.example.com/crl/issuing.crl"}
+
+	cert, _, err := intermediate.Issue(NewCertificateBuilder().
+		WithCommonName("leaf").
+		WithCRLDistributionPoints("http://pki.example.com/crl/partition-1.crl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(cert.CRLDistributionPoints, []string{"http://pki.example.com/crl/partition-1.crl"}) {
+		t.Fatalf("unexpected crl distribution points %v", cert.CRLDistributionPoints)
+	}
+}
+
+func TestCertificateAuthority_Issue_ShouldNotModifyBuilder(t *testing.T) {
+	_, _, intermediate := newTestCertificateAuthorities(t)
+	intermediate.CRLDistributionPoints = []string{"http://pki.example.com/crl/issuing.crl"}
+	intermediate.OCSPServers = []string{"http://ocsp.example.com"}
+	intermediate.IssuingCertificateURLs = []string{"http://pki.example.com/issuing.cer"}
+	builder := NewCertificateBuilder().
+		WithCommonName("leaf")
+
+	if _, _, err := intermediate.Issue(builder); err != nil {
+		t.Fatal(err)
+	}
+
+	if builder.crlDistributionPoints != nil || builder.ocspServers != nil || builder.issuingCertificateURLs != nil {
+		t.Fatal("revocation endpoints of the certificate authority were added to the builder")
+	}
+	if builder.serialNumberSource != nil {
+		t.Fatal("serial number source of the certificate authority was added to the builder")
+	}
+}
+
+func TestCertificateAuthority_Issue_ShouldNotAddErrorsToBuilder_WhenInheritedEndpointIsInvalid(t *testing.T) {
+	_, _, intermediate := newTestCertificateAuthorities(t)
+	intermediate.CRLDistributionPoints = []string{"pki.example.com/crl/issuing.crl"}
+	builder := NewCertificateBuilder().
+		WithCommonName("leaf").
+		WithIssuingCertificateURLs("pki.example.com/issuing.cer")
+
+	if _, _, err := intermediate.Issue(builder); err == nil {
+		t.Fatal("expected error for invalid urls")
+	}
+
+	builderErr, ok := builder.err.(*BuilderError)
+	if !ok {
+		t.Fatalf("unexpected builder error %v", builder.err)
+	}
+	if len(builderErr.Errors) != 1 {
+		t.Fatalf("errors of the issued copy were added to the builder: %v", builderErr)
+	}
+}
@@ -0,0 +1,186 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxSerialNumberBytes is the largest serial number permitted by RFC 5280, 20 octets including the sign bit
+const maxSerialNumberBytes = 20
+
+// SerialNumberSource provides the serial numbers of certificates, implementations must be safe for concurrent use
+type SerialNumberSource interface {
+	NextSerialNumber() (*big.Int, error)
+}
+
+type randomSerialNumberSource struct {
+	random io.Reader
+}
+
+// NewRandomSerialNumberSource returns a source of positive 128-bit random serial numbers read from random, a nil random
+// uses crypto/rand. This is the default source used by CertificateBuilder
+func NewRandomSerialNumberSource(random io.Reader) SerialNumberSource {
+	if random == nil {
+		random = rand.Reader
+	}
+	return &randomSerialNumberSource{random: random}
+}
+
+func (s *randomSerialNumberSource) NextSerialNumber() (*big.Int, error) {
+	for {
+		value, err := readRandomInt(s.random, 16)
+		if err != nil {
+			return nil, err
+		}
+		if value.Sign() > 0 {
+			return value, nil
+		}
+	}
+}
+
+type timeRandomSerialNumberSource struct {
+	random io.Reader
+	now    func() time.Time
+}
+
+// NewTimeRandomSerialNumberSource returns a source of serial numbers made up of the current time in nanoseconds
+// followed by 64 random bits, so serial numbers sort by issue time while retaining 64 bits of entropy. A nil random
+// uses crypto/rand
+func NewTimeRandomSerialNumberSource(random io.Reader) SerialNumberSource {
+	if random == nil {
+		random = rand.Reader
+	}
+	return &timeRandomSerialNumberSource{random: random, now: time.Now}
+}
+
+func (s *timeRandomSerialNumberSource) NextSerialNumber() (*big.Int, error) {
+	random, err := readRandomInt(s.random, 8)
+	if err != nil {
+		return nil, err
+	}
+	value := big.NewInt(s.now().UnixNano())
+	value.Lsh(value, 64)
+	value.Or(value, random)
+	if value.Sign() <= 0 {
+		return nil, fmt.Errorf("time %v cannot be used in a serial number", s.now())
+	}
+	return value, nil
+}
+
+type fileCounterSerialNumberSource struct {
+	filename string
+	mutex    sync.Mutex
+}
+
+// NewFileCounterSerialNumberSource returns a source of monotonically increasing serial numbers whose last value is
+// persisted as a decimal number in filename, the first serial number is 1 when the file does not exist. The counter
+// is safe for use within a process but must not be shared by concurrently running processes
+func NewFileCounterSerialNumberSource(filename string) SerialNumberSource {
+	return &fileCounterSerialNumberSource{filename: filename}
+}
+
+func (s *fileCounterSerialNumberSource) NextSerialNumber() (*big.Int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	current := big.NewInt(0)
+	content, err := os.ReadFile(s.filename)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if _, ok := current.SetString(strings.TrimSpace(string(content)), 10); !ok || current.Sign() < 0 {
+			return nil, fmt.Errorf("serial number counter %s does not contain a valid serial number", s.filename)
+		}
+	}
+
+	next := new(big.Int).Add(current, big.NewInt(1))
+	if err := validateSerialNumber(next); err != nil {
+		return nil, fmt.Errorf("serial number counter %s is exhausted: %w", s.filename, err)
+	}
+	if err := writeCounterFile(s.filename, next.String()+"\n"); err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+// maxUniqueSerialNumberAttempts limits how often a colliding serial number is replaced before giving up, a source
+// repeatedly producing duplicates is broken rather than unlucky
+const maxUniqueSerialNumberAttempts = 10
+
+type uniqueSerialNumberSource struct {
+	source SerialNumberSource
+	issued map[string]struct{}
+	mutex  sync.Mutex
+}
+
+// NewUniqueSerialNumberSource wraps source so that it never returns the same serial number twice, serial numbers are
+// remembered for the lifetime of the returned source
+func NewUniqueSerialNumberSource(source SerialNumberSource) SerialNumberSource {
+	return &uniqueSerialNumberSource{source: source, issued: make(map[string]struct{})}
+}
+
+func (s *uniqueSerialNumberSource) NextSerialNumber() (*big.Int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for attempt := 0; attempt < maxUniqueSerialNumberAttempts; attempt++ {
+		value, err := s.source.NextSerialNumber()
+		if err != nil {
+			return nil, err
+		}
+		key := value.String()
+		if _, found := s.issued[key]; !found {
+			s.issued[key] = struct{}{}
+			return value, nil
+		}
+	}
+	return nil, fmt.Errorf("unable to obtain a unique serial number after %d attempts", maxUniqueSerialNumberAttempts)
+}
+
+// validateSerialNumber checks value is a positive integer no longer than the 20 octets permitted by RFC 5280
+func validateSerialNumber(value *big.Int) error {
+	if value == nil {
+		return ErrNilValue
+	}
+	if value.Sign() <= 0 {
+		return fmt.Errorf("%w, serial number must be positive", ErrInvalidValue)
+	}
+	if value.BitLen() > maxSerialNumberBytes*8-1 {
+		return fmt.Errorf("%w, serial number cannot exceed %d octets", ErrInvalidValue, maxSerialNumberBytes)
+	}
+	return nil
+}
+
+func readRandomInt(random io.Reader, size int) (*big.Int, error) {
+	bytes := make([]byte, size)
+	if _, err := io.ReadFull(random, bytes); err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(bytes), nil
+}
+
+// writeCounterFile replaces filename with content by renaming a temporary file so an interrupted write cannot leave
+// a truncated counter behind
+func writeCounterFile(filename string, content string) error {
+	return writeFileAtomically(filename, []byte(content), 0600, false)
+}
@@ -0,0 +1,190 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"bytes"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fixedSerialNumberSource struct {
+	values []int64
+	next   int
+}
+
+func (s *fixedSerialNumberSource) NextSerialNumber() (*big.Int, error) {
+	value := s.values[s.next%len(s.values)]
+	s.next++
+	return big.NewInt(value), nil
+}
+
+func TestRandomSerialNumberSource_NextSerialNumber_ShouldReturnPositive128BitValue(t *testing.T) {
+	source := NewRandomSerialNumberSource(nil)
+
+	for i := 0; i < 100; i++ {
+		value, err := source.NextSerialNumber()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value.Sign() <= 0 || value.BitLen() > 128 {
+			t.Fatalf("serial number %v is not a positive 128-bit value", value)
+		}
+	}
+}
+
+func TestRandomSerialNumberSource_NextSerialNumber_ShouldReturnError_WhenRandomIsExhausted(t *testing.T) {
+	source := NewRandomSerialNumberSource(bytes.NewReader(make([]byte, 8)))
+
+	if _, err := source.NextSerialNumber(); err == nil {
+		t.Fatal("expected an error when random data runs out")
+	}
+}
+
+func TestTimeRandomSerialNumberSource_NextSerialNumber_ShouldIncrease_WhenTimeAdvances(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	source := &timeRandomSerialNumberSource{random: bytes.NewReader(bytes.Repeat([]byte{0xff}, 16)), now: func() time.Time { return now }}
+
+	first, err := source.NextSerialNumber()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(time.Nanosecond)
+	second, err := source.NextSerialNumber()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if second.Cmp(first) <= 0 {
+		t.Fatalf("serial number %v is not greater than %v", second, first)
+	}
+	if new(big.Int).Rsh(first, 64).Int64() != now.Add(-time.Nanosecond).UnixNano() {
+		t.Fatal("serial number does not start with the issue time")
+	}
+}
+
+func TestFileCounterSerialNumberSource_NextSerialNumber_ShouldPersistCounter(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "serial")
+
+	for _, expected := range []int64{1, 2} {
+		value, err := NewFileCounterSerialNumberSource(filename).NextSerialNumber()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value.Int64() != expected {
+			t.Fatalf("serial number %v does not match expected %d", value, expected)
+		}
+	}
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(string(content)) != "2" {
+		t.Fatalf("unexpected counter file content %q", content)
+	}
+}
+
+func TestFileCounterSerialNumberSource_NextSerialNumber_ShouldReturnError_WhenFileIsCorrupt(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "serial")
+	if err := os.WriteFile(filename, []byte("not a number"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewFileCounterSerialNumberSource(filename).NextSerialNumber(); err == nil {
+		t.Fatal("expected an error for a corrupt counter file")
+	}
+}
+
+func TestUniqueSerialNumberSource_NextSerialNumber_ShouldSkipDuplicates(t *testing.T) {
+	source := NewUniqueSerialNumberSource(&fixedSerialNumberSource{values: []int64{1, 1, 2}})
+
+	first, err := source.NextSerialNumber()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := source.NextSerialNumber()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.Int64() != 1 || second.Int64() != 2 {
+		t.Fatalf("unexpected serial numbers %v and %v", first, second)
+	}
+}
+
+func TestUniqueSerialNumberSource_NextSerialNumber_ShouldReturnError_WhenSourceOnlyRepeats(t *testing.T) {
+	source := NewUniqueSerialNumberSource(&fixedSerialNumberSource{values: []int64{7}})
+	if _, err := source.NextSerialNumber(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := source.NextSerialNumber(); err == nil {
+		t.Fatal("expected an error when no unique serial number is available")
+	}
+}
+
+func TestCertificateBuilder_WithSerialNumber_ShouldSetError_WhenValueIsNotPositive(t *testing.T) {
+	c := NewCertificateBuilder().WithSerialNumber(big.NewInt(0))
+
+	if !errors.Is(c.err, ErrInvalidValue) {
+		t.Fatalf("unexpected error %v", c.err)
+	}
+}
+
+func TestCertificateBuilder_WithSerialNumber_ShouldSetError_WhenValueExceeds20Octets(t *testing.T) {
+	c := NewCertificateBuilder().WithSerialNumber(new(big.Int).Lsh(big.NewInt(1), 160))
+
+	if !errors.Is(c.err, ErrInvalidValue) {
+		t.Fatalf("unexpected error %v", c.err)
+	}
+}
+
+func TestCertificateBuilder_BuildSelfSignedCertificate_ShouldUseNewSerialNumber_WhenBuiltTwice(t *testing.T) {
+	c := NewCertificateBuilder().WithCommonName("leaf").WithKeyAlgorithm(KeyAlgorithmECDSAP256)
+
+	first, _, err := c.BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := c.BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if first.SerialNumber.Cmp(second.SerialNumber) == 0 {
+		t.Fatal("serial number was reused")
+	}
+	if first.SerialNumber.BitLen() <= 64 && second.SerialNumber.BitLen() <= 64 {
+		t.Fatal("default serial numbers do not have 128 bits of randomness")
+	}
+}
+
+func TestCertificateAuthority_Issue_ShouldUseSerialNumberSource_WhenBuilderHasNone(t *testing.T) {
+	_, _, intermediate := newTestCertificateAuthorities(t)
+	intermediate.SerialNumbers = &fixedSerialNumberSource{values: []int64{42}}
+
+	cert, _, err := intermediate.Issue(NewCertificateBuilder().WithCommonName("leaf").WithKeyAlgorithm(KeyAlgorithmECDSAP256))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cert.SerialNumber.Int64() != 42 {
+		t.Fatalf("serial number %v was not taken from the certificate authority", cert.SerialNumber)
+	}
+}
@@ -0,0 +1,261 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"io"
+)
+
+// SignatureAlgorithmPolicy sets the minimum strength of the signature algorithms a builder will sign with
+type SignatureAlgorithmPolicy int32
+
+const (
+	// SignatureAlgorithmPolicyModern rejects signatures using MD5 or SHA-1, it is the default
+	SignatureAlgorithmPolicyModern SignatureAlgorithmPolicy = iota
+	// SignatureAlgorithmPolicyLegacy also permits SHA-1, for relying parties which cannot validate anything newer
+	SignatureAlgorithmPolicyLegacy
+	// SignatureAlgorithmPolicyStrict only permits SHA-384, SHA-512 and Ed25519 signatures
+	SignatureAlgorithmPolicyStrict
+)
+
+func (p SignatureAlgorithmPolicy) String() string {
+	switch p {
+	case SignatureAlgorithmPolicyModern:
+		return "Modern"
+	case SignatureAlgorithmPolicyLegacy:
+		return "Legacy"
+	case SignatureAlgorithmPolicyStrict:
+		return "Strict"
+	default:
+		return fmt.Sprintf("SignatureAlgorithmPolicy(%d)", int32(p))
+	}
+}
+
+// permits reports whether signatures using hash are strong enough for the policy, a zero hash is used by algorithms
+// such as Ed25519 which sign messages directly
+func (p SignatureAlgorithmPolicy) permits(hash crypto.Hash) bool {
+	switch hash {
+	case crypto.MD5, crypto.MD5SHA1:
+		return false
+	case crypto.SHA1:
+		return p == SignatureAlgorithmPolicyLegacy
+	case crypto.SHA256:
+		return p != SignatureAlgorithmPolicyStrict
+	default:
+		return true
+	}
+}
+
+// WithSignatureAlgorithm sets the algorithm used to sign the certificate or certificate request, it must suit the
+// signing key, which is the issuer key for signed certificates. By default the algorithm is chosen from the signing
+// key as crypto/x509 would, using SHA-384 in place of SHA-256 under SignatureAlgorithmPolicyStrict
+func (c *CertificateBuilder) WithSignatureAlgorithm(value x509.SignatureAlgorithm) *CertificateBuilder {
+	switch value {
+	case x509.MD2WithRSA, x509.MD5WithRSA:
+		c.addError("WithSignatureAlgorithm", value, ErrWeakSignatureAlgorithm)
+	default:
+		if _, err := signerOptions(value); err != nil {
+			c.addError("WithSignatureAlgorithm", value, fmt.Errorf("%w, %v", ErrInvalidValue, err))
+		}
+	}
+	if c.err != nil {
+		return c
+	}
+	c.signatureAlgorithm = value
+	return c
+}
+
+// WithSignatureAlgorithmPolicy sets the minimum strength of the signature algorithm, SignatureAlgorithmPolicyModern
+// is used by default
+func (c *CertificateBuilder) WithSignatureAlgorithmPolicy(value SignatureAlgorithmPolicy) *CertificateBuilder {
+	if value < SignatureAlgorithmPolicyModern || value > SignatureAlgorithmPolicyStrict {
+		c.addError("WithSignatureAlgorithmPolicy", value, ErrInvalidValue)
+	}
+	if c.err != nil {
+		return c
+	}
+	c.signatureAlgorithmPolicy = value
+	return c
+}
+
+// resolveSignatureAlgorithm returns the configured or default signature algorithm for signer after checking it suits
+// the key and is permitted by the signature algorithm policy
+func (c *CertificateBuilder) resolveSignatureAlgorithm(signer crypto.Signer) (x509.SignatureAlgorithm, error) {
+	publicKey := signer.Public()
+	algorithm := c.signatureAlgorithm
+	if algorithm == x509.UnknownSignatureAlgorithm {
+		algorithm = defaultSignatureAlgorithm(publicKey, c.signatureAlgorithmPolicy)
+	}
+	options, err := signerOptions(algorithm)
+	if err != nil {
+		return x509.UnknownSignatureAlgorithm, err
+	}
+	if expected := signatureAlgorithmKeyType(algorithm); expected != publicKeyAlgorithmOfSigner(publicKey) {
+		return x509.UnknownSignatureAlgorithm, fmt.Errorf("%w, signature algorithm %v requires a %v signing key", ErrKeyMismatch, algorithm, expected)
+	}
+	if !c.signatureAlgorithmPolicy.permits(options.HashFunc()) {
+		return x509.UnknownSignatureAlgorithm, fmt.Errorf("%w, %v is not permitted by the %v signature algorithm policy", ErrWeakSignatureAlgorithm, algorithm, c.signatureAlgorithmPolicy)
+	}
+	return algorithm, nil
+}
+
+// defaultSignatureAlgorithm returns the algorithm crypto/x509 would choose for key, with SHA-256 raised to SHA-384
+// under the strict policy
+func defaultSignatureAlgorithm(key crypto.PublicKey, policy SignatureAlgorithmPolicy) x509.SignatureAlgorithm {
+	strict := policy == SignatureAlgorithmPolicyStrict
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if strict {
+			return x509.SHA384WithRSA
+		}
+		return x509.SHA256WithRSA
+	case *ecdsa.PublicKey:
+		switch k.Curve {
+		case elliptic.P384():
+			return x509.ECDSAWithSHA384
+		case elliptic.P521():
+			return x509.ECDSAWithSHA512
+		}
+		if strict {
+			return x509.ECDSAWithSHA384
+		}
+		return x509.ECDSAWithSHA256
+	default:
+		return x509.PureEd25519
+	}
+}
+
+// signatureAlgorithmKeyType returns the type of key able to produce signatures of algorithm
+func signatureAlgorithmKeyType(algorithm x509.SignatureAlgorithm) x509.PublicKeyAlgorithm {
+	switch algorithm {
+	case x509.SHA1WithRSA, x509.SHA256WithRSA, x509.SHA384WithRSA, x509.SHA512WithRSA,
+		x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS, x509.SHA512WithRSAPSS:
+		return x509.RSA
+	case x509.ECDSAWithSHA1, x509.ECDSAWithSHA256, x509.ECDSAWithSHA384, x509.ECDSAWithSHA512:
+		return x509.ECDSA
+	case x509.PureEd25519:
+		return x509.Ed25519
+	default:
+		return x509.UnknownPublicKeyAlgorithm
+	}
+}
+
+// publicKeyAlgorithmOfSigner returns the type of key, unlike publicKeyAlgorithmOf it accepts any key size since the
+// signing key may belong to an existing issuer
+func publicKeyAlgorithmOfSigner(key crypto.PublicKey) x509.PublicKeyAlgorithm {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return x509.RSA
+	case *ecdsa.PublicKey:
+		return x509.ECDSA
+	case ed25519.PublicKey:
+		return x509.Ed25519
+	default:
+		return x509.UnknownPublicKeyAlgorithm
+	}
+}
+
+// signerOptions returns the hash and padding options used by crypto.Signer to produce signatures of algorithm
+func signerOptions(algorithm x509.SignatureAlgorithm) (crypto.SignerOpts, error) {
+	switch algorithm {
+	case x509.SHA1WithRSA, x509.ECDSAWithSHA1:
+		return crypto.SHA1, nil
+	case x509.SHA256WithRSA, x509.ECDSAWithSHA256:
+		return crypto.SHA256, nil
+	case x509.SHA384WithRSA, x509.ECDSAWithSHA384:
+		return crypto.SHA384, nil
+	case x509.SHA512WithRSA, x509.ECDSAWithSHA512:
+		return crypto.SHA512, nil
+	case x509.SHA256WithRSAPSS:
+		return &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA256}, nil
+	case x509.SHA384WithRSAPSS:
+		return &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA384}, nil
+	case x509.SHA512WithRSAPSS:
+		return &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: crypto.SHA512}, nil
+	case x509.PureEd25519:
+		return crypto.Hash(0), nil
+	default:
+		return nil, fmt.Errorf("unsupported signature algorithm %v", algorithm)
+	}
+}
+
+// isRSAPSS reports whether algorithm is one of the RSA-PSS signature algorithms
+func isRSAPSS(algorithm x509.SignatureAlgorithm) bool {
+	switch algorithm {
+	case x509.SHA256WithRSAPSS, x509.SHA384WithRSAPSS, x509.SHA512WithRSAPSS:
+		return true
+	default:
+		return false
+	}
+}
+
+// signMessage signs message with signer using algorithm, hashing it first unless the algorithm signs messages directly
+func signMessage(random io.Reader, signer crypto.Signer, algorithm x509.SignatureAlgorithm, message []byte) ([]byte, error) {
+	options, err := signerOptions(algorithm)
+	if err != nil {
+		return nil, err
+	}
+	digest := message
+	if hash := options.HashFunc(); hash != 0 {
+		h := hash.New()
+		h.Write(message)
+		digest = h.Sum(nil)
+	}
+	return signer.Sign(random, digest, options)
+}
+
+// verifySignature checks signature is a signature of message by publicKey using algorithm. Unlike
+// x509.Certificate.CheckSignature it accepts SHA-1, leaving the choice of acceptable algorithms to the caller
+func verifySignature(publicKey crypto.PublicKey, algorithm x509.SignatureAlgorithm, message []byte, signature []byte) error {
+	if signatureAlgorithmKeyType(algorithm) != publicKeyAlgorithmOfSigner(publicKey) {
+		return fmt.Errorf("signature algorithm %v does not match the %T public key", algorithm, publicKey)
+	}
+	options, err := signerOptions(algorithm)
+	if err != nil {
+		return err
+	}
+	digest := message
+	if hash := options.HashFunc(); hash != 0 {
+		h := hash.New()
+		h.Write(message)
+		digest = h.Sum(nil)
+	}
+
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		if pss, ok := options.(*rsa.PSSOptions); ok {
+			return rsa.VerifyPSS(key, pss.Hash, digest, signature, pss)
+		}
+		return rsa.VerifyPKCS1v15(key, options.HashFunc(), digest, signature)
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, digest, signature) {
+			return fmt.Errorf("ECDSA verification failure")
+		}
+		return nil
+	case ed25519.PublicKey:
+		if !ed25519.Verify(key, digest, signature) {
+			return fmt.Errorf("Ed25519 verification failure")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+}
@@ -0,0 +1,166 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"crypto/x509"
+	"errors"
+	"testing"
+)
+
+func TestCertificateBuilder_WithSignatureAlgorithm_ShouldSignWithSelectedAlgorithm(t *testing.T) {
+	tests := []struct {
+		keyAlgorithm KeyAlgorithm
+		algorithm    x509.SignatureAlgorithm
+	}{
+		{KeyAlgorithmRSA2048, x509.SHA256WithRSAPSS},
+		{KeyAlgorithmRSA2048, x509.SHA384WithRSAPSS},
+		{KeyAlgorithmRSA2048, x509.SHA512WithRSAPSS},
+		{KeyAlgorithmRSA2048, x509.SHA384WithRSA},
+		{KeyAlgorithmECDSAP256, x509.ECDSAWithSHA384},
+		{KeyAlgorithmECDSAP384, x509.ECDSAWithSHA512},
+	}
+	for _, test := range tests {
+		cert, _, err := NewCertificateBuilder().
+			WithKeyAlgorithm(test.keyAlgorithm).
+			WithCommonName("localhost").
+			WithSignatureAlgorithm(test.algorithm).
+			BuildSelfSignedCertificate()
+		if err != nil {
+			t.Fatalf("%v: %v", test.algorithm, err)
+		}
+		if cert.SignatureAlgorithm != test.algorithm {
+			t.Fatalf("signature algorithm %v does not match expected %v", cert.SignatureAlgorithm, test.algorithm)
+		}
+		if err := cert.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature); err != nil {
+			t.Fatalf("%v: %v", test.algorithm, err)
+		}
+	}
+}
+
+func TestCertificateBuilder_WithSignatureAlgorithm_ShouldSetError_WhenAlgorithmIsWeakOrUnsupported(t *testing.T) {
+	c := NewCertificateBuilder().WithSignatureAlgorithm(x509.MD5WithRSA)
+	if !errors.Is(c.err, ErrWeakSignatureAlgorithm) {
+		t.Fatalf("error %v is not ErrWeakSignatureAlgorithm", c.err)
+	}
+
+	c = NewCertificateBuilder().WithSignatureAlgorithm(x509.DSAWithSHA256)
+	if !errors.Is(c.err, ErrInvalidValue) {
+		t.Fatalf("error %v is not ErrInvalidValue", c.err)
+	}
+}
+
+func TestCertificateBuilder_BuildSignedCertificate_ShouldReturnError_WhenAlgorithmDoesNotSuitIssuerKey(t *testing.T) {
+	_, _, intermediate := newTestCertificateAuthorities(t)
+
+	_, _, err := NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithCommonName("localhost").
+		WithSignatureAlgorithm(x509.SHA256WithRSAPSS).
+		BuildSignedCertificate(intermediate.Certificate, intermediate.Key)
+	if !errors.Is(err, ErrKeyMismatch) {
+		t.Fatalf("error %v is not ErrKeyMismatch", err)
+	}
+}
+
+func TestCertificateBuilder_BuildSelfSignedCertificate_ShouldReturnError_WhenPolicyRejectsSHA1(t *testing.T) {
+	_, _, err := NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithCommonName("localhost").
+		WithSignatureAlgorithm(x509.ECDSAWithSHA1).
+		BuildSelfSignedCertificate()
+	if !errors.Is(err, ErrWeakSignatureAlgorithm) {
+		t.Fatalf("error %v is not ErrWeakSignatureAlgorithm", err)
+	}
+}
+
+func TestCertificateBuilder_BuildSelfSignedCertificate_ShouldSignWithSHA1_WhenPolicyIsLegacy(t *testing.T) {
+	cert, _, err := NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithCommonName("localhost").
+		WithSignatureAlgorithm(x509.ECDSAWithSHA1).
+		WithSignatureAlgorithmPolicy(SignatureAlgorithmPolicyLegacy).
+		BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cert.SignatureAlgorithm != x509.ECDSAWithSHA1 {
+		t.Fatalf("signature algorithm %v is not ECDSAWithSHA1", cert.SignatureAlgorithm)
+	}
+}
+
+func TestCertificateBuilder_WithSignatureAlgorithmPolicy_ShouldDefaultToSHA384_WhenPolicyIsStrict(t *testing.T) {
+	for keyAlgorithm, expected := range map[KeyAlgorithm]x509.SignatureAlgorithm{
+		KeyAlgorithmRSA2048:   x509.SHA384WithRSA,
+		KeyAlgorithmECDSAP256: x509.ECDSAWithSHA384,
+		KeyAlgorithmEd25519:   x509.PureEd25519,
+	} {
+		cert, _, err := NewCertificateBuilder().
+			WithKeyAlgorithm(keyAlgorithm).
+			WithCommonName("localhost").
+			WithSignatureAlgorithmPolicy(SignatureAlgorithmPolicyStrict).
+			BuildSelfSignedCertificate()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cert.SignatureAlgorithm != expected {
+			t.Fatalf("%v: signature algorithm %v does not match expected %v", keyAlgorithm, cert.SignatureAlgorithm, expected)
+		}
+	}
+
+	_, _, err := NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithCommonName("localhost").
+		WithSignatureAlgorithm(x509.ECDSAWithSHA256).
+		WithSignatureAlgorithmPolicy(SignatureAlgorithmPolicyStrict).
+		BuildSelfSignedCertificate()
+	if !errors.Is(err, ErrWeakSignatureAlgorithm) {
+		t.Fatalf("error %v is not ErrWeakSignatureAlgorithm", err)
+	}
+}
+
+func TestCertificateBuilder_BuildCertificateRequest_ShouldSignWithSelectedAlgorithm(t *testing.T) {
+	request, _, err := NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmRSA2048).
+		WithCommonName("localhost").
+		WithSignatureAlgorithm(x509.SHA384WithRSAPSS).
+		BuildCertificateRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.SignatureAlgorithm != x509.SHA384WithRSAPSS {
+		t.Fatalf("signature algorithm %v is not SHA384WithRSAPSS", request.SignatureAlgorithm)
+	}
+	if err := request.CheckSignature(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCertificateBuilder_BuildCertificateRequest_ShouldSignWithRSAPSS_WhenChallengePasswordIsSet(t *testing.T) {
+	request, _, err := NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmRSA2048).
+		WithCommonName("localhost").
+		WithChallengePassword("secret").
+		WithSignatureAlgorithm(x509.SHA256WithRSAPSS).
+		BuildCertificateRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.SignatureAlgorithm != x509.SHA256WithRSAPSS {
+		t.Fatalf("signature algorithm %v is not SHA256WithRSAPSS", request.SignatureAlgorithm)
+	}
+	if err := request.CheckSignature(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,72 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// dnsNameProfile applies the IDNA lookup mapping along with the DNS length limits so that
+// empty labels and over-long names are rejected
+var dnsNameProfile = idna.New(idna.MapForLookup(), idna.BidiRule(), idna.VerifyDNSLength(true))
+
+// normalizeDnsName validates value as a DNS name, optionally prefixed by a "*." wildcard label,
+// and returns its ASCII (punycode) form
+func normalizeDnsName(value string) (string, error) {
+	name := value
+	wildcard := strings.HasPrefix(name, "*.")
+	if wildcard {
+		name = strings.TrimPrefix(name, "*.")
+	}
+
+	ascii, err := dnsNameProfile.ToASCII(name)
+	if err != nil {
+		return "", fmt.Errorf("%w, %v", ErrInvalidDnsName, err)
+	}
+	if wildcard {
+		ascii = "*." + ascii
+	}
+	return ascii, nil
+}
+
+func validateIPAddress(value net.IP) error {
+	if value.To16() == nil {
+		return ErrInvalidIPAddress
+	}
+	return nil
+}
+
+func validateEmailAddress(value string) error {
+	address, err := mail.ParseAddress(value)
+	if err != nil || address.Address != value {
+		return ErrInvalidEmailAddress
+	}
+	return nil
+}
+
+func validateURI(value *url.URL) error {
+	if value == nil {
+		return ErrNilValue
+	}
+	if !value.IsAbs() {
+		return fmt.Errorf("%w, uri is not absolute", ErrInvalidURI)
+	}
+	return nil
+}
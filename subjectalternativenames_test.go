@@ -0,0 +1,114 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+)
+
+func TestCertificateBuilder_WithDnsNames_ShouldStorePunycode_WhenNameIsInternationalized(t *testing.T) {
+	c := NewCertificateBuilder()
+	c.WithDnsNames("bücher.example", "*.Example.com")
+
+	if c.err != nil {
+		t.Fatal(c.err)
+	}
+	if c.dnsNames[0] != "xn--bcher-kva.example" {
+		t.Fatalf("dns name %v does not match expected value xn--bcher-kva.example", c.dnsNames[0])
+	}
+	if c.dnsNames[1] != "*.example.com" {
+		t.Fatalf("dns name %v does not match expected value *.example.com", c.dnsNames[1])
+	}
+}
+
+func TestCertificateBuilder_WithDnsNames_ShouldSetError_WhenNameIsInvalid(t *testing.T) {
+	for _, name := range []string{"", "bad..example", "under_score.example"} {
+		c := NewCertificateBuilder()
+		c.WithDnsNames(name)
+		if c.err == nil {
+			t.Fatalf("error was not set for invalid dns name %q", name)
+		}
+	}
+}
+
+func TestCertificateBuilder_WithDnsNames_ShouldNotUpdateDnsNames_WhenBuilderHasError(t *testing.T) {
+	c := NewCertificateBuilder()
+	c.err = fmt.Errorf("sample error")
+	c.WithDnsNames("localhost")
+
+	if len(c.dnsNames) != 0 {
+		t.Fatal("dns names were updated when builder had error")
+	}
+}
+
+func TestCertificateBuilder_WithIPAddresses_ShouldSetError_WhenAddressIsInvalid(t *testing.T) {
+	c := NewCertificateBuilder()
+	c.WithIPAddresses(net.IP{127, 0})
+
+	if c.err == nil {
+		t.Fatal("error was not set for invalid ip address")
+	}
+}
+
+func TestCertificateBuilder_WithEmailAddresses_ShouldSetError_WhenAddressIsInvalid(t *testing.T) {
+	c := NewCertificateBuilder()
+	c.WithEmailAddresses("Wile E. Coyote <wile@acme.example>")
+
+	if c.err == nil {
+		t.Fatal("error was not set for email address containing a display name")
+	}
+}
+
+func TestCertificateBuilder_WithURIs_ShouldSetError_WhenUriIsNotAbsolute(t *testing.T) {
+	c := NewCertificateBuilder()
+	c.WithURIs(&url.URL{Path: "relative/path"})
+
+	if c.err == nil {
+		t.Fatal("error was not set for relative uri")
+	}
+}
+
+func TestCertificateBuilder_BuildSelfSignedCertificate_ShouldIncludeSubjectAlternativeNames(t *testing.T) {
+	uri, err := url.Parse("spiffe://acme.example/anvils")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, _, err := NewCertificateBuilder().
+		WithBitSize(2048).
+		WithCommonName("localhost").
+		WithDnsNames("localhost").
+		WithIPAddresses(net.ParseIP("127.0.0.1"), net.IPv6loopback).
+		WithEmailAddresses("wile@acme.example").
+		WithURIs(uri).
+		BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.VerifyHostname("localhost"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.VerifyHostname("::1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(c.EmailAddresses) != 1 || c.EmailAddresses[0] != "wile@acme.example" {
+		t.Fatalf("email addresses %v do not match expected value", c.EmailAddresses)
+	}
+	if len(c.URIs) != 1 || c.URIs[0].String() != uri.String() {
+		t.Fatalf("uris %v do not match expected value", c.URIs)
+	}
+}
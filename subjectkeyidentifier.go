@@ -0,0 +1,167 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"crypto"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"fmt"
+	"math/big"
+)
+
+type SubjectKeyIdentifierMethod int32
+
+const (
+	// SubjectKeyIdentifierMethodSHA1 is RFC 5280 method (1), the SHA-1 hash of the subject public key
+	SubjectKeyIdentifierMethodSHA1 SubjectKeyIdentifierMethod = iota
+	// SubjectKeyIdentifierMethodTruncatedSHA256 is RFC 7093 method (1), the leftmost 160 bits of the SHA-256 hash
+	// of the subject public key
+	SubjectKeyIdentifierMethodTruncatedSHA256
+)
+
+var oidExtensionSubjectKeyId = asn1.ObjectIdentifier{2, 5, 29, 14}
+
+// computeSubjectKeyIdentifier hashes the subjectPublicKey bit string of publicKey using method
+func computeSubjectKeyIdentifier(publicKey crypto.PublicKey, method SubjectKeyIdentifierMethod) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	var info struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(der, &info); err != nil {
+		return nil, err
+	}
+
+	switch method {
+	case SubjectKeyIdentifierMethodSHA1:
+		hash := sha1.Sum(info.PublicKey.Bytes)
+		return hash[:], nil
+	case SubjectKeyIdentifierMethodTruncatedSHA256:
+		hash := sha256.Sum256(info.PublicKey.Bytes)
+		return hash[:20], nil
+	default:
+		return nil, fmt.Errorf("unsupported subject key identifier method %d", method)
+	}
+}
+
+// applyKeyIdentifiers adds the subject and authority key identifiers requested by the builder to template,
+// issuerCert is nil for self-signed certificates
+func (c *CertificateBuilder) applyKeyIdentifiers(template *x509.Certificate, publicKey crypto.PublicKey, issuerCert *x509.Certificate) error {
+	includeSubjectKeyIdentifier := c.includeSubjectKeyIdentifier || c.subjectKeyIdentifierCritical
+	if !includeSubjectKeyIdentifier && !c.includeAuthorityKeyIdentifier {
+		return nil
+	}
+
+	subjectKeyId, err := computeSubjectKeyIdentifier(publicKey, c.subjectKeyIdentifierMethod)
+	if err != nil {
+		return err
+	}
+	if includeSubjectKeyIdentifier {
+		template.SubjectKeyId = subjectKeyId
+		if c.subjectKeyIdentifierCritical {
+			// crypto/x509 always marks the extension non-critical, supplying it as an extra extension takes precedence
+			value, err := asn1.Marshal(subjectKeyId)
+			if err != nil {
+				return err
+			}
+			template.ExtraExtensions = append(template.ExtraExtensions, pkix.Extension{Id: oidExtensionSubjectKeyId, Critical: true, Value: value})
+		}
+	}
+
+	if c.includeAuthorityKeyIdentifier {
+		switch {
+		case issuerCert == nil:
+			template.AuthorityKeyId = subjectKeyId
+		case len(issuerCert.SubjectKeyId) > 0:
+			template.AuthorityKeyId = issuerCert.SubjectKeyId
+		default:
+			authorityKeyId, err := computeSubjectKeyIdentifier(issuerCert.PublicKey, c.subjectKeyIdentifierMethod)
+			if err != nil {
+				return err
+			}
+			template.AuthorityKeyId = authorityKeyId
+		}
+	}
+	return nil
+}
+
+// parseCertificateWithCriticalSubjectKeyIdentifier parses der which carries a critical subject key identifier. crypto/x509
+// refuses to parse such certificates, so a copy of der with the identifier marked non-critical is parsed instead and its
+// raw contents, signature and extensions are then restored from der. Parsing does not check the signature so the copy
+// does not need to be signed
+func parseCertificateWithCriticalSubjectKeyIdentifier(der []byte) (*x509.Certificate, error) {
+	var certificate struct {
+		TBSCertificate     asn1.RawValue
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		SignatureValue     asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(der, &certificate); err != nil {
+		return nil, err
+	}
+	var tbs struct {
+		Version            int `asn1:"optional,explicit,default:0,tag:0"`
+		SerialNumber       *big.Int
+		SignatureAlgorithm pkix.AlgorithmIdentifier
+		Issuer             asn1.RawValue
+		Validity           asn1.RawValue
+		Subject            asn1.RawValue
+		PublicKey          asn1.RawValue
+		IssuerUniqueId     asn1.BitString   `asn1:"optional,tag:1"`
+		SubjectUniqueId    asn1.BitString   `asn1:"optional,tag:2"`
+		Extensions         []pkix.Extension `asn1:"optional,explicit,tag:3"`
+	}
+	if _, err := asn1.Unmarshal(certificate.TBSCertificate.FullBytes, &tbs); err != nil {
+		return nil, err
+	}
+	for i := range tbs.Extensions {
+		if tbs.Extensions[i].Id.Equal(oidExtensionSubjectKeyId) {
+			tbs.Extensions[i].Critical = false
+		}
+	}
+	shadowTBS, err := asn1.Marshal(tbs)
+	if err != nil {
+		return nil, err
+	}
+	shadow := certificate
+	shadow.TBSCertificate = asn1.RawValue{FullBytes: shadowTBS}
+	shadowBytes, err := asn1.Marshal(shadow)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := x509.ParseCertificate(shadowBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	extensions := make([]pkix.Extension, len(cert.Extensions))
+	copy(extensions, cert.Extensions)
+	for i := range extensions {
+		if extensions[i].Id.Equal(oidExtensionSubjectKeyId) {
+			extensions[i].Critical = true
+		}
+	}
+
+	cert.Raw = der
+	cert.RawTBSCertificate = certificate.TBSCertificate.FullBytes
+	cert.Signature = certificate.SignatureValue.RightAlign()
+	cert.Extensions = extensions
+	return cert, nil
+}
@@ -0,0 +1,192 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"io"
+	"testing"
+)
+
+func TestCertificateBuilder_BuildSelfSignedCertificate_ShouldIncludeSubjectKeyIdentifier_WhenRequested(t *testing.T) {
+	c, key, err := NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithCommonName("localhost").
+		WithIncludeSubjectKeyIdentifier().
+		BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := computeSubjectKeyIdentifier(key.Public(), SubjectKeyIdentifierMethodSHA1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(c.SubjectKeyId, expected) {
+		t.Fatalf("subject key identifier %x does not match expected value %x", c.SubjectKeyId, expected)
+	}
+}
+
+func TestCertificateBuilder_BuildSelfSignedCertificate_ShouldUseTruncatedSHA256_WhenMethodIsTruncatedSHA256(t *testing.T) {
+	c, _, err := NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithCommonName("localhost").
+		WithIncludeSubjectKeyIdentifier().
+		WithSubjectKeyIdentifierMethod(SubjectKeyIdentifierMethodTruncatedSHA256).
+		BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var info struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(c.RawSubjectPublicKeyInfo, &info); err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256(info.PublicKey.Bytes)
+	if !bytes.Equal(c.SubjectKeyId, hash[:20]) {
+		t.Fatalf("subject key identifier %x does not match expected value %x", c.SubjectKeyId, hash[:20])
+	}
+}
+
+func TestCertificateBuilder_BuildSelfSignedCertificate_ShouldMarkSubjectKeyIdentifierCritical_WhenRequested(t *testing.T) {
+	c, _, err := NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithCommonName("localhost").
+		WithSubjectKeyIdentifierCritical(true).
+		BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count := 0
+	for _, extension := range c.Extensions {
+		if extension.Id.Equal(oidExtensionSubjectKeyId) {
+			count++
+			if !extension.Critical {
+				t.Fatal("subject key identifier was not marked critical")
+			}
+		}
+	}
+	if count != 1 {
+		t.Fatalf("found %d subject key identifier extensions, expected 1", count)
+	}
+	criticalSubjectKeyIdentifier := []byte{0x06, 0x03, 0x55, 0x1d, 0x0e, 0x01, 0x01, 0xff}
+	if !bytes.Contains(c.RawTBSCertificate, criticalSubjectKeyIdentifier) {
+		t.Fatal("encoded certificate does not contain a critical subject key identifier")
+	}
+	if err := c.CheckSignature(c.SignatureAlgorithm, c.RawTBSCertificate, c.Signature); err != nil {
+		t.Fatal(err)
+	}
+}
+
+type countingSigner struct {
+	crypto.Signer
+	count int
+}
+
+func (s *countingSigner) Sign(random io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	s.count++
+	return s.Signer.Sign(random, digest, opts)
+}
+
+func TestCertificateBuilder_BuildSelfSignedCertificate_ShouldSignOnce_WhenSubjectKeyIdentifierIsCritical(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer := &countingSigner{Signer: key}
+
+	c, _, err := NewCertificateBuilder().
+		WithSigner(signer).
+		WithCommonName("localhost").
+		WithSubjectKeyIdentifierCritical(true).
+		BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if signer.count != 1 {
+		t.Fatalf("certificate was signed %d times, expected 1", signer.count)
+	}
+	reparsed, err := parseCertificateWithCriticalSubjectKeyIdentifier(c.Raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reparsed.Equal(c) || !bytes.Equal(reparsed.SubjectKeyId, c.SubjectKeyId) {
+		t.Fatal("parsed certificate does not match the issued certificate")
+	}
+}
+
+func TestCertificateBuilder_BuildSignedCertificate_ShouldCopyAuthorityKeyIdentifierFromIssuer(t *testing.T) {
+	issuer, issuerKey, err := NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithCommonName("Acme Root CA").
+		WithIsCertificateAuthority(true).
+		WithBasicConstraint().
+		WithIncludeSubjectKeyIdentifier().
+		BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, _, err := NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithCommonName("localhost").
+		WithIncludeAuthorityKeyIdentifier().
+		BuildSignedCertificate(issuer, issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(c.AuthorityKeyId) == 0 || !bytes.Equal(c.AuthorityKeyId, issuer.SubjectKeyId) {
+		t.Fatalf("authority key identifier %x does not match issuer subject key identifier %x", c.AuthorityKeyId, issuer.SubjectKeyId)
+	}
+}
+
+func TestCertificateBuilder_WithSubjectKeyIdentifierMethod_ShouldSetError_WhenMethodIsUnknown(t *testing.T) {
+	c := NewCertificateBuilder()
+	c.WithSubjectKeyIdentifierMethod(SubjectKeyIdentifierMethod(7))
+	if c.err == nil {
+		t.Fatal("error was not set for unknown subject key identifier method")
+	}
+}
+
+func TestCertificateBuilder_WithExtensions_ShouldIncludeExtensionsInCertificate(t *testing.T) {
+	extension := pkix.Extension{Id: asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 55555, 1}, Value: []byte{0x05, 0x00}}
+	c, _, err := NewCertificateBuilder().
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithCommonName("localhost").
+		WithExtensions(extension).
+		BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, actual := range c.Extensions {
+		if actual.Id.Equal(extension.Id) {
+			return
+		}
+	}
+	t.Fatalf("extension %v was not included in the certificate", extension.Id)
+}
@@ -0,0 +1,104 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"crypto/x509"
+	"fmt"
+	"time"
+)
+
+const (
+	// defaultValidity is the lifetime of certificates when neither a validity nor a not after time is set
+	defaultValidity = 365 * 24 * time.Hour
+	// maxBrowserValidity is the longest lifetime of a TLS server certificate accepted by browsers under the
+	// CA/Browser Forum baseline requirements
+	maxBrowserValidity = 398 * 24 * time.Hour
+)
+
+// WithValidity sets the lifetime of the certificate measured from its not before time, it is ignored when a not after
+// time is set. The default is 365 days
+func (c *CertificateBuilder) WithValidity(value time.Duration) *CertificateBuilder {
+	if value <= 0 {
+		c.addError("WithValidity", value, fmt.Errorf("%w, validity must be positive", ErrInvalidValue))
+	}
+	if c.err != nil {
+		return c
+	}
+	c.validity = value
+	return c
+}
+
+// WithBackdate moves the default not before time back by value to tolerate clock skew between systems, the not after
+// time is still calculated from the current time. It has no effect when a not before time is set
+func (c *CertificateBuilder) WithBackdate(value time.Duration) *CertificateBuilder {
+	if value < 0 {
+		c.addError("WithBackdate", value, ErrNegativeValue)
+	}
+	if c.err != nil {
+		return c
+	}
+	c.backdate = value
+	return c
+}
+
+// WithClampToIssuerValidity limits the validity of a certificate signed by an issuer to the validity of the issuer
+func (c *CertificateBuilder) WithClampToIssuerValidity(value bool) *CertificateBuilder {
+	if c.err != nil {
+		return c
+	}
+	c.clampToIssuerValidity = value
+	return c
+}
+
+// WithBrowserCompatibleValidity refuses to build TLS server certificates, those with the server authentication
+// extended key usage, whose lifetime exceeds the 398 days accepted by browsers
+func (c *CertificateBuilder) WithBrowserCompatibleValidity(value bool) *CertificateBuilder {
+	if c.err != nil {
+		return c
+	}
+	c.browserCompatibleValidity = value
+	return c
+}
+
+// applyValidity clamps the validity of template to that of issuerCert when requested and then checks the result
+func (c *CertificateBuilder) applyValidity(template *x509.Certificate, issuerCert *x509.Certificate) error {
+	if c.clampToIssuerValidity && issuerCert != nil {
+		if template.NotBefore.Before(issuerCert.NotBefore) {
+			template.NotBefore = issuerCert.NotBefore
+		}
+		if template.NotAfter.After(issuerCert.NotAfter) {
+			template.NotAfter = issuerCert.NotAfter
+		}
+	}
+
+	if !template.NotAfter.After(template.NotBefore) {
+		return fmt.Errorf("invalid validity, not after %v must be after not before %v", template.NotAfter, template.NotBefore)
+	}
+	if c.browserCompatibleValidity && isServerAuthentication(template.ExtKeyUsage) {
+		if lifetime := template.NotAfter.Sub(template.NotBefore); lifetime > maxBrowserValidity {
+			return fmt.Errorf("invalid validity, lifetime of %v exceeds the %v accepted by browsers for TLS server certificates", lifetime, maxBrowserValidity)
+		}
+	}
+	return nil
+}
+
+func isServerAuthentication(usages []x509.ExtKeyUsage) bool {
+	for _, usage := range usages {
+		if usage == x509.ExtKeyUsageServerAuth {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,123 @@
+//
+// Copyright © 2023 Terry Moreland
+// Permission is hereby granted, free of charge, to any person obtaining a copy of this software and associated documentation files (the "Software"),
+// to deal in the Software without restriction, including without limitation the rights to use, copy, modify, merge, publish, distribute, sublicense,
+// and/or sell copies of the Software, and to permit persons to whom the Software is furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER LIABILITY,
+// WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM, OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE SOFTWARE.
+//
+
+package x509certificates
+
+import (
+	"crypto/x509"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCertificateBuilder_WithValidity_ShouldSetError_WhenValueIsNotPositive(t *testing.T) {
+	c := NewCertificateBuilder().WithValidity(0)
+
+	if !errors.Is(c.err, ErrInvalidValue) {
+		t.Fatalf("unexpected error %v", c.err)
+	}
+}
+
+func TestCertificateBuilder_WithBackdate_ShouldSetError_WhenValueIsNegative(t *testing.T) {
+	c := NewCertificateBuilder().WithBackdate(-time.Minute)
+
+	if !errors.Is(c.err, ErrNegativeValue) {
+		t.Fatalf("unexpected error %v", c.err)
+	}
+}
+
+func TestCertificateBuilder_WithNotAfter_ShouldSetError_WhenBeforeNotBefore(t *testing.T) {
+	c := NewCertificateBuilder().
+		WithNotBefore(fixedClock()).
+		WithNotAfter(fixedClock().Add(-time.Hour))
+
+	if !errors.Is(c.err, ErrInvalidValue) {
+		t.Fatalf("unexpected error %v", c.err)
+	}
+}
+
+func TestCertificateBuilder_BuildSelfSignedCertificate_ShouldUseValidityAndBackdate_WhenConfigured(t *testing.T) {
+	cert, _, err := NewCertificateBuilder().
+		WithCommonName("leaf").
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithClock(fixedClock).
+		WithValidity(90 * 24 * time.Hour).
+		WithBackdate(5 * time.Minute).
+		BuildSelfSignedCertificate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cert.NotBefore.Equal(fixedClock().Add(-5 * time.Minute)) {
+		t.Fatalf("not before %v was not backdated", cert.NotBefore)
+	}
+	if !cert.NotAfter.Equal(fixedClock().Add(90 * 24 * time.Hour)) {
+		t.Fatalf("not after %v does not reflect the validity", cert.NotAfter)
+	}
+}
+
+func TestCertificateBuilder_BuildSignedCertificate_ShouldClampValidity_WhenIssuerExpiresFirst(t *testing.T) {
+	_, root, _ := newTestCertificateAuthorities(t)
+	issuerCert, issuerKey, err := NewCertificateBuilder().
+		WithCommonName("Short Lived CA").
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithIsCertificateAuthority(true).
+		WithBasicConstraint().
+		WithValidity(24*time.Hour).
+		BuildSignedCertificate(root.Certificate, root.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert, _, err := NewCertificateBuilder().
+		WithCommonName("leaf").
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithBackdate(time.Hour).
+		WithClampToIssuerValidity(true).
+		BuildSignedCertificate(issuerCert, issuerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !cert.NotAfter.Equal(issuerCert.NotAfter) || !cert.NotBefore.Equal(issuerCert.NotBefore) {
+		t.Fatalf("validity %v - %v was not clamped to the issuer %v - %v", cert.NotBefore, cert.NotAfter, issuerCert.NotBefore, issuerCert.NotAfter)
+	}
+}
+
+func TestCertificateBuilder_BuildSelfSignedCertificate_ShouldReturnError_WhenBrowserCompatibleServerCertificateExceeds398Days(t *testing.T) {
+	_, _, err := NewCertificateBuilder().
+		WithCommonName("www.example.com").
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithEnhancedKeyUsage(x509.ExtKeyUsageServerAuth).
+		WithValidity(399 * 24 * time.Hour).
+		WithBrowserCompatibleValidity(true).
+		BuildSelfSignedCertificate()
+
+	if err == nil {
+		t.Fatal("expected an error for a server certificate valid for more than 398 days")
+	}
+}
+
+func TestCertificateBuilder_BuildSelfSignedCertificate_ShouldAllowLongLifetime_WhenBrowserCompatibleCertificateIsNotForServers(t *testing.T) {
+	_, _, err := NewCertificateBuilder().
+		WithCommonName("client").
+		WithKeyAlgorithm(KeyAlgorithmECDSAP256).
+		WithEnhancedKeyUsage(x509.ExtKeyUsageClientAuth).
+		WithValidity(2 * 365 * 24 * time.Hour).
+		WithBrowserCompatibleValidity(true).
+		BuildSelfSignedCertificate()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+}